@@ -40,7 +40,18 @@ func parseSchema(s []byte) (schema.AvroType, error) {
 
 // Given two parsed Avro schemas, compile them into a program which can read the data
 // written by `writer` and store it in the structs generated for `reader`.
+// The program is optimized by replacing common sequences of instructions with superinstructions.
 func Compile(writer, reader schema.AvroType) (*vm.Program, error) {
+	compiled, err := compileUnoptimized(writer, reader)
+	if err != nil {
+		return nil, err
+	}
+	optimized := optimize(compiled)
+	log("%v", optimized)
+	return optimized, nil
+}
+
+func compileUnoptimized(writer, reader schema.AvroType) (*vm.Program, error) {
 	log("Compile()\n writer:\n %v\n---\nreader: %v\n---\n", writer, reader)
 
 	program := &irProgram{
@@ -48,6 +59,12 @@ func Compile(writer, reader schema.AvroType) (*vm.Program, error) {
 		errors:  make([]string, 0),
 	}
 	program.main = newIRMethod("main", program)
+	if reader != nil {
+		program.name = reader.Name()
+	} else {
+		program.name = writer.Name()
+	}
+	program.main.path = program.name
 
 	err := program.main.compileType(writer, reader)
 	if err != nil {
@@ -0,0 +1,70 @@
+package compiler
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/actgardner/gogen-avro/vm"
+)
+
+func TestProgramsAssemblyRoundTrip(t *testing.T) {
+	for file, avroType := range testSchemas(t) {
+		program, err := Compile(avroType, avroType)
+		if err != nil {
+			t.Fatalf("Unable to compile %v: %v", file, err)
+		}
+		if len(program.Sources) != len(program.Instructions) {
+			t.Fatalf("Expected a source for each instruction of %v, got %v", file, len(program.Sources))
+		}
+
+		assembled, err := vm.Assemble(program.Disassemble())
+		if err != nil {
+			t.Fatalf("Unable to assemble %v: %v", file, err)
+		}
+		if !reflect.DeepEqual(program, assembled) {
+			t.Fatalf("Expected %v, got %v", program, assembled)
+		}
+	}
+}
+
+func TestSourceMap(t *testing.T) {
+	writer := `{"type": "record", "name": "Order", "fields": [
+		{"name": "id", "type": "long"},
+		{"name": "note", "type": "string"},
+		{"name": "items", "type": {"type": "array", "items": {"type": "record", "name": "Item", "fields": [
+			{"name": "sku", "type": "string"}
+		]}}}
+	]}`
+	reader := `{"type": "record", "name": "Order", "fields": [
+		{"name": "id", "type": "long"},
+		{"name": "items", "type": {"type": "array", "items": {"type": "record", "name": "Item", "fields": [
+			{"name": "sku", "type": "string"},
+			{"name": "count", "type": "int", "default": 1}
+		]}}}
+	]}`
+	program, err := CompileSchemaBytes([]byte(writer), []byte(reader))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The source of the first instruction of each kind
+	expected := map[vm.Instruction]vm.Source{
+		{vm.Call, program.Instructions[0].Operand}: {Method: "main", Path: "Order"},
+		{vm.ReadSet, vm.Long}:                      {Method: "record-rw-Order", Path: "Order.id"},
+		{vm.Skip, vm.String}:                       {Method: "record-rw-Order", Path: "Order.note"},
+		{vm.AppendArray, vm.Unused}:                {Method: "record-rw-Order", Path: "Order.items[]"},
+		{vm.SetDefault, 1}:                         {Method: "record-rw-Item", Path: "Item.count"},
+		{vm.ReadSet, vm.String}:                    {Method: "record-rw-Item", Path: "Item.sku"},
+	}
+	found := make(map[vm.Instruction]vm.Source)
+	for i, inst := range program.Instructions {
+		if _, ok := found[inst]; !ok {
+			found[inst] = program.Sources[i]
+		}
+	}
+	for inst, source := range expected {
+		if found[inst] != source {
+			t.Errorf("Expected the source of %v to be %v, got %v\n%v", inst, source, found[inst], program)
+		}
+	}
+}
@@ -0,0 +1,726 @@
+package compiler
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"sync"
+
+	"github.com/actgardner/gogen-avro/schema"
+)
+
+// A Downgrade converts values written with a schema into the encoding of an older version of
+// that schema, for consumers which haven't been updated to the newer one yet. The older schema
+// is the target, and the conversion follows the rules the target would use to read the data:
+//   - fields which aren't in the target are dropped
+//   - fields of the target which aren't in the data are written with their default value
+//   - enums are mapped by symbol
+//   - union values are written as the first branch of the target union which can read them
+//   - longs can be written as ints, which the older schema may have used before they were widened
+//
+// Values which can't be represented in the target, like an enum symbol or a union branch it
+// doesn't have or a long which doesn't fit in an int, fail with an error. A Downgrade can be used from multiple goroutines.
+type Downgrade struct {
+	encode encoder
+	// The states of finished conversions, to reuse their buffers
+	states sync.Pool
+}
+
+// Serializer is implemented by the structs generated for records
+type Serializer interface {
+	Serialize(io.Writer) error
+}
+
+// The state of a single conversion
+type downgradeState struct {
+	data []byte
+	pos  int
+	// Values which are dropped are written here and thrown away
+	discard bytes.Buffer
+	// The buffers used to reorder the fields of records, one for each level of nested records being reordered
+	reorders []*reorderBuffer
+	depth    int
+}
+
+// The fields of a record encoded in the writer's order, and where each of the target's fields is in them
+type reorderBuffer struct {
+	encoded []byte
+	spans   [][2]int
+}
+
+// An encoder reads a value in the writer schema from the input, and writes it in the target schema
+type encoder func(s *downgradeState, out *bytes.Buffer) error
+
+// Given two Avro schemas, compile a Downgrade which converts values written with `writer`
+// into the encoding of `target`, an older version of the same schema.
+func CompileDowngradeBytes(writer, target []byte) (*Downgrade, error) {
+	writerType, err := parseSchema(writer)
+	if err != nil {
+		return nil, err
+	}
+
+	targetType, err := parseSchema(target)
+	if err != nil {
+		return nil, err
+	}
+	return CompileDowngrade(writerType, targetType)
+}
+
+// Given two parsed Avro schemas, compile a Downgrade which converts values written with `writer`
+// into the encoding of `target`.
+func CompileDowngrade(writer, target schema.AvroType) (*Downgrade, error) {
+	d := &downgrader{records: make(map[string]*encoder)}
+	encode, err := d.compile(writer, target, target.Name())
+	if err != nil {
+		return nil, err
+	}
+	return &Downgrade{encode: encode, states: sync.Pool{New: func() interface{} { return &downgradeState{} }}}, nil
+}
+
+// Convert converts a value encoded with the writer schema into the target schema
+func (d *Downgrade) Convert(data []byte) ([]byte, error) {
+	var out bytes.Buffer
+	s := d.states.Get().(*downgradeState)
+	s.data, s.pos, s.depth = data, 0, 0
+	defer func() {
+		s.data = nil
+		d.states.Put(s)
+	}()
+
+	if err := d.encode(s, &out); err != nil {
+		return nil, err
+	}
+	if s.pos != len(data) {
+		return nil, fmt.Errorf("Unable to downgrade value: %v bytes left after the end of the value", len(data)-s.pos)
+	}
+	return out.Bytes(), nil
+}
+
+// Serialize writes a record in the target schema. The record must be a struct generated for the writer schema.
+func (d *Downgrade) Serialize(record Serializer, w io.Writer) error {
+	var buf bytes.Buffer
+	if err := record.Serialize(&buf); err != nil {
+		return err
+	}
+	converted, err := d.Convert(buf.Bytes())
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(converted)
+	return err
+}
+
+func (s *downgradeState) readLong() (int64, error) {
+	var v uint64
+	for shift := uint(0); shift < 64; shift += 7 {
+		if s.pos >= len(s.data) {
+			return 0, io.ErrUnexpectedEOF
+		}
+		b := s.data[s.pos]
+		s.pos += 1
+		v |= uint64(b&0x7f) << shift
+		if b&0x80 == 0 {
+			return int64(v>>1) ^ -int64(v&1), nil
+		}
+	}
+	return 0, fmt.Errorf("Invalid varint")
+}
+
+func (s *downgradeState) next(n int64) ([]byte, error) {
+	if n < 0 {
+		return nil, fmt.Errorf("Invalid length: %v", n)
+	}
+	if n > int64(len(s.data)-s.pos) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	b := s.data[s.pos : s.pos+int(n)]
+	s.pos += int(n)
+	return b, nil
+}
+
+func putLong(out *bytes.Buffer, v int64) {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutVarint(buf[:], v)
+	out.Write(buf[:n])
+}
+
+func putFloat(out *bytes.Buffer, v float32) {
+	var buf [4]byte
+	binary.LittleEndian.PutUint32(buf[:], math.Float32bits(v))
+	out.Write(buf[:])
+}
+
+func putDouble(out *bytes.Buffer, v float64) {
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], math.Float64bits(v))
+	out.Write(buf[:])
+}
+
+func putBytes(out *bytes.Buffer, b []byte) {
+	putLong(out, int64(len(b)))
+	out.Write(b)
+}
+
+type downgrader struct {
+	// The encoders for each pair of writer and target records, so recursive records refer to themselves
+	records map[string]*encoder
+}
+
+// Compile an encoder for a value of type writer in the target type, where path is the field it's for
+func (d *downgrader) compile(writer, target schema.AvroType, path string) (encoder, error) {
+	// If the writer is not a union but the target is, write the first branch which can read it
+	if _, ok := writer.(*schema.UnionField); !ok {
+		if targetUnion, ok := target.(*schema.UnionField); ok {
+			targetIndex := unionBranch(writer, targetUnion)
+			if targetIndex < 0 {
+				return nil, fmt.Errorf("Incompatible types at %v: %v %v", path, target, writer)
+			}
+			encode, err := d.compile(writer, targetUnion.AvroTypes()[targetIndex], path)
+			if err != nil {
+				return nil, err
+			}
+			return func(s *downgradeState, out *bytes.Buffer) error {
+				putLong(out, int64(targetIndex))
+				return encode(s, out)
+			}, nil
+		}
+	}
+
+	if w, ok := writer.(*schema.UnionField); ok {
+		return d.compileUnion(w, target, path)
+	}
+
+	if narrowsLong(writer, target) {
+		return func(s *downgradeState, out *bytes.Buffer) error {
+			v, err := s.readLong()
+			if err != nil {
+				return err
+			}
+			if v < math.MinInt32 || v > math.MaxInt32 {
+				return fmt.Errorf("Unable to downgrade %v: %v doesn't fit in an int", path, v)
+			}
+			putLong(out, v)
+			return nil
+		}, nil
+	}
+
+	if !writer.IsReadableBy(target) {
+		return nil, fmt.Errorf("Incompatible types at %v: %v %v", path, target, writer)
+	}
+
+	switch w := writer.(type) {
+	case *schema.Reference:
+		return d.compileRef(w, target.(*schema.Reference), path)
+	case *schema.ArrayField:
+		items, err := d.compile(w.ItemType(), target.(*schema.ArrayField).ItemType(), path+"[]")
+		if err != nil {
+			return nil, err
+		}
+		return compileBlocks(items), nil
+	case *schema.MapField:
+		values, err := d.compile(w.ItemType(), target.(*schema.MapField).ItemType(), path+"[]")
+		if err != nil {
+			return nil, err
+		}
+		return compileBlocks(func(s *downgradeState, out *bytes.Buffer) error {
+			if err := copyBytes(s, out); err != nil {
+				return err
+			}
+			return values(s, out)
+		}), nil
+	case *schema.NullField:
+		return func(s *downgradeState, out *bytes.Buffer) error {
+			return nil
+		}, nil
+	case *schema.BoolField:
+		return func(s *downgradeState, out *bytes.Buffer) error {
+			b, err := s.next(1)
+			if err != nil {
+				return err
+			}
+			out.Write(b)
+			return nil
+		}, nil
+	case *schema.IntField, *schema.LongField:
+		switch target.(type) {
+		case *schema.FloatField:
+			return func(s *downgradeState, out *bytes.Buffer) error {
+				v, err := s.readLong()
+				if err != nil {
+					return err
+				}
+				putFloat(out, float32(v))
+				return nil
+			}, nil
+		case *schema.DoubleField:
+			return func(s *downgradeState, out *bytes.Buffer) error {
+				v, err := s.readLong()
+				if err != nil {
+					return err
+				}
+				putDouble(out, float64(v))
+				return nil
+			}, nil
+		}
+		// Ints and longs have the same encoding
+		return func(s *downgradeState, out *bytes.Buffer) error {
+			v, err := s.readLong()
+			if err != nil {
+				return err
+			}
+			putLong(out, v)
+			return nil
+		}, nil
+	case *schema.FloatField:
+		if _, ok := target.(*schema.DoubleField); ok {
+			return func(s *downgradeState, out *bytes.Buffer) error {
+				b, err := s.next(4)
+				if err != nil {
+					return err
+				}
+				putDouble(out, float64(math.Float32frombits(binary.LittleEndian.Uint32(b))))
+				return nil
+			}, nil
+		}
+		return copyFixed(4), nil
+	case *schema.DoubleField:
+		return copyFixed(8), nil
+	case *schema.StringField, *schema.BytesField:
+		// Strings and bytes have the same encoding
+		return copyBytes, nil
+	}
+	return nil, fmt.Errorf("Unsupported type: %v", writer)
+}
+
+func copyFixed(size int64) encoder {
+	return func(s *downgradeState, out *bytes.Buffer) error {
+		b, err := s.next(size)
+		out.Write(b)
+		return err
+	}
+}
+
+func copyBytes(s *downgradeState, out *bytes.Buffer) error {
+	size, err := s.readLong()
+	if err != nil {
+		return err
+	}
+	b, err := s.next(size)
+	if err != nil {
+		return err
+	}
+	putBytes(out, b)
+	return nil
+}
+
+// Re-encode the blocks of an array or map. The byte size of a block changes with its items, so it's not written.
+func compileBlocks(items encoder) encoder {
+	return func(s *downgradeState, out *bytes.Buffer) error {
+		for {
+			count, err := s.readLong()
+			if err != nil {
+				return err
+			}
+			if count == 0 {
+				putLong(out, 0)
+				return nil
+			}
+			if count < 0 {
+				if _, err := s.readLong(); err != nil {
+					return err
+				}
+				count = -count
+			}
+			putLong(out, count)
+			for i := int64(0); i < count; i++ {
+				if err := items(s, out); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
+
+// Whether a long is written as an int, which fails for values outside of the int range
+func narrowsLong(writer, target schema.AvroType) bool {
+	_, isLong := writer.(*schema.LongField)
+	_, isInt := target.(*schema.IntField)
+	return isLong && isInt
+}
+
+// The index of the branch of the target union a value of type writer is written as, or -1 if there's none.
+// A branch which can read every value is preferred over an int branch for a long.
+func unionBranch(writer schema.AvroType, target *schema.UnionField) int {
+	for i, t := range target.AvroTypes() {
+		if writer.IsReadableBy(t) {
+			return i
+		}
+	}
+	for i, t := range target.AvroTypes() {
+		if narrowsLong(writer, t) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (d *downgrader) compileUnion(writer *schema.UnionField, target schema.AvroType, path string) (encoder, error) {
+	branches := make([]encoder, len(writer.AvroTypes()))
+	compatible := false
+writer:
+	for i, t := range writer.AvroTypes() {
+		if targetUnion, ok := target.(*schema.UnionField); ok {
+			// If the target is also a union, write the first branch which can read the value
+			if targetIndex := unionBranch(t, targetUnion); targetIndex >= 0 {
+				encode, err := d.compile(t, targetUnion.AvroTypes()[targetIndex], path)
+				if err != nil {
+					return nil, err
+				}
+				branches[i] = func(s *downgradeState, out *bytes.Buffer) error {
+					putLong(out, int64(targetIndex))
+					return encode(s, out)
+				}
+				compatible = true
+				continue writer
+			}
+		} else if t.IsReadableBy(target) || narrowsLong(t, target) {
+			encode, err := d.compile(t, target, path)
+			if err != nil {
+				return nil, err
+			}
+			branches[i] = encode
+			compatible = true
+			continue
+		}
+
+		typeName := t.Name()
+		branches[i] = func(s *downgradeState, out *bytes.Buffer) error {
+			return fmt.Errorf("Unable to downgrade %v: the target schema has no type %v in the union", path, typeName)
+		}
+	}
+	if !compatible {
+		return nil, fmt.Errorf("Incompatible types at %v: %v %v", path, target, writer)
+	}
+
+	return func(s *downgradeState, out *bytes.Buffer) error {
+		index, err := s.readLong()
+		if err != nil {
+			return err
+		}
+		if index < 0 || index >= int64(len(branches)) {
+			return fmt.Errorf("Unable to downgrade %v: invalid union index %v", path, index)
+		}
+		return branches[index](s, out)
+	}, nil
+}
+
+func (d *downgrader) compileRef(writer, target *schema.Reference, path string) (encoder, error) {
+	switch w := writer.Def.(type) {
+	case *schema.RecordDefinition:
+		return d.compileRecord(w, target.Def.(*schema.RecordDefinition))
+	case *schema.EnumDefinition:
+		return compileEnum(w, target.Def.(*schema.EnumDefinition), path)
+	case *schema.FixedDefinition:
+		return copyFixed(int64(w.SizeBytes())), nil
+	}
+	return nil, fmt.Errorf("Unsupported reference type %v", writer)
+}
+
+// Map the writer's enum symbols to the target's by name
+func compileEnum(writer, target *schema.EnumDefinition, path string) (encoder, error) {
+	indexes := make([]int64, len(writer.Symbols()))
+	for i, symbol := range writer.Symbols() {
+		indexes[i] = -1
+		for j, targetSymbol := range target.Symbols() {
+			if symbol == targetSymbol {
+				indexes[i] = int64(j)
+			}
+		}
+	}
+
+	return func(s *downgradeState, out *bytes.Buffer) error {
+		index, err := s.readLong()
+		if err != nil {
+			return err
+		}
+		if index < 0 || index >= int64(len(indexes)) {
+			return fmt.Errorf("Unable to downgrade %v: invalid enum index %v", path, index)
+		}
+		if indexes[index] < 0 {
+			return fmt.Errorf("Unable to downgrade %v: the target schema has no enum symbol %q", path, writer.Symbols()[index])
+		}
+		putLong(out, indexes[index])
+		return nil
+	}, nil
+}
+
+func (d *downgrader) compileRecord(writer, target *schema.RecordDefinition) (encoder, error) {
+	key := writer.AvroName().String() + " " + target.AvroName().String()
+	if encode, ok := d.records[key]; ok {
+		return func(s *downgradeState, out *bytes.Buffer) error {
+			return (*encode)(s, out)
+		}, nil
+	}
+	encode := new(encoder)
+	d.records[key] = encode
+
+	path := target.Name()
+	targetFields := target.Fields()
+
+	// The encoded default of each target field which isn't in the writer
+	defaults := make([][]byte, len(targetFields))
+	for i, field := range targetFields {
+		if writer.GetReaderField(field) != nil {
+			continue
+		}
+		if !field.HasDefault() {
+			return nil, fmt.Errorf("Incompatible schemas: field %v in target is not present in writer and has no default value", field.Name())
+		}
+		var buf bytes.Buffer
+		if err := encodeDefault(&buf, field.Type(), field.Default()); err != nil {
+			return nil, fmt.Errorf("Invalid default for field %v.%v: %v", path, field.Name(), err)
+		}
+		defaults[i] = buf.Bytes()
+	}
+
+	// The encoder of each writer field, and the index of the target field it's written to or -1 to drop it
+	fields := make([]encoder, len(writer.Fields()))
+	targets := make([]int, len(writer.Fields()))
+	inOrder := true
+	next := 0
+	for i, field := range writer.Fields() {
+		targets[i] = -1
+		for j, targetField := range targetFields {
+			if targetField.IsSameField(field) {
+				targets[i] = j
+			}
+		}
+
+		var err error
+		if targets[i] < 0 {
+			fields[i], err = d.compile(field.Type(), field.Type(), path+"."+field.Name())
+			fields[i] = dropped(fields[i])
+		} else {
+			targetField := targetFields[targets[i]]
+			fields[i], err = d.compile(field.Type(), targetField.Type(), path+"."+targetField.Name())
+			inOrder = inOrder && targets[i] == next
+			next += 1
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	inOrder = inOrder && next == len(targetFields)
+
+	if inOrder {
+		*encode = func(s *downgradeState, out *bytes.Buffer) error {
+			for _, field := range fields {
+				if err := field(s, out); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		return *encode, nil
+	}
+
+	// Encode the fields in the writer's order, then rearrange them in the target's order
+	*encode = func(s *downgradeState, out *bytes.Buffer) error {
+		if s.depth == len(s.reorders) {
+			s.reorders = append(s.reorders, &reorderBuffer{})
+		}
+		r := s.reorders[s.depth]
+		s.depth += 1
+		defer func() { s.depth -= 1 }()
+
+		if cap(r.spans) < len(targetFields) {
+			r.spans = make([][2]int, len(targetFields))
+		}
+		spans := r.spans[:len(targetFields)]
+
+		start := out.Len()
+		for i, field := range fields {
+			fieldStart := out.Len()
+			if err := field(s, out); err != nil {
+				return err
+			}
+			if targets[i] >= 0 {
+				spans[targets[i]] = [2]int{fieldStart - start, out.Len() - start}
+			}
+		}
+
+		r.encoded = append(r.encoded[:0], out.Bytes()[start:]...)
+		out.Truncate(start)
+		for i, span := range spans {
+			if defaults[i] != nil {
+				out.Write(defaults[i])
+			} else {
+				out.Write(r.encoded[span[0]:span[1]])
+			}
+		}
+		return nil
+	}
+	return *encode, nil
+}
+
+// Read a value with an encoder, and throw it away
+func dropped(encode encoder) encoder {
+	return func(s *downgradeState, out *bytes.Buffer) error {
+		s.discard.Reset()
+		return encode(s, &s.discard)
+	}
+}
+
+// Encode the default value of a field, as parsed from the JSON schema
+func encodeDefault(out *bytes.Buffer, t schema.AvroType, value interface{}) error {
+	switch v := t.(type) {
+	case *schema.NullField:
+		if value != nil {
+			return fmt.Errorf("expected null, got %v", value)
+		}
+		return nil
+	case *schema.BoolField:
+		b, ok := value.(bool)
+		if !ok {
+			return fmt.Errorf("expected a boolean, got %v", value)
+		}
+		if b {
+			out.WriteByte(1)
+		} else {
+			out.WriteByte(0)
+		}
+		return nil
+	case *schema.IntField, *schema.LongField, *schema.FloatField, *schema.DoubleField:
+		n, ok := value.(float64)
+		if !ok {
+			return fmt.Errorf("expected a number, got %v", value)
+		}
+		switch t.(type) {
+		case *schema.FloatField:
+			putFloat(out, float32(n))
+		case *schema.DoubleField:
+			putDouble(out, n)
+		default:
+			putLong(out, int64(n))
+		}
+		return nil
+	case *schema.StringField:
+		s, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("expected a string, got %v", value)
+		}
+		putBytes(out, []byte(s))
+		return nil
+	case *schema.BytesField:
+		b, err := defaultBytes(value)
+		if err != nil {
+			return err
+		}
+		putBytes(out, b)
+		return nil
+	case *schema.UnionField:
+		// The default of a union is a value of its first type
+		putLong(out, 0)
+		return encodeDefault(out, v.AvroTypes()[0], value)
+	case *schema.ArrayField:
+		items, ok := value.([]interface{})
+		if !ok {
+			return fmt.Errorf("expected an array, got %v", value)
+		}
+		if len(items) > 0 {
+			putLong(out, int64(len(items)))
+			for _, item := range items {
+				if err := encodeDefault(out, v.ItemType(), item); err != nil {
+					return err
+				}
+			}
+		}
+		putLong(out, 0)
+		return nil
+	case *schema.MapField:
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("expected an object, got %v", value)
+		}
+		keys := make([]string, 0, len(m))
+		for key := range m {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		if len(keys) > 0 {
+			putLong(out, int64(len(keys)))
+			for _, key := range keys {
+				putBytes(out, []byte(key))
+				if err := encodeDefault(out, v.ItemType(), m[key]); err != nil {
+					return err
+				}
+			}
+		}
+		putLong(out, 0)
+		return nil
+	case *schema.Reference:
+		return encodeDefaultRef(out, v, value)
+	}
+	return fmt.Errorf("unsupported type %v", t.Name())
+}
+
+func encodeDefaultRef(out *bytes.Buffer, ref *schema.Reference, value interface{}) error {
+	switch def := ref.Def.(type) {
+	case *schema.RecordDefinition:
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("expected an object, got %v", value)
+		}
+		for _, field := range def.Fields() {
+			fieldValue, ok := m[field.Name()]
+			if !ok {
+				if !field.HasDefault() {
+					return fmt.Errorf("no value for field %v", field.Name())
+				}
+				fieldValue = field.Default()
+			}
+			if err := encodeDefault(out, field.Type(), fieldValue); err != nil {
+				return err
+			}
+		}
+		return nil
+	case *schema.EnumDefinition:
+		for i, symbol := range def.Symbols() {
+			if symbol == value {
+				putLong(out, int64(i))
+				return nil
+			}
+		}
+		return fmt.Errorf("unknown symbol %v for enum %v", value, def.AvroName())
+	case *schema.FixedDefinition:
+		b, err := defaultBytes(value)
+		if err != nil {
+			return err
+		}
+		if len(b) != def.SizeBytes() {
+			return fmt.Errorf("expected %v bytes for fixed %v, got %v", def.SizeBytes(), def.AvroName(), len(b))
+		}
+		out.Write(b)
+		return nil
+	}
+	return fmt.Errorf("unsupported type %v", ref.Name())
+}
+
+// Bytes and fixed defaults are strings, where each code point is a byte
+func defaultBytes(value interface{}) ([]byte, error) {
+	s, ok := value.(string)
+	if !ok {
+		return nil, fmt.Errorf("expected a string, got %v", value)
+	}
+	b := make([]byte, 0, len(s))
+	for _, r := range s {
+		if r > 255 {
+			return nil, fmt.Errorf("invalid byte %q", r)
+		}
+		b = append(b, byte(r))
+	}
+	return b, nil
+}
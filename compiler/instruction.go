@@ -23,6 +23,20 @@ func (b *literalIRInstruction) CompileToVM(_ *irProgram) ([]vm.Instruction, erro
 	return []vm.Instruction{b.instruction}, nil
 }
 
+// Enter a record field, remembering its name so errors can report where they happened
+type enterIRInstruction struct {
+	index int
+	name  string
+}
+
+func (b *enterIRInstruction) VMLength() int {
+	return 1
+}
+
+func (b *enterIRInstruction) CompileToVM(_ *irProgram) ([]vm.Instruction, error) {
+	return []vm.Instruction{vm.Instruction{vm.Enter, b.index}}, nil
+}
+
 type methodCallIRInstruction struct {
 	method string
 }
@@ -41,6 +55,8 @@ func (b *methodCallIRInstruction) CompileToVM(p *irProgram) ([]vm.Instruction, e
 
 type blockStartIRInstruction struct {
 	blockId int
+	// If there's no target for the items, blocks with a byte size are skipped entirely
+	skip bool
 }
 
 func (b *blockStartIRInstruction) VMLength() int {
@@ -51,8 +67,22 @@ func (b *blockStartIRInstruction) VMLength() int {
 // If the block length is 0, jump past the block body because we're done
 // If the block length is negative, read the byte count, throw it away, multiply the length by -1
 // Once we've figured out the number of iterations, push the loop length onto the loop stack
+// When skipping, a negative block length is followed by the size of the block in bytes,
+// so skip the whole block like a bytes value and go back to the top to read the next block
 func (b *blockStartIRInstruction) CompileToVM(p *irProgram) ([]vm.Instruction, error) {
 	block := p.blocks[b.blockId]
+	if b.skip {
+		return []vm.Instruction{
+			vm.Instruction{vm.Read, vm.Long},
+			vm.Instruction{vm.EvalEqual, 0},
+			vm.Instruction{vm.CondJump, block.end + 5},
+			vm.Instruction{vm.EvalGreater, 0},
+			vm.Instruction{vm.CondJump, block.start + 7},
+			vm.Instruction{vm.Skip, vm.Bytes},
+			vm.Instruction{vm.Jump, block.start},
+			vm.Instruction{vm.PushLoop, 0},
+		}, nil
+	}
 	return []vm.Instruction{
 		vm.Instruction{vm.Read, vm.Long},
 		vm.Instruction{vm.EvalEqual, 0},
@@ -99,9 +129,9 @@ func (s *switchStartIRInstruction) VMLength() int {
 func (s *switchStartIRInstruction) CompileToVM(p *irProgram) ([]vm.Instruction, error) {
 	sw := p.switches[s.switchId]
 	body := []vm.Instruction{}
-	for value, offset := range sw.cases {
+	for value := 0; value < s.size; value++ {
 		body = append(body, vm.Instruction{vm.EvalEqual, value})
-		body = append(body, vm.Instruction{vm.CondJump, offset + 1})
+		body = append(body, vm.Instruction{vm.CondJump, sw.cases[value] + 1})
 	}
 
 	body = append(body, vm.Instruction{vm.Halt, s.errId})
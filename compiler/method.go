@@ -12,6 +12,9 @@ type irMethod struct {
 	offset  int
 	body    []irInstruction
 	program *irProgram
+	// The path of the field being compiled, and the path of each instruction in the body
+	path    string
+	sources []string
 }
 
 func newIRMethod(name string, program *irProgram) *irMethod {
@@ -22,38 +25,48 @@ func newIRMethod(name string, program *irProgram) *irMethod {
 	}
 }
 
+// Add an instruction, remembering the path of the field it was compiled for
+func (p *irMethod) add(inst irInstruction) {
+	p.body = append(p.body, inst)
+	p.sources = append(p.sources, p.path)
+}
+
 func (p *irMethod) addLiteral(op vm.Op, operand int) {
-	p.body = append(p.body, &literalIRInstruction{vm.Instruction{op, operand}})
+	p.add(&literalIRInstruction{vm.Instruction{op, operand}})
+}
+
+func (p *irMethod) addEnter(index int, name string) {
+	p.add(&enterIRInstruction{index, name})
 }
 
 func (p *irMethod) addMethodCall(method string) {
-	p.body = append(p.body, &methodCallIRInstruction{method})
+	p.add(&methodCallIRInstruction{method})
 }
 
-func (p *irMethod) addBlockStart() int {
+func (p *irMethod) addBlockStart(skip bool) int {
 	id := len(p.program.blocks)
 	p.program.blocks = append(p.program.blocks, &irBlock{})
-	p.body = append(p.body, &blockStartIRInstruction{id})
+	p.add(&blockStartIRInstruction{id, skip})
 	return id
 }
 
 func (p *irMethod) addBlockEnd(id int) {
-	p.body = append(p.body, &blockEndIRInstruction{id})
+	p.add(&blockEndIRInstruction{id})
 }
 
 func (p *irMethod) addSwitchStart(size, errorId int) int {
 	id := len(p.program.switches)
 	p.program.switches = append(p.program.switches, &irSwitch{0, make(map[int]int), 0})
-	p.body = append(p.body, &switchStartIRInstruction{id, size, errorId})
+	p.add(&switchStartIRInstruction{id, size, errorId})
 	return id
 }
 
 func (p *irMethod) addSwitchCase(id, writerIndex, readerIndex int) {
-	p.body = append(p.body, &switchCaseIRInstruction{id, writerIndex, readerIndex})
+	p.add(&switchCaseIRInstruction{id, writerIndex, readerIndex})
 }
 
 func (p *irMethod) addSwitchEnd(id int) {
-	p.body = append(p.body, &switchEndIRInstruction{id})
+	p.add(&switchEndIRInstruction{id})
 }
 
 func (p *irMethod) addError(msg string) int {
@@ -62,6 +75,16 @@ func (p *irMethod) addError(msg string) int {
 	return id
 }
 
+// Append the source of each VM instruction the body compiles to
+func (p *irMethod) appendSources(sources []vm.Source) []vm.Source {
+	for i, inst := range p.body {
+		for j := 0; j < inst.VMLength(); j++ {
+			sources = append(sources, vm.Source{Method: p.name, Path: p.sources[i]})
+		}
+	}
+	return sources
+}
+
 func (p *irMethod) VMLength() int {
 	len := 0
 	for _, inst := range p.body {
@@ -123,16 +146,20 @@ func (p *irMethod) compileType(writer, reader schema.AvroType) error {
 		}
 		return nil
 	case *schema.StringField:
-		p.addLiteral(vm.Read, vm.String)
-		if reader != nil {
-			p.addLiteral(vm.Set, vm.String)
+		if reader == nil {
+			p.addLiteral(vm.Skip, vm.String)
+			return nil
 		}
+		p.addLiteral(vm.Read, vm.String)
+		p.addLiteral(vm.Set, vm.String)
 		return nil
 	case *schema.BytesField:
-		p.addLiteral(vm.Read, vm.Bytes)
-		if reader != nil {
-			p.addLiteral(vm.Set, vm.Bytes)
+		if reader == nil {
+			p.addLiteral(vm.Skip, vm.Bytes)
+			return nil
 		}
+		p.addLiteral(vm.Read, vm.Bytes)
+		p.addLiteral(vm.Set, vm.Bytes)
 		return nil
 	case *schema.FloatField:
 		p.addLiteral(vm.Read, vm.Float)
@@ -155,7 +182,7 @@ func (p *irMethod) compileType(writer, reader schema.AvroType) error {
 	case *schema.NullField:
 		return nil
 	}
-	return fmt.Errorf("Unsupported type: %t", writer)
+	return fmt.Errorf("Unsupported type: %v", writer)
 }
 
 func (p *irMethod) compileRef(writer, reader *schema.Reference) error {
@@ -178,6 +205,7 @@ func (p *irMethod) compileRef(writer, reader *schema.Reference) error {
 
 		if _, ok := p.program.methods[recordMethodName]; !ok {
 			method := p.program.createMethod(recordMethodName)
+			method.path = writer.Def.Name()
 			err := method.compileRecord(writer.Def.(*schema.RecordDefinition), readerDef)
 			if err != nil {
 				return err
@@ -204,17 +232,23 @@ func (p *irMethod) compileRef(writer, reader *schema.Reference) error {
 		}
 		return p.compileEnum(writer.Def.(*schema.EnumDefinition), readerDef)
 	}
-	return fmt.Errorf("Unsupported reference type %t", reader)
+	return fmt.Errorf("Unsupported reference type %v", reader)
 }
 
 func (p *irMethod) compileMap(writer, reader *schema.MapField) error {
 	log("compileMap()\n writer:\n %v\n---\nreader: %v\n---\n", writer, reader)
-	blockId := p.addBlockStart()
-	p.addLiteral(vm.Read, vm.String)
+	path := p.path
+	p.path += "[]"
+	defer func() { p.path = path }()
+
+	blockId := p.addBlockStart(reader == nil)
 	var readerType schema.AvroType
 	if reader != nil {
+		p.addLiteral(vm.Read, vm.String)
 		p.addLiteral(vm.AppendMap, vm.Unused)
 		readerType = reader.ItemType()
+	} else {
+		p.addLiteral(vm.Skip, vm.String)
 	}
 	err := p.compileType(writer.ItemType(), readerType)
 	if err != nil {
@@ -229,7 +263,11 @@ func (p *irMethod) compileMap(writer, reader *schema.MapField) error {
 
 func (p *irMethod) compileArray(writer, reader *schema.ArrayField) error {
 	log("compileArray()\n writer:\n %v\n---\nreader: %v\n---\n", writer, reader)
-	blockId := p.addBlockStart()
+	path := p.path
+	p.path += "[]"
+	defer func() { p.path = path }()
+
+	blockId := p.addBlockStart(reader == nil)
 	var readerType schema.AvroType
 	if reader != nil {
 		p.addLiteral(vm.AppendArray, vm.Unused)
@@ -249,12 +287,16 @@ func (p *irMethod) compileArray(writer, reader *schema.ArrayField) error {
 func (p *irMethod) compileRecord(writer, reader *schema.RecordDefinition) error {
 	// Look up whether there's a corresonding target field and if so, parse the source field into that target
 	log("compileRecord()\n writer:\n %v\n---\nreader: %v\n---\n", writer, reader)
+	path := p.path
+	defer func() { p.path = path }()
+
 	if reader != nil {
 		for _, field := range reader.Fields() {
 			if writerField := writer.GetReaderField(field); writerField == nil {
 				if !field.HasDefault() {
 					return fmt.Errorf("Incompatible schemas: field %v in reader is not present in writer and has no default value", field.Name())
 				}
+				p.path = path + "." + field.Name()
 				p.addLiteral(vm.SetDefault, field.Index())
 			}
 		}
@@ -263,11 +305,13 @@ func (p *irMethod) compileRecord(writer, reader *schema.RecordDefinition) error
 	for _, field := range writer.Fields() {
 		var readerType schema.AvroType
 		var readerField *schema.Field
+		p.path = path + "." + field.Name()
 		if reader != nil {
 			readerField = reader.GetReaderField(field)
 			if readerField != nil {
 				readerType = readerField.Type()
-				p.addLiteral(vm.Enter, readerField.Index())
+				p.path = path + "." + readerField.Name()
+				p.addEnter(readerField.Index(), readerField.Name())
 			}
 		}
 		err := p.compileType(field.Type(), readerType)
@@ -292,10 +336,12 @@ func (p *irMethod) compileEnum(writer, reader *schema.EnumDefinition) error {
 
 func (p *irMethod) compileFixed(writer, reader *schema.FixedDefinition) error {
 	log("compileFixed()\n writer:\n %v\n---\nreader: %v\n---\n", writer, reader)
-	p.addLiteral(vm.Read, 11+writer.SizeBytes())
-	if reader != nil {
-		p.addLiteral(vm.Set, vm.Bytes)
+	if reader == nil {
+		p.addLiteral(vm.Skip, 11+writer.SizeBytes())
+		return nil
 	}
+	p.addLiteral(vm.Read, 11+writer.SizeBytes())
+	p.addLiteral(vm.Set, vm.Bytes)
 	return nil
 }
 
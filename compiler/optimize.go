@@ -0,0 +1,252 @@
+package compiler
+
+import (
+	"github.com/actgardner/gogen-avro/vm"
+)
+
+// The optimizer is a peephole pass over a compiled program. It replaces the fixed
+// sequences emitted for blocks, switches and fields with superinstructions, then
+// relocates the jumps. A sequence is only replaced if nothing jumps into the middle of it.
+
+// The offsets of the instructions within a block header, see blockStartIRInstruction
+const (
+	blockHeaderLength = 8
+	blockPushLoop     = 7
+)
+
+type optimizer struct {
+	in      []vm.Instruction
+	out     []vm.Instruction
+	targets map[int]bool
+	// The sources of the input and output instructions, if the program has a source map
+	inSources  []vm.Source
+	outSources []vm.Source
+	// The offset in the output of each instruction in the input
+	offsets []int
+	// The offsets in the input of the block headers which were fused
+	blocks map[int]bool
+	// Instructions in the input which were removed with nothing to replace them
+	removed map[int]bool
+}
+
+func optimize(p *vm.Program) *vm.Program {
+	o := &optimizer{
+		in:      p.Instructions,
+		out:     make([]vm.Instruction, 0, len(p.Instructions)),
+		targets: jumpTargets(p.Instructions),
+		offsets: make([]int, len(p.Instructions)+1),
+		blocks:  make(map[int]bool),
+		removed: make(map[int]bool),
+	}
+	if p.Sources != nil {
+		o.inSources = p.Sources
+		o.outSources = make([]vm.Source, 0, len(p.Sources))
+	}
+
+	for pc := 0; pc < len(o.in); {
+		n := o.fuseBlockHeader(pc)
+		if n == 0 {
+			n = o.fuseBlockFooter(pc)
+		}
+		if n == 0 {
+			n = o.fuseSwitch(pc)
+		}
+		if n == 0 {
+			n = o.fuseReadSet(pc)
+		}
+		if n == 0 {
+			n = o.removeEmptyEnter(pc)
+		}
+		if n == 0 {
+			o.emit(pc, 1, o.in[pc])
+			n = 1
+		}
+		pc += n
+	}
+	o.offsets[len(o.in)] = len(o.out)
+
+	// Jumps to removed instructions go to whatever follows them
+	for pc := len(o.in) - 1; pc >= 0; pc-- {
+		if o.removed[pc] {
+			o.offsets[pc] = o.offsets[pc+1]
+		}
+	}
+
+	for i, inst := range o.out {
+		switch inst.Op {
+		case vm.Jump, vm.CondJump, vm.Call, vm.ReadBlock, vm.SkipBlock, vm.EndBlock:
+			o.out[i].Operand = o.offsets[inst.Operand]
+		}
+	}
+
+	var fieldNames map[int]string
+	if p.FieldNames != nil {
+		fieldNames = make(map[int]string)
+		for pc, name := range p.FieldNames {
+			if !o.removed[pc] {
+				fieldNames[o.offsets[pc]] = name
+			}
+		}
+	}
+
+	return &vm.Program{
+		Instructions: o.out,
+		Errors:       p.Errors,
+		Name:         p.Name,
+		FieldNames:   fieldNames,
+		Sources:      o.outSources,
+	}
+}
+
+// The offsets of all the instructions which are the target of a jump or call
+func jumpTargets(instructions []vm.Instruction) map[int]bool {
+	targets := make(map[int]bool)
+	for _, inst := range instructions {
+		switch inst.Op {
+		case vm.Jump, vm.CondJump, vm.Call:
+			targets[inst.Operand] = true
+		}
+	}
+	return targets
+}
+
+// Replace the n instructions starting at pc with the given instructions, which take the source of the first one.
+// Operands which are jump targets are still offsets in the input, and are relocated later.
+func (o *optimizer) emit(pc, n int, instructions ...vm.Instruction) {
+	for i := 0; i < n; i++ {
+		o.offsets[pc+i] = len(o.out)
+	}
+	o.out = append(o.out, instructions...)
+	if o.inSources != nil {
+		for range instructions {
+			o.outSources = append(o.outSources, o.inSources[pc])
+		}
+	}
+}
+
+// Whether the instructions from pc to pc+n-1 match the given instructions
+func (o *optimizer) matches(pc int, expected ...vm.Instruction) bool {
+	if pc+len(expected) > len(o.in) {
+		return false
+	}
+	for i, e := range expected {
+		if o.in[pc+i] != e {
+			return false
+		}
+	}
+	return true
+}
+
+// Whether anything jumps to the instructions from pc to pc+n-1
+func (o *optimizer) isTarget(pc, n int) bool {
+	for i := 0; i < n; i++ {
+		if o.targets[pc+i] {
+			return true
+		}
+	}
+	return false
+}
+
+// Fuse the header of an array or map block into a read_block or skip_block, followed by the push_loop.
+func (o *optimizer) fuseBlockHeader(pc int) int {
+	if pc+blockHeaderLength > len(o.in) || o.isTarget(pc+1, blockPushLoop-1) {
+		return 0
+	}
+
+	end := o.in[pc+2].Operand
+	header := []vm.Instruction{
+		{vm.Read, vm.Long},
+		{vm.EvalEqual, 0},
+		{vm.CondJump, end},
+		{vm.EvalGreater, 0},
+		{vm.CondJump, pc + blockPushLoop},
+		{vm.Read, vm.UnusedLong},
+		{vm.MultLong, -1},
+		{vm.PushLoop, 0},
+	}
+	op := vm.ReadBlock
+	if !o.matches(pc, header...) {
+		header[5] = vm.Instruction{vm.Skip, vm.Bytes}
+		header[6] = vm.Instruction{vm.Jump, pc}
+		op = vm.SkipBlock
+		if !o.matches(pc, header...) {
+			return 0
+		}
+	}
+
+	o.blocks[pc] = true
+	o.emit(pc, blockPushLoop, vm.Instruction{op, end})
+	o.emit(pc+blockPushLoop, 1, o.in[pc+blockPushLoop])
+	return blockHeaderLength
+}
+
+// Fuse the footer of a block, whose header was fused, into an end_block after the pop_loop
+func (o *optimizer) fuseBlockFooter(pc int) int {
+	if pc+5 > len(o.in) || o.in[pc].Op != vm.PopLoop || o.isTarget(pc+1, 4) {
+		return 0
+	}
+
+	start := o.in[pc+3].Operand
+	if !o.blocks[start] || !o.matches(pc+1,
+		vm.Instruction{vm.AddLong, -1},
+		vm.Instruction{vm.EvalEqual, 0},
+		vm.Instruction{vm.CondJump, start},
+		vm.Instruction{vm.Jump, start + blockPushLoop},
+	) {
+		return 0
+	}
+
+	o.emit(pc, 1, o.in[pc])
+	o.emit(pc+1, 4, vm.Instruction{vm.EndBlock, start})
+	return 5
+}
+
+// Replace the chain of comparisons for a union switch with a jump table
+func (o *optimizer) fuseSwitch(pc int) int {
+	size := 0
+	for ; pc+2*size+1 < len(o.in); size++ {
+		if o.in[pc+2*size] != (vm.Instruction{vm.EvalEqual, size}) || o.in[pc+2*size+1].Op != vm.CondJump {
+			break
+		}
+	}
+	length := 2*size + 1
+	if size == 0 || pc+length > len(o.in) || o.in[pc+2*size].Op != vm.Halt || o.isTarget(pc+1, length-1) {
+		return 0
+	}
+
+	table := []vm.Instruction{{vm.JumpTable, size}}
+	for i := 0; i < size; i++ {
+		table = append(table, vm.Instruction{vm.Jump, o.in[pc+2*i+1].Operand})
+	}
+	table = append(table, o.in[pc+2*size])
+	o.emit(pc, length, table...)
+	return length
+}
+
+// Fuse a read followed by a set of the same value
+func (o *optimizer) fuseReadSet(pc int) int {
+	if pc+2 > len(o.in) || o.in[pc].Op != vm.Read || o.in[pc+1].Op != vm.Set || o.isTarget(pc+1, 1) {
+		return 0
+	}
+
+	read, set := o.in[pc].Operand, o.in[pc+1].Operand
+	switch {
+	case read == set && read != vm.UnusedLong:
+	case read > vm.UnusedLong && set == vm.Bytes:
+	default:
+		return 0
+	}
+
+	o.emit(pc, 2, vm.Instruction{vm.ReadSet, read})
+	return 2
+}
+
+// Remove an enter immediately followed by an exit, which does nothing
+func (o *optimizer) removeEmptyEnter(pc int) int {
+	if pc+2 > len(o.in) || o.in[pc].Op != vm.Enter || o.in[pc+1].Op != vm.Exit || o.isTarget(pc+1, 1) {
+		return 0
+	}
+	o.removed[pc] = true
+	o.removed[pc+1] = true
+	return 2
+}
@@ -0,0 +1,259 @@
+package compiler
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/actgardner/gogen-avro/generic"
+	"github.com/actgardner/gogen-avro/schema"
+	"github.com/actgardner/gogen-avro/vm"
+	"github.com/actgardner/gogen-avro/vm/types"
+)
+
+// Every schema in the integration tests, parsed along with the schemas it depends on
+func testSchemas(t testing.TB) map[string]schema.AvroType {
+	files, err := filepath.Glob("../test/*/*.avsc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(files)
+
+	schemas := make(map[string]schema.AvroType)
+	for _, file := range files {
+		ns := schema.NewNamespace(false)
+		// Schemas split across files refer to the types defined in the files before them
+		siblings, _ := filepath.Glob(filepath.Join(filepath.Dir(file), "*.avsc"))
+		sort.Strings(siblings)
+		for _, sibling := range siblings {
+			if sibling == file {
+				break
+			}
+			if s, err := ioutil.ReadFile(sibling); err == nil {
+				ns.TypeForSchema(s)
+			}
+		}
+
+		s, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		avroType, err := ns.TypeForSchema(s)
+		if err != nil {
+			// Evolved schemas redefine the types of the schemas next to them
+			ns = schema.NewNamespace(false)
+			if avroType, err = ns.TypeForSchema(s); err != nil {
+				t.Fatalf("Unable to parse %v: %v", file, err)
+			}
+		}
+		if err := avroType.ResolveReferences(ns); err != nil {
+			t.Fatalf("Unable to resolve %v: %v", file, err)
+		}
+		schemas[file] = avroType
+	}
+	return schemas
+}
+
+func TestOptimizedProgramsMatch(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	for file, avroType := range testSchemas(t) {
+		unoptimized, err := compileUnoptimized(avroType, avroType)
+		if err != nil {
+			t.Fatalf("Unable to compile %v: %v", file, err)
+		}
+		optimized := optimize(unoptimized)
+		if len(optimized.Instructions) >= len(unoptimized.Instructions) {
+			t.Errorf("Expected the optimized program for %v to be shorter:\n%v", file, optimized)
+		}
+
+		for i := 0; i < 50; i++ {
+			var buf bytes.Buffer
+			writeRandom(rnd, &buf, avroType, 0)
+			data := buf.Bytes()
+
+			expected := generic.NewDatum(avroType)
+			if err := vm.EvalBytes(data, unoptimized, expected); err != nil {
+				t.Fatalf("Unable to decode %v with the unoptimized program: %v", file, err)
+			}
+			actual := generic.NewDatum(avroType)
+			if err := vm.EvalBytes(data, optimized, actual); err != nil {
+				t.Fatalf("Unable to decode %v with the optimized program: %v\n%v", file, err, optimized)
+			}
+			if !reflect.DeepEqual(expected.Value(), actual.Value()) {
+				t.Fatalf("Decoding %v: expected %v, got %v", file, expected.Value(), actual.Value())
+			}
+
+			// Truncated data must fail the same way
+			truncated := data[:rnd.Intn(len(data)+1)]
+			expectedErr := vm.EvalBytes(truncated, unoptimized, generic.NewDatum(avroType))
+			actualErr := vm.EvalBytes(truncated, optimized, generic.NewDatum(avroType))
+			if (expectedErr == nil) != (actualErr == nil) {
+				t.Fatalf("Decoding truncated %v: expected %v, got %v", file, expectedErr, actualErr)
+			}
+			if expectedErr, ok := expectedErr.(*vm.EvalError); ok {
+				actualErr := actualErr.(*vm.EvalError)
+				if expectedErr.Path != actualErr.Path || expectedErr.Offset != actualErr.Offset {
+					t.Fatalf("Decoding truncated %v: expected %v, got %v", file, expectedErr, actualErr)
+				}
+			}
+		}
+	}
+}
+
+// Compare the unoptimized and optimized programs decoding every test schema
+func BenchmarkUnoptimized(b *testing.B) {
+	benchmarkPrograms(b, func(t schema.AvroType) (*vm.Program, error) {
+		return compileUnoptimized(t, t)
+	})
+}
+
+func BenchmarkOptimized(b *testing.B) {
+	benchmarkPrograms(b, func(t schema.AvroType) (*vm.Program, error) {
+		return Compile(t, t)
+	})
+}
+
+func benchmarkPrograms(b *testing.B, compile func(schema.AvroType) (*vm.Program, error)) {
+	rnd := rand.New(rand.NewSource(1))
+	schemas := testSchemas(b)
+	files := make([]string, 0, len(schemas))
+	for file := range schemas {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+
+	programs := make([]*vm.Program, len(files))
+	data := make([][]byte, len(files))
+	for i, file := range files {
+		var err error
+		if programs[i], err = compile(schemas[file]); err != nil {
+			b.Fatal(err)
+		}
+		var buf bytes.Buffer
+		writeRandom(rnd, &buf, schemas[file], 0)
+		data[i] = buf.Bytes()
+	}
+
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		for i, program := range programs {
+			if err := vm.EvalBytes(data[i], program, discard{}); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+// Write a random value of type t in the Avro binary encoding.
+// Arrays and maps are written in a random number of blocks, some of them with a byte size.
+func writeRandom(rnd *rand.Rand, buf *bytes.Buffer, t schema.AvroType, depth int) {
+	switch v := t.(type) {
+	case *schema.NullField:
+	case *schema.BoolField:
+		buf.WriteByte(byte(rnd.Intn(2)))
+	case *schema.IntField:
+		writeLong(buf, int64(int32(rnd.Uint32())))
+	case *schema.LongField:
+		writeLong(buf, int64(rnd.Uint64()))
+	case *schema.FloatField:
+		bits := math.Float32bits(rnd.Float32())
+		buf.Write([]byte{byte(bits), byte(bits >> 8), byte(bits >> 16), byte(bits >> 24)})
+	case *schema.DoubleField:
+		bits := math.Float64bits(rnd.NormFloat64())
+		for i := uint(0); i < 64; i += 8 {
+			buf.WriteByte(byte(bits >> i))
+		}
+	case *schema.BytesField, *schema.StringField:
+		writeRandomString(rnd, buf)
+	case *schema.UnionField:
+		// Prefer the first branch when deeply nested, to end recursive schemas
+		index := 0
+		if depth < 4 {
+			index = rnd.Intn(len(v.AvroTypes()))
+		}
+		writeLong(buf, int64(index))
+		writeRandom(rnd, buf, v.AvroTypes()[index], depth+1)
+	case *schema.ArrayField:
+		writeRandomBlocks(rnd, buf, depth, func(item *bytes.Buffer) {
+			writeRandom(rnd, item, v.ItemType(), depth+1)
+		})
+	case *schema.MapField:
+		writeRandomBlocks(rnd, buf, depth, func(item *bytes.Buffer) {
+			writeRandomString(rnd, item)
+			writeRandom(rnd, item, v.ItemType(), depth+1)
+		})
+	case *schema.Reference:
+		switch def := v.Def.(type) {
+		case *schema.RecordDefinition:
+			for _, f := range def.Fields() {
+				writeRandom(rnd, buf, f.Type(), depth+1)
+			}
+		case *schema.EnumDefinition:
+			writeLong(buf, int64(rnd.Intn(len(def.Symbols()))))
+		case *schema.FixedDefinition:
+			for i := 0; i < def.SizeBytes(); i++ {
+				buf.WriteByte(byte(rnd.Intn(256)))
+			}
+		}
+	}
+}
+
+func writeRandomBlocks(rnd *rand.Rand, buf *bytes.Buffer, depth int, writeItem func(*bytes.Buffer)) {
+	blocks := 0
+	if depth < 4 {
+		blocks = rnd.Intn(3)
+	}
+	for i := 0; i < blocks; i++ {
+		count := rnd.Intn(3) + 1
+		var items bytes.Buffer
+		for j := 0; j < count; j++ {
+			writeItem(&items)
+		}
+		if rnd.Intn(2) == 0 {
+			writeLong(buf, int64(count))
+		} else {
+			writeLong(buf, -int64(count))
+			writeLong(buf, int64(items.Len()))
+		}
+		buf.Write(items.Bytes())
+	}
+	writeLong(buf, 0)
+}
+
+func writeRandomString(rnd *rand.Rand, buf *bytes.Buffer) {
+	n := rnd.Intn(8)
+	writeLong(buf, int64(n))
+	for i := 0; i < n; i++ {
+		buf.WriteByte(byte('a' + rnd.Intn(26)))
+	}
+}
+
+func writeLong(buf *bytes.Buffer, v int64) {
+	u := uint64((v << 1) ^ (v >> 63))
+	for u >= 0x80 {
+		buf.WriteByte(byte(u) | 0x80)
+		u >>= 7
+	}
+	buf.WriteByte(byte(u))
+}
+
+// discard is a target which accepts every value, so benchmarks measure the VM rather than the target
+type discard struct{}
+
+func (discard) SetBoolean(v bool) error                   { return nil }
+func (discard) SetInt(v int32) error                      { return nil }
+func (discard) SetLong(v int64) error                     { return nil }
+func (discard) SetFloat(v float32) error                  { return nil }
+func (discard) SetDouble(v float64) error                 { return nil }
+func (discard) SetBytes(v []byte) error                   { return nil }
+func (discard) SetString(v string) error                  { return nil }
+func (discard) Get(i int) (types.Field, error)            { return discard{}, nil }
+func (discard) SetDefault(i int) error                    { return nil }
+func (discard) AppendMap(key string) (types.Field, error) { return discard{}, nil }
+func (discard) AppendArray() (types.Field, error)         { return discard{}, nil }
+func (discard) Finalize()                                 {}
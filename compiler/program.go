@@ -2,6 +2,7 @@ package compiler
 
 import (
 	"fmt"
+	"sort"
 
 	"github.com/actgardner/gogen-avro/vm"
 )
@@ -12,11 +13,13 @@ import (
 // control with jumps to absolute offsets.
 
 type irProgram struct {
-	main     *irMethod
-	methods  map[string]*irMethod
-	blocks   []*irBlock
-	switches []*irSwitch
-	errors   []string
+	name       string
+	main       *irMethod
+	methods    map[string]*irMethod
+	blocks     []*irBlock
+	switches   []*irSwitch
+	errors     []string
+	fieldNames map[int]string
 }
 
 type irBlock struct {
@@ -50,17 +53,28 @@ func (p *irProgram) createMethod(name string) *irMethod {
 // Main ends with a halt(0), everything else ends with a return.
 func (p *irProgram) CompileToVM() (*vm.Program, error) {
 	irProgram := make([]irInstruction, 0)
+	sources := make([]vm.Source, 0)
 	vmLength := 0
 
 	p.main.addLiteral(vm.Halt, 0)
 	vmLength += p.main.VMLength()
 	irProgram = append(irProgram, p.main.body...)
+	sources = p.main.appendSources(sources)
 
-	for _, method := range p.methods {
+	// Lay out the methods in a stable order, so the same schemas always compile to the same program
+	names := make([]string, 0, len(p.methods))
+	for name := range p.methods {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		method := p.methods[name]
 		method.offset = vmLength
 		method.addLiteral(vm.Return, vm.NoopField)
 		vmLength += method.VMLength()
 		irProgram = append(irProgram, method.body...)
+		sources = method.appendSources(sources)
 	}
 
 	p.findOffsets(irProgram)
@@ -77,13 +91,19 @@ func (p *irProgram) CompileToVM() (*vm.Program, error) {
 	return &vm.Program{
 		Instructions: vmProgram,
 		Errors:       p.errors,
+		Name:         p.name,
+		FieldNames:   p.fieldNames,
+		Sources:      sources,
 	}, nil
 }
 
 func (p *irProgram) findOffsets(inst []irInstruction) {
 	offset := 0
+	p.fieldNames = make(map[int]string)
 	for _, instruction := range inst {
 		switch v := instruction.(type) {
+		case *enterIRInstruction:
+			p.fieldNames[offset] = v.name
 		case *blockStartIRInstruction:
 			log("findOffsets() block %v - start %v", v.blockId, offset)
 			p.blocks[v.blockId].start = offset
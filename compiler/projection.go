@@ -0,0 +1,28 @@
+package compiler
+
+import (
+	"github.com/actgardner/gogen-avro/schema"
+	"github.com/actgardner/gogen-avro/vm"
+)
+
+// Given an Avro schema and a list of field paths like `user.address.city` or `items[].sku`,
+// compile a program which reads data written by `writer` and only stores the fields at those
+// paths, skipping everything else. The target must be a struct generated for the projected
+// schema (see schema.Project), or a generic.Datum.
+func CompileProjectionBytes(writer []byte, paths []string) (*vm.Program, error) {
+	writerType, err := parseSchema(writer)
+	if err != nil {
+		return nil, err
+	}
+	return CompileProjection(writerType, paths)
+}
+
+// Given a parsed Avro schema and a list of field paths, compile a program which
+// only stores the fields at those paths.
+func CompileProjection(writer schema.AvroType, paths []string) (*vm.Program, error) {
+	reader, err := schema.Project(writer, paths)
+	if err != nil {
+		return nil, err
+	}
+	return Compile(writer, reader)
+}
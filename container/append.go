@@ -0,0 +1,49 @@
+package container
+
+import (
+	"fmt"
+	"io"
+)
+
+// OpenAppend returns a Writer which appends blocks to an existing container file, like one written with
+// NewWriter, so records can be added without rewriting it. It reads the header from the start of file and
+// returns an error if the file's codec isn't codec, or its schema isn't the same as schema. Schemas are the
+// same if their JSON is equal, ignoring whitespace and the order of object keys. The blocks are written at
+// the end of the file with its sync marker, so the file must end with a complete block.
+//
+// The header can't be changed, so WithMetadata and WithSyncMarker can't be used. You can create a Writer
+// for a given struct by calling the generated method `New<RecordType>AppendWriter`.
+func OpenAppend(file io.ReadWriteSeeker, codec Codec, recordsPerBlock int64, schema string, options ...WriterOption) (*Writer, error) {
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	header, err := ReadHeader(file)
+	if err != nil {
+		return nil, err
+	}
+	if header.Codec != codec {
+		return nil, fmt.Errorf("Unable to append with codec %q to a file with codec %q", codec, header.Codec)
+	}
+	same, err := sameSchema(header.Schema, []byte(schema))
+	if err != nil {
+		return nil, err
+	}
+	if !same {
+		return nil, fmt.Errorf("Unable to append to a file with a different schema: %s", header.Schema)
+	}
+
+	avroWriter, err := newWriter(file, codec, recordsPerBlock, schema, options)
+	if err != nil {
+		return nil, err
+	}
+	if avroWriter.metadata != nil || !avroWriter.randomSync {
+		return nil, fmt.Errorf("Unable to change the header of a file which is appended to")
+	}
+	avroWriter.syncMarker = header.Sync
+
+	if _, err := file.Seek(0, io.SeekEnd); err != nil {
+		return nil, err
+	}
+	avroWriter.start()
+	return avroWriter, nil
+}
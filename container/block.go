@@ -0,0 +1,102 @@
+package container
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+
+	"github.com/actgardner/gogen-avro/container/avro"
+)
+
+// Block is a block of a container file, with its records still encoded and compressed with the file's codec.
+// NumRecords is the number of records in the block and len(RecordBytes) is its compressed size.
+type Block struct {
+	avro.AvroContainerBlock
+	// The offset of the start of the block in the file
+	Offset int64
+
+	// The offset after the end of the block
+	end int64
+}
+
+// NextBlock returns the next block of the file without decompressing or decoding it, or io.EOF after the last block.
+// Records of the current block which weren't read with Read are discarded. Blocks with the wrong sync marker
+// are handled like they are by Read, but blocks aren't decompressed so their checksums aren't verified.
+func (r *Reader) NextBlock() (*Block, error) {
+	r.blockReader = nil
+	var block *Block
+	err := r.nextBlock(func() error {
+		var err error
+		block, err = r.readRawBlock()
+		return err
+	})
+	if err != nil {
+		if err != io.EOF {
+			r.err = err
+		}
+		return nil, err
+	}
+	return block, nil
+}
+
+// WriteBlock writes a block read from another file with Reader.NextBlock, without decoding it.
+// The block is written with this file's sync marker, so the other file must have the same schema and codec.
+// Records already written with WriteRecord are flushed first, so the records stay in order.
+func (avroWriter *Writer) WriteBlock(block *Block) error {
+	if err := avroWriter.Flush(); err != nil {
+		return err
+	}
+	framed := &avro.AvroContainerBlock{
+		NumRecords:  block.NumRecords,
+		RecordBytes: block.RecordBytes,
+		Sync:        avroWriter.syncMarker,
+	}
+	if err := framed.Serialize(avroWriter.writer); err != nil {
+		return avroWriter.fail(err)
+	}
+	return nil
+}
+
+// AppendBlocks writes the remaining blocks of r to this file without decoding them, like WriteBlock.
+// It returns an error before writing anything if r has a different codec or schema. Schemas are the same
+// if their JSON is equal, ignoring whitespace and the order of object keys.
+func (avroWriter *Writer) AppendBlocks(r *Reader) error {
+	if err := avroWriter.check(); err != nil {
+		return err
+	}
+	if r.Codec() != avroWriter.codec {
+		return fmt.Errorf("Unable to append blocks with codec %q to a file with codec %q", r.Codec(), avroWriter.codec)
+	}
+	same, err := sameSchema(r.AvroContainerSchema(), []byte(avroWriter.schema))
+	if err != nil {
+		return err
+	}
+	if !same {
+		return fmt.Errorf("Unable to append blocks with a different schema: %s", r.AvroContainerSchema())
+	}
+
+	for {
+		block, err := r.NextBlock()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := avroWriter.WriteBlock(block); err != nil {
+			return err
+		}
+	}
+}
+
+func sameSchema(a, b []byte) (bool, error) {
+	var aJSON, bJSON interface{}
+	if err := json.Unmarshal(a, &aJSON); err != nil {
+		return false, err
+	}
+	if err := json.Unmarshal(b, &bJSON); err != nil {
+		return false, err
+	}
+	return reflect.DeepEqual(aJSON, bJSON), nil
+}
@@ -0,0 +1,193 @@
+package container
+
+import (
+	"bytes"
+	"compress/bzip2"
+	"compress/flate"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"sync"
+
+	"github.com/golang/snappy"
+
+	"github.com/actgardner/gogen-avro/vm"
+)
+
+// A Codec specifies how the blocks within a container file should be compressed.
+// It's the name written in the avro.codec entry of the file header, the BlockCodec
+// registered for it with RegisterCodec does the compression.
+type Codec string
+
+const (
+	// No compression
+	Null Codec = "null"
+
+	// Deflate compression
+	Deflate Codec = "deflate"
+
+	// Snappy compression
+	Snappy Codec = "snappy"
+
+	// Bzip2 compression, which is only supported for reading
+	Bzip2 Codec = "bzip2"
+
+	// Xz compression, which isn't built in. Register a BlockCodec for it to use it.
+	Xz Codec = "xz"
+
+	// Zstandard compression, which isn't built in. Register a BlockCodec for it to use it.
+	Zstandard Codec = "zstandard"
+)
+
+// A BlockCodec compresses and decompresses the blocks of a container file.
+// It's called from the goroutines reading and writing files, so it must be safe for concurrent use.
+type BlockCodec interface {
+	// Compress appends the compressed form of block to dst and returns the result
+	Compress(dst, block []byte) ([]byte, error)
+
+	// Decompress returns the decompressed form of block. If the codec stores a checksum
+	// with the block and it doesn't match, it should return a *ChecksumError. If max is greater than zero,
+	// blocks which decompress to more than max bytes should be rejected with a *vm.LimitError,
+	// before all of the memory is allocated if possible.
+	Decompress(block []byte, max int64) ([]byte, error)
+}
+
+var codecs = struct {
+	sync.RWMutex
+	m map[Codec]BlockCodec
+}{
+	m: map[Codec]BlockCodec{
+		Null:    nullCodec{},
+		Deflate: NewDeflateCodec(flate.DefaultCompression),
+		Snappy:  snappyCodec{},
+		Bzip2:   bzip2Codec{},
+	},
+}
+
+// RegisterCodec makes a codec available to Readers and Writers, replacing any codec already
+// registered with the same name. Call it before creating Readers or Writers which use it,
+// typically from an init function.
+func RegisterCodec(name Codec, codec BlockCodec) {
+	codecs.Lock()
+	defer codecs.Unlock()
+	codecs.m[name] = codec
+}
+
+// LookupCodec returns the codec registered with name
+func LookupCodec(name Codec) (BlockCodec, bool) {
+	codecs.RLock()
+	defer codecs.RUnlock()
+	codec, ok := codecs.m[name]
+	return codec, ok
+}
+
+type nullCodec struct{}
+
+func (nullCodec) Compress(dst, block []byte) ([]byte, error) {
+	return append(dst, block...), nil
+}
+
+func (nullCodec) Decompress(block []byte, max int64) ([]byte, error) {
+	if err := checkLimit(vm.BytesLengthLimit, max, int64(len(block))); err != nil {
+		return nil, err
+	}
+	return block, nil
+}
+
+type deflateCodec struct {
+	level int
+}
+
+// NewDeflateCodec returns a deflate codec which compresses at the given level, from flate.BestSpeed
+// to flate.BestCompression. Register it for Deflate to change the level for every Writer, or pass
+// WithDeflateLevel to a single Writer.
+func NewDeflateCodec(level int) BlockCodec {
+	return &deflateCodec{level: level}
+}
+
+func (c *deflateCodec) Compress(dst, block []byte) ([]byte, error) {
+	buf := bytes.NewBuffer(dst)
+	writer, err := flate.NewWriter(buf, c.level)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := writer.Write(block); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (c *deflateCodec) Decompress(block []byte, max int64) ([]byte, error) {
+	return readAllWithLimit(flate.NewReader(bytes.NewReader(block)), max)
+}
+
+// Snappy blocks are followed by the big-endian CRC32 of the uncompressed data,
+// which is checked when they're decompressed
+type snappyCodec struct{}
+
+func (snappyCodec) Compress(dst, block []byte) ([]byte, error) {
+	dst = append(dst, snappy.Encode(nil, block)...)
+	var crc [4]byte
+	binary.BigEndian.PutUint32(crc[:], crc32.ChecksumIEEE(block))
+	return append(dst, crc[:]...), nil
+}
+
+func (snappyCodec) Decompress(block []byte, max int64) ([]byte, error) {
+	if len(block) < 4 {
+		return nil, fmt.Errorf("Snappy block too short: %v bytes", len(block))
+	}
+	size, err := snappy.DecodedLen(block[:len(block)-4])
+	if err != nil {
+		return nil, err
+	}
+	if err := checkLimit(vm.BytesLengthLimit, max, int64(size)); err != nil {
+		return nil, err
+	}
+	decoded, err := snappy.Decode(nil, block[:len(block)-4])
+	if err != nil {
+		return nil, err
+	}
+	expected := binary.BigEndian.Uint32(block[len(block)-4:])
+	if actual := crc32.ChecksumIEEE(decoded); actual != expected {
+		return nil, &ChecksumError{Expected: expected, Actual: actual}
+	}
+	return decoded, nil
+}
+
+// The standard library only implements bzip2 decompression
+type bzip2Codec struct{}
+
+func (bzip2Codec) Compress(dst, block []byte) ([]byte, error) {
+	return nil, fmt.Errorf("Codec %q is only supported for reading", Bzip2)
+}
+
+func (bzip2Codec) Decompress(block []byte, max int64) ([]byte, error) {
+	return readAllWithLimit(bzip2.NewReader(bytes.NewReader(block)), max)
+}
+
+// Read all of r, failing with a LimitError as soon as it's more than max bytes long
+func readAllWithLimit(r io.Reader, max int64) ([]byte, error) {
+	if max <= 0 {
+		return ioutil.ReadAll(r)
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(r, max+1))
+	if err != nil {
+		return nil, err
+	}
+	if err := checkLimit(vm.BytesLengthLimit, max, int64(len(data))); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func checkLimit(kind vm.LimitKind, max, value int64) error {
+	if max > 0 && value > max {
+		return &vm.LimitError{Kind: kind, Max: max, Value: value}
+	}
+	return nil
+}
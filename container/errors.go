@@ -0,0 +1,99 @@
+package container
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrClosed is returned when a reader is used after it's closed
+var ErrClosed = errors.New("Container reader is closed")
+
+// ErrWriterClosed is returned when a Writer is used after it's closed
+var ErrWriterClosed = errors.New("Container writer is closed")
+
+// The problem found in the header of a container file
+type HeaderErrorKind int
+
+const (
+	// The header couldn't be read, see HeaderError.Err
+	UnreadableHeader HeaderErrorKind = iota
+	// The file doesn't start with the OCF magic bytes
+	InvalidMagic
+	// The metadata has no avro.schema entry
+	MissingSchema
+	// The metadata has no avro.codec entry
+	MissingCodec
+	// No BlockCodec is registered for the codec, see HeaderError.Codec
+	UnknownCodec
+)
+
+func (k HeaderErrorKind) String() string {
+	switch k {
+	case UnreadableHeader:
+		return "unreadable header"
+	case InvalidMagic:
+		return "invalid magic"
+	case MissingSchema:
+		return "missing avro.schema"
+	case MissingCodec:
+		return "missing avro.codec"
+	case UnknownCodec:
+		return "unknown codec"
+	}
+	return "Unknown"
+}
+
+// HeaderError is returned when a Reader is created for input which doesn't start with a valid OCF header
+type HeaderError struct {
+	Kind HeaderErrorKind
+	// The magic bytes found at the start of the input, for InvalidMagic
+	Magic [4]byte
+	// The codec named in the header, for UnknownCodec
+	Codec Codec
+	// The underlying error, for UnreadableHeader
+	Err error
+}
+
+func (e *HeaderError) Error() string {
+	switch e.Kind {
+	case UnreadableHeader:
+		return fmt.Sprintf("Invalid OCF header: %v: %v", e.Kind, e.Err)
+	case InvalidMagic:
+		return fmt.Sprintf("Invalid OCF header: %v %q", e.Kind, e.Magic[:])
+	case UnknownCodec:
+		return fmt.Sprintf("Invalid OCF header: %v %q", e.Kind, e.Codec)
+	}
+	return fmt.Sprintf("Invalid OCF header: %v", e.Kind)
+}
+
+func (e *HeaderError) Unwrap() error {
+	return e.Err
+}
+
+// BlockError is returned when a block of a container file fails its integrity checks
+type BlockError struct {
+	// The offset of the start of the block in the file
+	Offset int64
+	// The number of records in the block, according to its header
+	Records int64
+	// The underlying error, like a *ChecksumError
+	Err error
+}
+
+func (e *BlockError) Error() string {
+	return fmt.Sprintf("Corrupt OCF block at offset %v: %v", e.Offset, e.Err)
+}
+
+func (e *BlockError) Unwrap() error {
+	return e.Err
+}
+
+// ChecksumError is returned by codecs when the checksum stored with a block doesn't match its contents
+type ChecksumError struct {
+	Expected uint32
+	Actual   uint32
+}
+
+func (e *ChecksumError) Error() string {
+	return fmt.Sprintf("Checksum mismatch: expected %08x, got %08x", e.Expected, e.Actual)
+}
@@ -0,0 +1,68 @@
+package container
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/actgardner/gogen-avro/container/avro"
+)
+
+// Header is the header at the start of a container file
+type Header struct {
+	Codec Codec
+	// The schema of the records in the file
+	Schema []byte
+	// The metadata, including the avro.schema and avro.codec entries
+	Metadata map[string][]byte
+	// The sync marker written after each block
+	Sync [16]byte
+	// The size of the header, which is the offset of the first block
+	Size int64
+
+	blockCodec BlockCodec
+}
+
+// ReadHeader reads the header of a container file from r. If r doesn't start with a valid header,
+// it returns a *HeaderError.
+func ReadHeader(r io.Reader) (*Header, error) {
+	input := &countingReader{r: r}
+	// Check the magic bytes before the rest of the header, which might not be a header at all
+	var fileMagic avro.Magic
+	if _, err := io.ReadFull(input, fileMagic[:]); err != nil {
+		return nil, &HeaderError{Kind: UnreadableHeader, Err: err}
+	}
+	if fileMagic != magic {
+		return nil, &HeaderError{Kind: InvalidMagic, Magic: fileMagic}
+	}
+
+	header, err := avro.DeserializeAvroContainerHeader(io.MultiReader(bytes.NewReader(fileMagic[:]), input))
+	if err != nil {
+		return nil, &HeaderError{Kind: UnreadableHeader, Err: err}
+	}
+
+	schemaBytes, ok := header.Meta["avro.schema"]
+	if !ok {
+		return nil, &HeaderError{Kind: MissingSchema}
+	}
+	log("Got OCF schema from header: %v", string(schemaBytes))
+
+	codec, ok := header.Meta["avro.codec"]
+	if !ok {
+		return nil, &HeaderError{Kind: MissingCodec}
+	}
+	log("Got OCF codec from header: %v", string(codec))
+
+	blockCodec, ok := LookupCodec(Codec(codec))
+	if !ok {
+		return nil, &HeaderError{Kind: UnknownCodec, Codec: Codec(codec)}
+	}
+
+	return &Header{
+		Codec:      Codec(codec),
+		Schema:     schemaBytes,
+		Metadata:   header.Meta,
+		Sync:       header.Sync,
+		Size:       input.offset,
+		blockCodec: blockCodec,
+	}, nil
+}
@@ -0,0 +1,222 @@
+package container
+
+import (
+	"sync"
+
+	"github.com/actgardner/gogen-avro/vm"
+)
+
+// WithParallelism makes readers of records, like the generated `<RecordType>Reader`, decompress and decode
+// up to n blocks ahead on n worker goroutines with a ParallelReader. Records are still returned in the order
+// they're in the file. The generated reader must then be closed to stop the workers if it isn't read to the end.
+func WithParallelism(n int) ReaderOption {
+	return func(r *Reader) {
+		r.parallelism = n
+	}
+}
+
+// A BlockDecoder decodes the records of a decompressed block, which holds the given number of records.
+// It's called on the worker goroutines of a ParallelReader, so it must be safe for concurrent use.
+type BlockDecoder func(block []byte, records int64) (interface{}, error)
+
+// ParallelReader reads the blocks of a Reader, and decompresses and decodes them on worker goroutines.
+// At most n blocks are read ahead of the one returned by Next, which bounds the memory used.
+//
+// Blocks which can't be decompressed or decoded are passed to the Reader's WithCorruptBlockHandler and
+// WithRecovery handlers, if it has them. Since a block is decoded all at once, a block with a record which
+// can't be decoded is skipped as a whole. The handlers are called from Next, in the order of the blocks.
+type ParallelReader struct {
+	r      *Reader
+	decode BlockDecoder
+	// The Reader's handlers, which are called from Next in the order of the blocks
+	onCorruptBlock func(*BlockError) error
+	onSkip         func(*SkippedRange) error
+	// The blocks in the order they're in the file, which the workers fill in
+	results chan *parallelBlock
+	jobs    chan *parallelBlock
+	done    chan struct{}
+	closed  sync.Once
+	wg      sync.WaitGroup
+	err     error
+}
+
+type parallelBlock struct {
+	block   *Block
+	records interface{}
+	err     error
+	// A block or range skipped by the Reader while reading blocks, to be reported in order
+	corrupt *BlockError
+	skipped *SkippedRange
+	// Closed once records or err is set
+	ready chan struct{}
+}
+
+// NewParallelReader starts reading the blocks of r ahead, decoding them with decode on n worker goroutines.
+// Call Close to stop the goroutines if the blocks aren't read to the end. r must not be used while the
+// ParallelReader is.
+func NewParallelReader(r *Reader, n int, decode BlockDecoder) *ParallelReader {
+	if n < 1 {
+		n = 1
+	}
+	p := &ParallelReader{
+		r:       r,
+		decode:  decode,
+		results: make(chan *parallelBlock, n),
+		jobs:    make(chan *parallelBlock, n),
+		done:    make(chan struct{}),
+	}
+
+	// The Reader calls its handlers on the goroutine reading blocks, so queue what it reports with the blocks
+	p.onCorruptBlock, p.onSkip = r.onCorruptBlock, r.onSkip
+	if r.onCorruptBlock != nil {
+		r.onCorruptBlock = func(err *BlockError) error {
+			return p.report(&parallelBlock{corrupt: err})
+		}
+	}
+	if r.onSkip != nil {
+		r.onSkip = func(skipped *SkippedRange) error {
+			return p.report(&parallelBlock{skipped: skipped})
+		}
+	}
+
+	p.wg.Add(n + 1)
+	go p.readBlocks()
+	for i := 0; i < n; i++ {
+		go p.work()
+	}
+	return p
+}
+
+// Next returns the records of the next block, as returned by the BlockDecoder, or io.EOF after the last block
+func (p *ParallelReader) Next() (interface{}, error) {
+	for p.err == nil {
+		select {
+		case <-p.done:
+			p.err = ErrClosed
+			return nil, p.err
+		default:
+		}
+
+		result, ok := <-p.results
+		if !ok {
+			p.err = ErrClosed
+			break
+		}
+		<-result.ready
+		if result.corrupt != nil {
+			p.err = p.onCorruptBlock(result.corrupt)
+			continue
+		}
+		if result.skipped != nil {
+			p.err = p.onSkip(result.skipped)
+			continue
+		}
+		if result.err == nil {
+			return result.records, nil
+		}
+		if result.block == nil || result.err == ErrClosed {
+			// Reading the block failed, the file ended or the reader was closed
+			p.err = result.err
+			break
+		}
+		if err := p.skip(result); err != nil {
+			p.err = err
+		}
+	}
+	return nil, p.err
+}
+
+// Close stops the goroutines reading and decoding blocks, waiting for the blocks they're working on.
+// Next returns ErrClosed afterwards. Close doesn't close the io.Reader the blocks are read from.
+func (p *ParallelReader) Close() error {
+	p.closed.Do(func() {
+		close(p.done)
+	})
+	p.wg.Wait()
+	return nil
+}
+
+// Queue a block or range skipped by the Reader
+func (p *ParallelReader) report(result *parallelBlock) error {
+	result.ready = make(chan struct{})
+	close(result.ready)
+	select {
+	case p.results <- result:
+		return nil
+	case <-p.done:
+		return ErrClosed
+	}
+}
+
+func (p *ParallelReader) readBlocks() {
+	defer p.wg.Done()
+	defer close(p.jobs)
+	defer close(p.results)
+
+	for {
+		block, err := p.r.NextBlock()
+		result := &parallelBlock{block: block, err: err, ready: make(chan struct{})}
+		if err != nil {
+			close(result.ready)
+		}
+		select {
+		case p.results <- result:
+		case <-p.done:
+			return
+		}
+		if err != nil {
+			return
+		}
+		select {
+		case p.jobs <- result:
+		case <-p.done:
+			result.err = ErrClosed
+			close(result.ready)
+			return
+		}
+	}
+}
+
+func (p *ParallelReader) work() {
+	defer p.wg.Done()
+	for result := range p.jobs {
+		select {
+		case <-p.done:
+			// Skip the remaining blocks after Close
+			result.err = ErrClosed
+		default:
+			result.records, result.err = p.decodeBlock(result.block)
+		}
+		close(result.ready)
+	}
+}
+
+func (p *ParallelReader) decodeBlock(block *Block) (interface{}, error) {
+	data, err := p.r.blockCodec.Decompress(block.RecordBytes, p.r.limits.MaxBytesLength)
+	if err != nil {
+		if _, ok := err.(*vm.LimitError); ok {
+			return nil, err
+		}
+		return nil, &BlockError{Offset: block.Offset, Records: block.NumRecords, Err: err}
+	}
+	if err := checkLimit(vm.BytesLengthLimit, p.r.limits.MaxBytesLength, int64(len(data))); err != nil {
+		return nil, err
+	}
+	return p.decode(data, block.NumRecords)
+}
+
+// Pass a block which couldn't be decompressed or decoded to the Reader's handlers
+func (p *ParallelReader) skip(result *parallelBlock) error {
+	if blockErr, ok := result.err.(*BlockError); ok && p.onCorruptBlock != nil {
+		return p.onCorruptBlock(blockErr)
+	}
+	if p.onSkip != nil {
+		return p.onSkip(&SkippedRange{
+			Start:   result.block.Offset,
+			End:     result.block.end,
+			Records: result.block.NumRecords,
+			Err:     result.err,
+		})
+	}
+	return result.err
+}
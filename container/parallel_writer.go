@@ -0,0 +1,139 @@
+package container
+
+import (
+	"bytes"
+	"sync"
+
+	"github.com/actgardner/gogen-avro/container/avro"
+)
+
+// WithCompressionWorkers makes the Writer compress full blocks on n worker goroutines, so WriteRecord
+// can keep filling the next block while earlier ones are compressed. Blocks are written in order by
+// another goroutine, and the output is the same as without the option. At most n blocks are waiting
+// to be compressed or written at a time: WriteRecord blocks until one is written once the limit is reached.
+// Flush waits for all of the blocks to be written. Close must be called to stop the goroutines.
+func WithCompressionWorkers(n int) WriterOption {
+	return func(w *Writer) {
+		w.compressionWorkers = n
+	}
+}
+
+// A block waiting to be compressed and written
+type compressionJob struct {
+	records    int64
+	block      *bytes.Buffer
+	compressed []byte
+	err        error
+	// Closed once compressed or err is set
+	ready chan struct{}
+}
+
+// The goroutines compressing and writing the blocks of a Writer
+type compressor struct {
+	w *Writer
+	// The blocks in the order they're written, and the blocks to compress
+	pending chan *compressionJob
+	jobs    chan *compressionJob
+	// Uncompressed block buffers which have been written, to reuse
+	free        chan *bytes.Buffer
+	outstanding sync.WaitGroup
+	running     sync.WaitGroup
+
+	lock sync.Mutex
+	err  error
+}
+
+func newCompressor(w *Writer, n int) *compressor {
+	c := &compressor{
+		w:       w,
+		pending: make(chan *compressionJob, n),
+		jobs:    make(chan *compressionJob, n),
+		free:    make(chan *bytes.Buffer, n+1),
+	}
+	c.running.Add(n + 1)
+	go c.writeBlocks()
+	for i := 0; i < n; i++ {
+		go c.work()
+	}
+	return c
+}
+
+// Queue a block to be compressed and written, waiting if too many blocks are already queued
+func (c *compressor) submit(records int64, block *bytes.Buffer) {
+	job := &compressionJob{records: records, block: block, ready: make(chan struct{})}
+	c.outstanding.Add(1)
+	c.pending <- job
+	c.jobs <- job
+}
+
+// Return an empty buffer for the next block
+func (c *compressor) buffer() *bytes.Buffer {
+	select {
+	case buf := <-c.free:
+		buf.Reset()
+		return buf
+	default:
+		return &bytes.Buffer{}
+	}
+}
+
+// Wait until every block queued has been written, and return the first error compressing or writing one
+func (c *compressor) wait() error {
+	c.outstanding.Wait()
+	return c.error()
+}
+
+func (c *compressor) error() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.err
+}
+
+func (c *compressor) fail(err error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.err == nil {
+		c.err = err
+	}
+}
+
+// Stop the goroutines, after the blocks already queued are written
+func (c *compressor) close() error {
+	close(c.jobs)
+	close(c.pending)
+	c.running.Wait()
+	return c.error()
+}
+
+func (c *compressor) work() {
+	defer c.running.Done()
+	for job := range c.jobs {
+		job.compressed, job.err = c.w.blockCodec.Compress(nil, job.block.Bytes())
+		close(job.ready)
+	}
+}
+
+func (c *compressor) writeBlocks() {
+	defer c.running.Done()
+	for job := range c.pending {
+		<-job.ready
+		if job.err != nil {
+			c.fail(job.err)
+		} else if c.error() == nil {
+			// Blocks after one which failed aren't written, so the file doesn't have a gap
+			block := &avro.AvroContainerBlock{
+				NumRecords:  job.records,
+				RecordBytes: job.compressed,
+				Sync:        c.w.syncMarker,
+			}
+			if err := block.Serialize(c.w.writer); err != nil {
+				c.fail(err)
+			}
+		}
+		select {
+		case c.free <- job.block:
+		default:
+		}
+		c.outstanding.Done()
+	}
+}
@@ -2,121 +2,375 @@ package container
 
 import (
 	"bytes"
-	"compress/flate"
+	"errors"
 	"fmt"
 	"io"
-
-	"github.com/golang/snappy"
+	"io/ioutil"
 
 	"github.com/actgardner/gogen-avro/container/avro"
 	"github.com/actgardner/gogen-avro/schema"
+	"github.com/actgardner/gogen-avro/vm"
 )
 
 // Reader is a low-level primitive for reading the OCF framing of a file.
 // Generally you can create a Reader using the `New<RecordType>Reader` method generate for every record type.
 type Reader struct {
-	codec            Codec
-	reader           io.Reader
-	compressedReader io.Reader
-	schemaBytes      []byte
-	schema           schema.AvroType
-	sync             avro.Sync
+	codec       Codec
+	blockCodec  BlockCodec
+	reader      *countingReader
+	blockReader io.Reader
+	schemaBytes []byte
+	metadata    map[string][]byte
+	schema      schema.AvroType
+	sync        avro.Sync
+	limits      vm.Limits
+	// Called with blocks which fail their integrity checks, see WithCorruptBlockHandler
+	onCorruptBlock func(*BlockError) error
+	// Called with the ranges skipped in recovery mode, see WithRecovery
+	onSkip func(*SkippedRange) error
+	// The error Read returned, which isn't recovered from
+	err error
+	// The number of blocks to decompress and decode ahead, see WithParallelism
+	parallelism int
+	// For a split reader, the offset which the sync marker before a block must start before,
+	// see NewSplitReader. Zero if the Reader isn't split.
+	splitEnd int64
+
+	// The offsets and record count of the current block
+	blockStart   int64
+	blockEnd     int64
+	blockRecords int64
+	// The number of blocks opened to read records from, so readers of records can tell when a new one starts
+	blocksOpened int64
+	// Whether readers of records call StartRecord, and whether the current record hasn't been read from yet
+	recordBoundaries bool
+	recordStart      bool
+	// The size and record count of the blocks read so far, to estimate the records in a skipped range
+	goodBytes   int64
+	goodRecords int64
 }
 
-func NewReader(r io.Reader) (*Reader, error) {
-	header, err := avro.DeserializeAvroContainerHeader(r)
-	if err != nil {
-		return nil, err
+// A ReaderOption configures a Reader created with NewReader
+type ReaderOption func(*Reader)
+
+// WithLimits makes the Reader reject blocks with more records than limits.MaxBlockItems,
+// or more bytes (compressed or uncompressed) than limits.MaxBytesLength.
+func WithLimits(limits vm.Limits) ReaderOption {
+	return func(r *Reader) {
+		r.limits = limits
 	}
+}
 
-	if bytes.Equal(header.Magic[:], []byte{'o', 'b', 'j', 1}) {
-		return nil, fmt.Errorf("Unexpected magic in header - %v", header.Magic)
+// WithCorruptBlockHandler sets a function which is called when a block fails its integrity checks:
+// the sync marker after it is wrong, it can't be decompressed or its checksum doesn't match.
+// If the function returns nil the block is skipped and reading continues with the next one,
+// otherwise Read returns its error. Without a handler Read returns the *BlockError.
+func WithCorruptBlockHandler(handler func(*BlockError) error) ReaderOption {
+	return func(r *Reader) {
+		r.onCorruptBlock = handler
 	}
+}
 
-	schemaBytes, ok := header.Meta["avro.schema"]
-	if !ok {
-		return nil, fmt.Errorf("Expected avro.schema in header, not specified in metadata map - %v", header.Meta)
+// NewReader reads the header of a container file from r, and returns a Reader for the records in its blocks.
+// If r doesn't start with a valid header, it returns a *HeaderError.
+func NewReader(r io.Reader, options ...ReaderOption) (*Reader, error) {
+	input := &countingReader{r: r}
+	header, err := ReadHeader(input)
+	if err != nil {
+		return nil, err
 	}
-	log("Got OCF schema from header: %v", string(schemaBytes))
+	return newReader(header, input, options), nil
+}
 
-	codec, ok := header.Meta["avro.codec"]
-	if !ok {
-		return nil, fmt.Errorf("Expected avro.codec in header, not specified in metadata map - %v", header.Meta)
+func newReader(header *Header, input *countingReader, options []ReaderOption) *Reader {
+	reader := &Reader{
+		codec:       header.Codec,
+		blockCodec:  header.blockCodec,
+		reader:      input,
+		schemaBytes: header.Schema,
+		metadata:    header.Metadata,
+		blockReader: nil,
+		schema:      nil,
+		sync:        header.Sync,
 	}
-	log("Got OCF codec from header: %v", string(codec))
+	for _, option := range options {
+		option(reader)
+	}
+	return reader
+}
 
-	return &Reader{
-		codec:            Codec(codec),
-		reader:           r,
-		schemaBytes:      schemaBytes,
-		compressedReader: nil,
-		schema:           nil,
-		sync:             header.Sync,
-	}, nil
+// NewReaderWithLimits creates a Reader which rejects blocks with more records than limits.MaxBlockItems,
+// or more bytes (compressed or uncompressed) than limits.MaxBytesLength.
+func NewReaderWithLimits(r io.Reader, limits vm.Limits) (*Reader, error) {
+	return NewReader(r, WithLimits(limits))
 }
 
 func (r *Reader) AvroContainerSchema() []byte {
 	return r.schemaBytes
 }
 
+// Metadata returns the metadata in the file header, including the avro.schema and avro.codec entries.
+// The map is shared with the Reader and must not be modified.
+func (r *Reader) Metadata() map[string][]byte {
+	return r.metadata
+}
+
+// Codec returns the codec the blocks of the file are compressed with
+func (r *Reader) Codec() Codec {
+	return r.codec
+}
+
+// Limits returns the limits the Reader was created with
+func (r *Reader) Limits() vm.Limits {
+	return r.limits
+}
+
+// Parallelism returns the number of blocks to decode ahead set with WithParallelism, or zero
+func (r *Reader) Parallelism() int {
+	return r.parallelism
+}
+
+// Returned by read when a record runs past the end of its block
+var errBlockOverrun = errors.New("Record overruns the end of its block")
+
 func (r *Reader) Read(b []byte) (n int, err error) {
-	if r.compressedReader == nil {
+	n, err = r.read(b)
+	if err == errBlockOverrun {
+		// The record is damaged rather than the file, so Recover can skip the rest of the block
+		return n, io.ErrUnexpectedEOF
+	}
+	if err != nil && err != io.EOF {
+		r.err = err
+	}
+	return n, err
+}
+
+// StartRecord is called by readers of records, like the generated `<RecordType>Reader`, before decoding
+// each record. Records can't span blocks, so once it's been called the next block is only opened for a
+// new record, and Read returns io.ErrUnexpectedEOF when a record runs past the end of its block.
+// Without it the blocks are read as one stream.
+func (r *Reader) StartRecord() {
+	r.recordBoundaries = true
+	r.recordStart = true
+}
+
+func (r *Reader) read(b []byte) (n int, err error) {
+	for {
+		if r.blockReader != nil {
+			n, err := r.blockReader.Read(b)
+			log("OCF container read: %v %v", n, err)
+			if n > 0 {
+				r.recordStart = false
+				return n, nil
+			}
+			if err != io.EOF {
+				return n, err
+			}
+			if r.recordBoundaries && !r.recordStart {
+				return 0, errBlockOverrun
+			}
+		}
+
 		log("OCF reader opening new block")
-		if err := r.openBlock(); err != nil {
+		if err := r.nextBlock(r.openBlock); err != nil {
 			return 0, err
 		}
 	}
+}
 
+// Open the next block with open, skipping corrupt blocks and resyncing if there are handlers which allow it
+func (r *Reader) nextBlock(open func() error) error {
 	for {
-		n, err := r.compressedReader.Read(b)
-		log("OCF container read: %v %v", n, err)
-		if n > 0 {
-			return n, nil
+		start := r.reader.offset
+		if r.splitEnd != 0 && start-int64(len(r.sync)) >= r.splitEnd {
+			return io.EOF
+		}
+		r.reader.recording = r.onSkip != nil
+		r.reader.recorded = r.reader.recorded[:0]
+
+		err := open()
+		if err == nil || err == io.EOF {
+			return err
 		}
 
-		if err == io.EOF {
-			log("OCF EOF, opening new block")
-			if err := r.openBlock(); err != nil {
-				return 0, err
+		if blockErr, ok := err.(*BlockError); ok && r.onCorruptBlock != nil {
+			log("OCF skipping corrupt block: %v", blockErr)
+			if err := r.onCorruptBlock(blockErr); err != nil {
+				return err
 			}
 			continue
 		}
-		return n, err
+
+		// Errors reading the input can't be recovered from
+		if r.onSkip == nil || r.reader.err != nil {
+			return err
+		}
+		log("OCF resyncing after: %v", err)
+		if err := r.resync(start, err); err != nil {
+			return err
+		}
 	}
 }
 
 func (r *Reader) openBlock() error {
-	header, err := avro.DeserializeAvroContainerBlock(r.reader)
+	raw, err := r.readRawBlock()
 	if err != nil {
 		return err
 	}
 
+	block, err := r.blockCodec.Decompress(raw.RecordBytes, r.limits.MaxBytesLength)
+	if err != nil {
+		if _, ok := err.(*vm.LimitError); ok {
+			return err
+		}
+		return &BlockError{Offset: raw.Offset, Records: raw.NumRecords, Err: err}
+	}
+	if err := checkLimit(vm.BytesLengthLimit, r.limits.MaxBytesLength, int64(len(block))); err != nil {
+		return err
+	}
+	r.blockReader = bytes.NewBuffer(block)
+	r.blocksOpened += 1
+	return nil
+}
+
+// Read the next block and check its sync marker, without decompressing it
+func (r *Reader) readRawBlock() (*Block, error) {
+	offset := r.reader.offset
+	header, err := r.readBlock()
+	if err != nil {
+		return nil, err
+	}
+
 	log("OCF block size: %v", len(header.RecordBytes))
 	if header.Sync != r.sync {
-		return fmt.Errorf("Unexpected sync marker %q, expected %q", header.Sync, r.sync)
-	}
-
-	blockBuffer := bytes.NewBuffer(header.RecordBytes)
-
-	switch r.codec {
-	case Null:
-		r.compressedReader = blockBuffer
-		break
-	case Deflate:
-		r.compressedReader = flate.NewReader(blockBuffer)
-		break
-	case Snappy:
-		// TODO: Check the last 4 bytes are the big-endian CRC of the compressed Snappy block
-		dst := make([]byte, 0, 0)
-		dst, err := snappy.Decode(nil, header.RecordBytes[:len(header.RecordBytes)-4])
-		if err != nil {
-			return err
+		return nil, &BlockError{
+			Offset:  offset,
+			Records: header.NumRecords,
+			Err:     fmt.Errorf("Unexpected sync marker %q, expected %q", header.Sync, r.sync),
 		}
-		r.compressedReader = bytes.NewBuffer(dst)
-		break
-	default:
-		return fmt.Errorf("Unexpected codec %q", r.codec)
 	}
 
-	return nil
+	// The framing is intact, so the block can be used to estimate the records in skipped ranges
+	r.blockStart = offset
+	r.blockEnd = r.reader.offset
+	r.blockRecords = header.NumRecords
+	r.goodBytes += r.blockEnd - r.blockStart
+	r.goodRecords += header.NumRecords
+	return &Block{AvroContainerBlock: *header, Offset: offset, end: r.blockEnd}, nil
+}
+
+// Read the framing of the next block, checking the record count and size against
+// the limits before allocating the block
+func (r *Reader) readBlock() (*avro.AvroContainerBlock, error) {
+	block := &avro.AvroContainerBlock{}
+
+	var err error
+	block.NumRecords, err = readLong(r.reader)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkLimit(vm.BlockItemsLimit, r.limits.MaxBlockItems, block.NumRecords); err != nil {
+		return nil, err
+	}
+
+	size, err := readLong(r.reader)
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	if size < 0 {
+		return nil, fmt.Errorf("Invalid block size %v", size)
+	}
+	if err := checkLimit(vm.BytesLengthLimit, r.limits.MaxBytesLength, size); err != nil {
+		return nil, err
+	}
+
+	block.RecordBytes, err = readBlockBytes(r.reader, size)
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	if _, err := io.ReadFull(r.reader, block.Sync[:]); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	return block, nil
+}
+
+func readLong(r io.Reader) (int64, error) {
+	var buf [1]byte
+	var v uint64
+	for shift := uint(0); shift < 64; shift += 7 {
+		if _, err := io.ReadFull(r, buf[:]); err != nil {
+			if err == io.EOF && shift > 0 {
+				return 0, io.ErrUnexpectedEOF
+			}
+			return 0, err
+		}
+		v |= uint64(buf[0]&127) << shift
+		if buf[0]&128 == 0 {
+			return int64(v>>1) ^ -int64(v&1), nil
+		}
+	}
+	return 0, fmt.Errorf("Invalid varint: too long")
+}
+
+// Read the records of a block. Large blocks are read incrementally, so a corrupt size
+// doesn't allocate more memory than the rest of the file.
+func readBlockBytes(r io.Reader, size int64) ([]byte, error) {
+	if size <= 1<<20 {
+		b := make([]byte, size)
+		_, err := io.ReadFull(r, b)
+		return b, err
+	}
+	b, err := ioutil.ReadAll(io.LimitReader(r, size))
+	if err == nil && int64(len(b)) < size {
+		err = io.ErrUnexpectedEOF
+	}
+	return b, err
+}
+
+// A reader which counts the bytes read, to find the offset of each block in the file.
+// In recovery mode it also keeps the bytes of the current block, so they can be scanned
+// for the next sync marker, and bytes which were scanned past can be read again.
+type countingReader struct {
+	r      io.Reader
+	offset int64
+	// The last error returned by r, other than io.EOF
+	err error
+
+	recording bool
+	recorded  []byte
+	// Bytes to be read again before r
+	pending []byte
+}
+
+func (c *countingReader) Read(b []byte) (int, error) {
+	var n int
+	var err error
+	if len(c.pending) > 0 {
+		n = copy(b, c.pending)
+		c.pending = c.pending[n:]
+	} else {
+		n, err = c.r.Read(b)
+		if err != nil && err != io.EOF {
+			c.err = err
+		}
+	}
+	c.offset += int64(n)
+	if c.recording {
+		c.recorded = append(c.recorded, b[:n]...)
+	}
+	return n, err
+}
+
+// Push bytes back to be read again
+func (c *countingReader) unread(b []byte) {
+	c.pending = append(append([]byte{}, b...), c.pending...)
+	c.offset -= int64(len(b))
+}
+
+// A block which ends part way through is truncated, not the end of the file
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
 }
@@ -0,0 +1,114 @@
+package container
+
+import (
+	"io"
+
+	"github.com/actgardner/gogen-avro/compiler"
+	"github.com/actgardner/gogen-avro/vm"
+	"github.com/actgardner/gogen-avro/vm/types"
+)
+
+// RecordReader reads the records of a container file into types.Field values, without a generated reader.
+// The program decoding them is compiled from the schema in the file's header when the RecordReader is created,
+// so the reader schema can be chosen at runtime. Records can be the structs generated for the reader schema,
+// or dynamic records like generic.Datum:
+//
+//	records, err := container.NewRecordReader(reader, readerSchema, func() types.Field {
+//		return generic.NewDatum(readerType)
+//	})
+//	for records.Next() {
+//		value := records.Record().(*generic.Datum).Value()
+//	}
+//	if err := records.Err(); err != nil {
+//		...
+//	}
+//
+// Records are decoded as they're read, WithParallelism only applies to generated readers.
+type RecordReader struct {
+	r       *Reader
+	program *vm.Program
+	opts    vm.Options
+	factory func() types.Field
+
+	record      types.Field
+	blockOffset int64
+	// The number of blocks the Reader had opened when the last record was read
+	block int64
+	index int64
+	err   error
+}
+
+// NewRecordReader creates a RecordReader for the records of r, decoding each one into a record returned by factory.
+// If readerSchema is nil records are decoded with the file's schema, otherwise the file's schema must be
+// compatible with it.
+func NewRecordReader(r *Reader, readerSchema []byte, factory func() types.Field) (*RecordReader, error) {
+	writerSchema := r.AvroContainerSchema()
+	if readerSchema == nil {
+		readerSchema = writerSchema
+	}
+	program, err := compiler.CompileSchemaBytes(writerSchema, readerSchema)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RecordReader{
+		r:           r,
+		program:     program,
+		opts:        vm.Options{ReuseBuffers: true, Limits: r.Limits()},
+		factory:     factory,
+		blockOffset: -1,
+	}, nil
+}
+
+// Next reads the next record, which is returned by Record. It returns false at the end of the file or
+// after an error, which is returned by Err. In recovery mode blocks with records which can't be decoded
+// are skipped, like they are by generated readers.
+func (r *RecordReader) Next() bool {
+	r.record = nil
+	for r.err == nil {
+		record := r.factory()
+		r.r.StartRecord()
+		err := vm.EvalWithOptions(r.r, r.program, record, &r.opts)
+		if err == nil {
+			if r.r.blocksOpened != r.block {
+				r.block = r.r.blocksOpened
+				r.blockOffset = r.r.blockStart
+				r.index = 0
+			} else {
+				r.index++
+			}
+			r.record = record
+			return true
+		}
+		if err == io.EOF {
+			r.err = err
+			break
+		}
+		r.err = r.r.Recover(err)
+	}
+	return false
+}
+
+// Record returns the record read by the last call to Next, or nil if it returned false
+func (r *RecordReader) Record() types.Field {
+	return r.record
+}
+
+// Err returns the error which stopped Next, or nil at the end of the file
+func (r *RecordReader) Err() error {
+	if r.err == io.EOF {
+		return nil
+	}
+	return r.err
+}
+
+// BlockOffset returns the offset in the file of the block holding the record read by the last call to Next
+func (r *RecordReader) BlockOffset() int64 {
+	return r.blockOffset
+}
+
+// Index returns the index of the record read by the last call to Next within its block,
+// so BlockOffset and Index locate the record in the file even when blocks are skipped
+func (r *RecordReader) Index() int64 {
+	return r.index
+}
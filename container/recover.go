@@ -0,0 +1,105 @@
+package container
+
+import (
+	"bytes"
+	"io"
+)
+
+// A SkippedRange is a part of a container file which a Reader in recovery mode couldn't read
+type SkippedRange struct {
+	// The offset of the first byte skipped, and of the byte after the last one
+	Start int64
+	End   int64
+	// The number of records skipped
+	Records int64
+	// Whether Records is an estimate. When the framing of a block is damaged its record count can't
+	// be trusted, so it's estimated from the size of the blocks read before. When a record can't be
+	// decoded, the rest of its block is skipped and Records is the record count of the whole block.
+	Estimated bool
+	// The error which caused the range to be skipped
+	Err error
+}
+
+// WithRecovery puts the Reader in recovery mode, to salvage as many records as possible from a damaged file.
+// When a block can't be read or a record in it can't be decoded, the Reader scans forward for the file's
+// sync marker and resumes with the next block. Each range skipped is passed to handler: if it returns nil
+// reading continues, otherwise Read returns its error. Errors reading the input itself aren't recovered from.
+// Blocks which fail their integrity checks are passed to the WithCorruptBlockHandler handler instead, if there is one.
+func WithRecovery(handler func(*SkippedRange) error) ReaderOption {
+	return func(r *Reader) {
+		r.onSkip = handler
+	}
+}
+
+// Recover is called by readers of records, like the generated `<RecordType>Reader`, when a record
+// can't be decoded. In recovery mode the rest of the current block is skipped and reported, and
+// Recover returns nil so the next record is read from the next block. Otherwise, or if the error
+// came from the Reader itself, Recover returns err.
+func (r *Reader) Recover(err error) error {
+	if r.onSkip == nil || r.blockReader == nil || r.err != nil {
+		return err
+	}
+	log("OCF skipping the rest of the block after: %v", err)
+	r.blockReader = nil
+	return r.onSkip(&SkippedRange{
+		Start:     r.blockStart,
+		End:       r.blockEnd,
+		Records:   r.blockRecords,
+		Estimated: true,
+		Err:       err,
+	})
+}
+
+// Skip past a block which couldn't be read, starting at start, to the next sync marker
+func (r *Reader) resync(start int64, cause error) error {
+	raw := r.reader.recorded
+	r.reader.recording = false
+	r.blockReader = nil
+
+	skipped := &SkippedRange{Start: start, Err: cause}
+	if blockErr, ok := cause.(*BlockError); ok && bytes.HasSuffix(raw, r.sync[:]) {
+		// The framing of the block is intact, so the record count is right
+		skipped.End = r.reader.offset
+		skipped.Records = blockErr.Records
+	} else {
+		if err := r.scan(raw); err != nil {
+			return err
+		}
+		skipped.End = r.reader.offset
+		skipped.Estimated = true
+		if r.goodBytes > 0 {
+			skipped.Records = (skipped.End - start) * r.goodRecords / r.goodBytes
+		}
+	}
+	return r.onSkip(skipped)
+}
+
+// Find the next sync marker after the first byte of raw, which was read from the start of the
+// damaged block, reading more of the input if needed. The input is left just after the marker,
+// or at the end if there isn't one.
+func (r *Reader) scan(raw []byte) error {
+	buf := make([]byte, 0, 4096)
+	if len(raw) > 1 {
+		buf = append(buf, raw[1:]...)
+	}
+	chunk := make([]byte, 4096)
+	for {
+		if i := bytes.Index(buf, r.sync[:]); i >= 0 {
+			r.reader.unread(buf[i+len(r.sync):])
+			return nil
+		}
+		// Keep enough of the end of the buffer to find a marker which spans two chunks
+		if len(buf) >= len(r.sync) {
+			buf = append(buf[:0], buf[len(buf)-len(r.sync)+1:]...)
+		}
+
+		n, err := r.reader.Read(chunk)
+		buf = append(buf, chunk[:n]...)
+		if err == io.EOF && n == 0 {
+			return nil
+		}
+		if err != nil && err != io.EOF {
+			return err
+		}
+	}
+}
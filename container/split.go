@@ -0,0 +1,67 @@
+package container
+
+import (
+	"bytes"
+	"io"
+	"math"
+)
+
+// NewSplitReader returns a Reader for the blocks of a container file in the byte range [start, end), so a large
+// file can be split into ranges read by different workers. header must have been read from the start of the file
+// with ReadHeader.
+//
+// Like Hadoop's input splits for Avro files, a block belongs to the range its preceding sync marker starts in.
+// The reader scans forward from start to the first sync marker, and reads blocks until the sync marker before
+// the next block starts at or after end. Reading adjacent ranges which cover the file reads every block exactly once.
+func NewSplitReader(header *Header, r io.ReaderAt, start, end int64, options ...ReaderOption) (*Reader, error) {
+	// The sync marker at the end of the header precedes the first block
+	syncStart := header.Size - int64(len(header.Sync))
+	input := &countingReader{r: io.NewSectionReader(r, header.Size, math.MaxInt64-header.Size), offset: header.Size}
+	if start > syncStart {
+		var err error
+		syncStart, input, err = findSync(r, start, header.Sync)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	reader := newReader(header, input, options)
+	reader.splitEnd = end
+	if syncStart >= end {
+		// There's no block in the range
+		reader.splitEnd = -1
+	}
+	return reader, nil
+}
+
+// Find the first sync marker at or after start, and return its offset and a reader for the input after it.
+// At the end of the input, the offset is math.MaxInt64.
+func findSync(r io.ReaderAt, start int64, sync [16]byte) (int64, *countingReader, error) {
+	buf := make([]byte, 0, 4096)
+	chunk := make([]byte, 4096)
+	// The offset of the start of buf
+	bufStart := start
+	offset := start
+	for {
+		if i := bytes.Index(buf, sync[:]); i >= 0 {
+			next := bufStart + int64(i) + int64(len(sync))
+			return next - int64(len(sync)), &countingReader{r: io.NewSectionReader(r, next, math.MaxInt64-next), offset: next}, nil
+		}
+		// Keep enough of the end of the buffer to find a marker which spans two chunks
+		if len(buf) >= len(sync) {
+			keep := len(sync) - 1
+			bufStart += int64(len(buf) - keep)
+			buf = append(buf[:0], buf[len(buf)-keep:]...)
+		}
+
+		n, err := r.ReadAt(chunk, offset)
+		buf = append(buf, chunk[:n]...)
+		offset += int64(n)
+		if err == io.EOF && n == 0 {
+			return math.MaxInt64, &countingReader{r: bytes.NewReader(nil), offset: offset}, nil
+		}
+		if err != nil && err != io.EOF {
+			return 0, nil, err
+		}
+	}
+}
@@ -4,88 +4,208 @@ package container
 import (
 	"bytes"
 	"compress/flate"
+	"crypto/rand"
+	"fmt"
 	"io"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/actgardner/gogen-avro/container/avro"
 )
 
-// A Codec specifies how the blocks within a container file should be compressed.
-type Codec string
-
-const (
-	// No compression
-	Null Codec = "null"
-
-	// Deflate compression
-	Deflate Codec = "deflate"
-
-	// Snappy compression
-	Snappy Codec = "snappy"
-)
-
-type CloseableResettableWriter interface {
-	Close() error
-	Reset(io.Writer)
-}
+// The magic bytes at the start of every container file
+var magic = avro.Magic{'O', 'b', 'j', 1}
 
 // Writer wraps an io.Writer and writes the file and block-level framing required for an OCF file.
 // You can create a Writer for a given struct by calling the generated method `New<RecordType>Writer`.
 type Writer struct {
 	writer           io.Writer
 	syncMarker       [16]byte
+	randomSync       bool
+	metadata         map[string][]byte
+	schema           string
 	codec            Codec
+	blockCodec       BlockCodec
 	recordsPerBlock  int64
 	blockBuffer      *bytes.Buffer
-	compressedWriter io.Writer
+	compressed       []byte
 	nextBlockRecords int64
+
+	// The level set with WithDeflateLevel, applied once all the options are set
+	deflateLevel *int
+
+	blockSize     int64
+	flushInterval time.Duration
+	// When the first record of the current block was written, with a flush interval
+	blockStarted time.Time
+
+	compressionWorkers int
+	compressor         *compressor
+
+	closeWriter bool
+	closed      bool
+	// The first error compressing or writing a block, after which the file can't be written to
+	err error
+}
+
+// A WriterOption configures a Writer created with NewWriter
+type WriterOption func(*Writer)
+
+// WithSyncMarker sets the sync marker written after each block, instead of a random one.
+// Use it to produce identical output for identical input, for example in tests.
+func WithSyncMarker(marker [16]byte) WriterOption {
+	return func(w *Writer) {
+		w.syncMarker = marker
+		w.randomSync = false
+	}
+}
+
+// WithMetadata adds a key and value to the metadata in the file header. Keys starting with `avro.`
+// are reserved for the Avro spec, NewWriter returns an error if one is used.
+func WithMetadata(key string, value []byte) WriterOption {
+	return func(w *Writer) {
+		if w.metadata == nil {
+			w.metadata = make(map[string][]byte)
+		}
+		w.metadata[key] = value
+	}
+}
+
+// WithDeflateLevel sets the compression level of a Writer using the Deflate codec,
+// from flate.BestSpeed to flate.BestCompression. NewWriter returns an error if the
+// Writer uses another codec, or if the level isn't valid.
+func WithDeflateLevel(level int) WriterOption {
+	return func(w *Writer) {
+		w.deflateLevel = &level
+	}
+}
+
+// WithBlockSize flushes blocks once their uncompressed size reaches size bytes, so blocks of large
+// records don't grow too big and blocks of small records aren't too small. The recordsPerBlock passed
+// to NewWriter is then an optional cap on the number of records in a block, which isn't applied if it's 0.
+func WithBlockSize(size int64) WriterOption {
+	return func(w *Writer) {
+		w.blockSize = size
+	}
+}
+
+// WithFlushInterval flushes blocks once the first record in them was written at least d ago, so records
+// written slowly to a stream don't wait indefinitely for the block to fill. WriteRecord checks the age
+// of the block after each record: call FlushIfDue periodically to flush it when no records are written.
+func WithFlushInterval(d time.Duration) WriterOption {
+	return func(w *Writer) {
+		w.flushInterval = d
+	}
+}
+
+// WithCloseWriter makes Close close the underlying io.Writer too, if it's an io.Closer
+func WithCloseWriter() WriterOption {
+	return func(w *Writer) {
+		w.closeWriter = true
+	}
 }
 
 //  Create a new Writer wrapping the provided io.Writer with the given Codec and number of records per block.
 //  The Writer will lazily write the container file header when WriteRecord is called the first time.
-//  You must call Flush on the Writer before closing the underlying io.Writer, to ensure the final block is written.
+//  You must call Flush or Close on the Writer before closing the underlying io.Writer, to ensure the final block is written.
 //  A schema string must be passed to ensure that a correct header is written even if no records are written. This
 //  is required to produce valid empty Avro container files.
-func NewWriter(writer io.Writer, codec Codec, recordsPerBlock int64, schema string) (*Writer, error) {
+//  Each file gets a random sync marker, unless one is set with WithSyncMarker.
+//  The blocks are compressed with the BlockCodec registered for the codec.
+func NewWriter(writer io.Writer, codec Codec, recordsPerBlock int64, schema string, options ...WriterOption) (*Writer, error) {
+	avroWriter, err := newWriter(writer, codec, recordsPerBlock, schema, options)
+	if err != nil {
+		return nil, err
+	}
+	if avroWriter.randomSync {
+		if _, err := rand.Read(avroWriter.syncMarker[:]); err != nil {
+			return nil, err
+		}
+	}
+
+	err = avroWriter.writeHeader(schema)
+	if err != nil {
+		return nil, err
+	}
+
+	avroWriter.start()
+	return avroWriter, nil
+}
+
+// Create a Writer with its options applied, without writing anything
+func newWriter(writer io.Writer, codec Codec, recordsPerBlock int64, schema string, options []WriterOption) (*Writer, error) {
 	blockBytes := make([]byte, 0)
 	blockBuffer := bytes.NewBuffer(blockBytes)
 
+	blockCodec, ok := LookupCodec(codec)
+	if !ok {
+		return nil, fmt.Errorf("Unknown codec %q", codec)
+	}
+
 	avroWriter := &Writer{
 		writer:          writer,
-		syncMarker:      [16]byte{'g', 'o', 'g', 'e', 'n', 'a', 'v', 'r', 'o', 'm', 'a', 'g', 'i', 'c', '1', '0'},
+		randomSync:      true,
+		schema:          schema,
 		codec:           codec,
+		blockCodec:      blockCodec,
 		recordsPerBlock: recordsPerBlock,
 		blockBuffer:     blockBuffer,
 	}
-	var err error
-	if codec == Deflate {
-		avroWriter.compressedWriter, err = flate.NewWriter(avroWriter.blockBuffer, flate.DefaultCompression)
-		if err != nil {
-			return nil, err
+	for _, option := range options {
+		option(avroWriter)
+	}
+	for key := range avroWriter.metadata {
+		if strings.HasPrefix(key, "avro.") {
+			return nil, fmt.Errorf("Invalid metadata key %q: keys starting with avro. are reserved", key)
 		}
-	} else if codec == Snappy {
-		avroWriter.compressedWriter = newSnappyWriter(avroWriter.blockBuffer)
-	} else {
-		avroWriter.compressedWriter = avroWriter.blockBuffer
 	}
-
-	err = avroWriter.writeHeader(schema)
-	if err != nil {
-		return nil, err
+	if level := avroWriter.deflateLevel; level != nil {
+		if codec != Deflate {
+			return nil, fmt.Errorf("Unable to set a deflate level for codec %q", codec)
+		}
+		if *level < flate.HuffmanOnly || *level > flate.BestCompression {
+			return nil, fmt.Errorf("Invalid deflate level %v", *level)
+		}
+		avroWriter.blockCodec = NewDeflateCodec(*level)
 	}
-
 	return avroWriter, nil
 }
 
+// Start the goroutines compressing blocks, with WithCompressionWorkers
+func (avroWriter *Writer) start() {
+	if avroWriter.compressionWorkers > 0 {
+		avroWriter.compressor = newCompressor(avroWriter, avroWriter.compressionWorkers)
+	}
+}
+
 func (avroWriter *Writer) writeHeader(schema string) error {
-	header := &avro.AvroContainerHeader{
-		Magic: [4]byte{'O', 'b', 'j', 1},
-		Meta: map[string][]byte{
-			"avro.schema": []byte(schema),
-			"avro.codec":  []byte(avroWriter.codec),
-		},
-		Sync: avroWriter.syncMarker,
+	meta := map[string][]byte{
+		"avro.schema": []byte(schema),
+		"avro.codec":  []byte(avroWriter.codec),
+	}
+	for key, value := range avroWriter.metadata {
+		meta[key] = value
+	}
+
+	// The generated AvroContainerHeader writes the metadata in map order, so write the header
+	// here with the keys sorted to produce the same output for the same options
+	keys := make([]string, 0, len(meta))
+	for key := range meta {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	header := append([]byte{}, magic[:]...)
+	header = appendLong(header, int64(len(keys)))
+	for _, key := range keys {
+		header = appendBytes(header, []byte(key))
+		header = appendBytes(header, meta[key])
 	}
-	return header.Serialize(avroWriter.writer)
+	header = appendLong(header, 0)
+	header = append(header, avroWriter.syncMarker[:]...)
+	_, err := avroWriter.writer.Write(header)
+	return err
 }
 
 //  Write an AvroRecord to the container file. All gogen-avro generated structs
@@ -93,46 +213,147 @@ func (avroWriter *Writer) writeHeader(schema string) error {
 //  must be of the same Avro type.
 func (avroWriter *Writer) WriteRecord(record AvroRecord) error {
 	var err error
-	// Serialize the new record into the compressed writer
-	err = record.Serialize(avroWriter.compressedWriter)
+	if err = avroWriter.check(); err != nil {
+		return err
+	}
+	if avroWriter.nextBlockRecords == 0 && avroWriter.flushInterval > 0 {
+		avroWriter.blockStarted = time.Now()
+	}
+	// Serialize the new record into the block buffer, dropping any part of it written before an error
+	size := avroWriter.blockBuffer.Len()
+	err = record.Serialize(avroWriter.blockBuffer)
 	if err != nil {
+		avroWriter.blockBuffer.Truncate(size)
 		return err
 	}
 	avroWriter.nextBlockRecords += 1
 
-	// If the block if full, flush and reset the compressed writer,
-	// write the header and the block contents
-	if avroWriter.nextBlockRecords >= avroWriter.recordsPerBlock {
-		return avroWriter.Flush()
+	// If the block if full, compress it and write the header and the block contents
+	if avroWriter.blockFull() || avroWriter.blockDue() {
+		return avroWriter.flushBlock()
 	}
 
 	return nil
 }
 
+//  Flush the current block if it's older than the interval set with WithFlushInterval.
+//  Streaming writers can call it periodically, from the goroutine writing the records,
+//  to flush records written before a pause.
+func (avroWriter *Writer) FlushIfDue() error {
+	if err := avroWriter.check(); err != nil {
+		return err
+	}
+	if !avroWriter.blockDue() {
+		return nil
+	}
+	return avroWriter.flushBlock()
+}
+
+func (avroWriter *Writer) blockFull() bool {
+	if avroWriter.blockSize > 0 {
+		if int64(avroWriter.blockBuffer.Len()) >= avroWriter.blockSize {
+			return true
+		}
+		return avroWriter.recordsPerBlock > 0 && avroWriter.nextBlockRecords >= avroWriter.recordsPerBlock
+	}
+	return avroWriter.nextBlockRecords >= avroWriter.recordsPerBlock
+}
+
+func (avroWriter *Writer) blockDue() bool {
+	return avroWriter.flushInterval > 0 && avroWriter.nextBlockRecords > 0 && time.Since(avroWriter.blockStarted) >= avroWriter.flushInterval
+}
+
 //  Write the current block to the file if it has been filled.  It is
 //  best-practise to always call this before the underlying io.Writer is closed.
+//  With WithCompressionWorkers, Flush waits until every block has been written.
 func (avroWriter *Writer) Flush() error {
+	if err := avroWriter.check(); err != nil {
+		return err
+	}
+	if err := avroWriter.flushBlock(); err != nil {
+		return err
+	}
+	if avroWriter.compressor != nil {
+		if err := avroWriter.compressor.wait(); err != nil {
+			return avroWriter.fail(err)
+		}
+	}
+	return nil
+}
+
+//  Flush the Writer and stop the goroutines started by WithCompressionWorkers, returning the
+//  first error compressing or writing a block. With WithCloseWriter the underlying io.Writer
+//  is closed too. Afterwards every method of the Writer, including Close, returns ErrWriterClosed.
+func (avroWriter *Writer) Close() error {
+	if avroWriter.closed {
+		return ErrWriterClosed
+	}
+	err := avroWriter.Flush()
+	if avroWriter.compressor != nil {
+		if closeErr := avroWriter.compressor.close(); err == nil {
+			err = closeErr
+		}
+		avroWriter.compressor = nil
+	}
+	if closer, ok := avroWriter.writer.(io.Closer); ok && avroWriter.closeWriter {
+		if closeErr := closer.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	avroWriter.closed = true
+	return err
+}
+
+// Return the error which stops the Writer from being used, if there is one
+func (avroWriter *Writer) check() error {
+	if avroWriter.closed {
+		return ErrWriterClosed
+	}
+	return avroWriter.err
+}
+
+// Record an error compressing or writing a block. Part of the block might have been written,
+// so nothing else can be written to the file.
+func (avroWriter *Writer) fail(err error) error {
+	if avroWriter.err == nil {
+		avroWriter.err = err
+	}
+	return avroWriter.err
+}
+
+// Compress and write the current block, or queue it with WithCompressionWorkers
+func (avroWriter *Writer) flushBlock() error {
 	if avroWriter.nextBlockRecords == 0 {
 		return nil
 	}
 
+	if avroWriter.compressor != nil {
+		if err := avroWriter.compressor.error(); err != nil {
+			return avroWriter.fail(err)
+		}
+		avroWriter.compressor.submit(avroWriter.nextBlockRecords, avroWriter.blockBuffer)
+		avroWriter.blockBuffer = avroWriter.compressor.buffer()
+		avroWriter.nextBlockRecords = 0
+		return nil
+	}
+
 	// Write out all of the buffered records as a new block
 	// Must be called before closing to ensure the last block is written
-	if fwWriter, ok := avroWriter.compressedWriter.(CloseableResettableWriter); ok {
-		fwWriter.Close()
-		fwWriter.Reset(avroWriter.blockBuffer)
+	compressed, err := avroWriter.blockCodec.Compress(avroWriter.compressed[:0], avroWriter.blockBuffer.Bytes())
+	if err != nil {
+		return avroWriter.fail(err)
 	}
+	// Keep the compressed buffer for the next block
+	avroWriter.compressed = compressed
 
-	if avroWriter.nextBlockRecords > 0 {
-		block := &avro.AvroContainerBlock{
-			NumRecords:  avroWriter.nextBlockRecords,
-			RecordBytes: avroWriter.blockBuffer.Bytes(),
-			Sync:        avroWriter.syncMarker,
-		}
-		err := block.Serialize(avroWriter.writer)
-		if err != nil {
-			return err
-		}
+	block := &avro.AvroContainerBlock{
+		NumRecords:  avroWriter.nextBlockRecords,
+		RecordBytes: compressed,
+		Sync:        avroWriter.syncMarker,
+	}
+	err = block.Serialize(avroWriter.writer)
+	if err != nil {
+		return avroWriter.fail(err)
 	}
 
 	avroWriter.blockBuffer.Reset()
@@ -140,3 +361,16 @@ func (avroWriter *Writer) Flush() error {
 
 	return nil
 }
+
+func appendLong(b []byte, v int64) []byte {
+	u := uint64(v<<1) ^ uint64(v>>63)
+	for u >= 0x80 {
+		b = append(b, byte(u)|0x80)
+		u >>= 7
+	}
+	return append(b, byte(u))
+}
+
+func appendBytes(b []byte, v []byte) []byte {
+	return append(appendLong(b, int64(len(v))), v...)
+}
@@ -7,12 +7,12 @@
 package avro
 
 import (
-	"io"
-
+	"bytes"
 	"github.com/actgardner/gogen-avro/compiler"
 	"github.com/actgardner/gogen-avro/container"
 	"github.com/actgardner/gogen-avro/vm"
 	"github.com/actgardner/gogen-avro/vm/types"
+	"io"
 )
 
 type DemoSchema struct {
@@ -23,21 +23,31 @@ type DemoSchema struct {
 	BytesField  []byte
 }
 
-func NewDemoSchemaWriter(writer io.Writer, codec container.Codec, recordsPerBlock int64) (*container.Writer, error) {
+// NewDemoSchemaAppendWriter appends DemoSchema records to an existing container file with the same schema, see container.OpenAppend.
+func NewDemoSchemaAppendWriter(file io.ReadWriteSeeker, codec container.Codec, recordsPerBlock int64, options ...container.WriterOption) (*container.Writer, error) {
+	str := &DemoSchema{}
+	return container.OpenAppend(file, codec, recordsPerBlock, str.Schema(), options...)
+}
+
+func NewDemoSchemaWriter(writer io.Writer, codec container.Codec, recordsPerBlock int64, options ...container.WriterOption) (*container.Writer, error) {
 	str := &DemoSchema{}
-	return container.NewWriter(writer, codec, recordsPerBlock, str.Schema())
+	return container.NewWriter(writer, codec, recordsPerBlock, str.Schema(), options...)
 }
 
 func DeserializeDemoSchema(r io.Reader) (*DemoSchema, error) {
 	t := NewDemoSchema()
+	err := DeserializeDemoSchemaInto(r, t)
+	return t, err
+}
 
+// DeserializeDemoSchemaInto deserializes a record into t, reusing any nested values already allocated in t.
+func DeserializeDemoSchemaInto(r io.Reader, t *DemoSchema) error {
 	deser, err := compiler.CompileSchemaBytes([]byte(t.Schema()), []byte(t.Schema()))
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	err = vm.Eval(r, deser, t)
-	return t, err
+	return vm.Eval(r, deser, t)
 }
 
 func NewDemoSchema() *DemoSchema {
@@ -48,68 +58,186 @@ func (r *DemoSchema) Schema() string {
 	return "{\"fields\":[{\"name\":\"IntField\",\"type\":\"int\"},{\"name\":\"DoubleField\",\"type\":\"double\"},{\"name\":\"StringField\",\"type\":\"string\"},{\"name\":\"BoolField\",\"type\":\"boolean\"},{\"name\":\"BytesField\",\"type\":\"bytes\"}],\"name\":\"DemoSchema\",\"type\":\"record\"}"
 }
 
+func (r *DemoSchema) SchemaName() string {
+	return "DemoSchema"
+}
+
 func (r *DemoSchema) Serialize(w io.Writer) error {
 	return writeDemoSchema(r, w)
 }
 
-func (_ *DemoSchema) SetBoolean(v bool)    { panic("Unsupported operation") }
-func (_ *DemoSchema) SetInt(v int32)       { panic("Unsupported operation") }
-func (_ *DemoSchema) SetLong(v int64)      { panic("Unsupported operation") }
-func (_ *DemoSchema) SetFloat(v float32)   { panic("Unsupported operation") }
-func (_ *DemoSchema) SetDouble(v float64)  { panic("Unsupported operation") }
-func (_ *DemoSchema) SetBytes(v []byte)    { panic("Unsupported operation") }
-func (_ *DemoSchema) SetString(v string)   { panic("Unsupported operation") }
-func (_ *DemoSchema) SetUnionElem(v int64) { panic("Unsupported operation") }
-func (r *DemoSchema) Get(i int) types.Field {
+func (_ *DemoSchema) SetBoolean(v bool) error {
+	return &types.FieldError{Field: "DemoSchema", Op: types.OpAssign, Value: "boolean"}
+}
+func (_ *DemoSchema) SetInt(v int32) error {
+	return &types.FieldError{Field: "DemoSchema", Op: types.OpAssign, Value: "int"}
+}
+func (_ *DemoSchema) SetLong(v int64) error {
+	return &types.FieldError{Field: "DemoSchema", Op: types.OpAssign, Value: "long"}
+}
+func (_ *DemoSchema) SetFloat(v float32) error {
+	return &types.FieldError{Field: "DemoSchema", Op: types.OpAssign, Value: "float"}
+}
+func (_ *DemoSchema) SetDouble(v float64) error {
+	return &types.FieldError{Field: "DemoSchema", Op: types.OpAssign, Value: "double"}
+}
+func (_ *DemoSchema) SetBytes(v []byte) error {
+	return &types.FieldError{Field: "DemoSchema", Op: types.OpAssign, Value: "bytes"}
+}
+func (_ *DemoSchema) SetString(v string) error {
+	return &types.FieldError{Field: "DemoSchema", Op: types.OpAssign, Value: "string"}
+}
+func (r *DemoSchema) Get(i int) (types.Field, error) {
 	switch i {
 	case 0:
-		return (*types.Int)(&r.IntField)
-		break
+		return (*types.Int)(&r.IntField), nil
 	case 1:
-		return (*types.Double)(&r.DoubleField)
-		break
+		return (*types.Double)(&r.DoubleField), nil
 	case 2:
-		return (*types.String)(&r.StringField)
-		break
+		return (*types.String)(&r.StringField), nil
 	case 3:
-		return (*types.Boolean)(&r.BoolField)
-		break
+		return (*types.Boolean)(&r.BoolField), nil
 	case 4:
-		return (*types.Bytes)(&r.BytesField)
-		break
+		return (*types.Bytes)(&r.BytesField), nil
+
+	}
+	return nil, &types.FieldError{Field: "DemoSchema", Op: types.OpGet, Index: i}
+}
+func (r *DemoSchema) SetDefault(i int) error {
+	switch i {
 
 	}
-	panic("Unknown field index")
+	return &types.FieldError{Field: "DemoSchema", Op: types.OpSetDefault, Index: i}
+}
+func (_ *DemoSchema) AppendMap(key string) (types.Field, error) {
+	return nil, &types.FieldError{Field: "DemoSchema", Op: types.OpAppendMap}
 }
-func (_ *DemoSchema) AppendMap(key string) types.Field { panic("Unsupported operation") }
-func (_ *DemoSchema) AppendArray() types.Field         { panic("Unsupported operation") }
-func (_ *DemoSchema) Finalize()                        {}
+func (_ *DemoSchema) AppendArray() (types.Field, error) {
+	return nil, &types.FieldError{Field: "DemoSchema", Op: types.OpAppendArray}
+}
+func (_ *DemoSchema) Finalize() {}
 
 type DemoSchemaReader struct {
-	r io.Reader
-	p *vm.Program
+	r    *container.Reader
+	p    *vm.Program
+	opts vm.Options
+
+	// With container.WithParallelism, the reader decoding blocks ahead and the records left in the current block
+	parallel *container.ParallelReader
+	block    []*DemoSchema
 }
 
-func NewDemoSchemaReader(r io.Reader) (*DemoSchemaReader, error) {
-	containerReader, err := container.NewReader(r)
+// NewDemoSchemaReader creates a reader for a container file, the options are passed to container.NewReader.
+func NewDemoSchemaReader(r io.Reader, options ...container.ReaderOption) (*DemoSchemaReader, error) {
+	containerReader, err := container.NewReader(r, options...)
 	if err != nil {
 		return nil, err
 	}
+	return NewDemoSchemaReaderFromContainer(containerReader)
+}
 
+// NewDemoSchemaReaderFromContainer creates a reader for the records of a container.Reader, like one returned by container.NewSplitReader.
+func NewDemoSchemaReaderFromContainer(containerReader *container.Reader) (*DemoSchemaReader, error) {
 	t := NewDemoSchema()
 	deser, err := compiler.CompileSchemaBytes([]byte(containerReader.AvroContainerSchema()), []byte(t.Schema()))
 	if err != nil {
 		return nil, err
 	}
 
-	return &DemoSchemaReader{
-		r: containerReader,
-		p: deser,
-	}, nil
+	reader := &DemoSchemaReader{
+		r:    containerReader,
+		p:    deser,
+		opts: vm.Options{ReuseBuffers: true, Limits: containerReader.Limits()},
+	}
+	if n := containerReader.Parallelism(); n > 0 {
+		reader.parallel = container.NewParallelReader(containerReader, n, reader.decodeBlock)
+	}
+	return reader, nil
+}
+
+// NewDemoSchemaReaderWithLimits creates a reader which rejects blocks and records exceeding the given limits,
+// for reading files from untrusted sources.
+func NewDemoSchemaReaderWithLimits(r io.Reader, limits vm.Limits) (*DemoSchemaReader, error) {
+	return NewDemoSchemaReader(r, container.WithLimits(limits))
 }
 
 func (r *DemoSchemaReader) Read() (*DemoSchema, error) {
+	if r.parallel != nil {
+		return r.next()
+	}
 	t := NewDemoSchema()
-	err := vm.Eval(r.r, r.p, t)
+	err := r.ReadInto(t)
 	return t, err
 }
+
+// ReadInto reads the next record into t, reusing any nested values already allocated in t.
+// With container.WithParallelism the record is decoded ahead and copied into t instead.
+func (r *DemoSchemaReader) ReadInto(t *DemoSchema) error {
+	if r.parallel != nil {
+		next, err := r.next()
+		if err != nil {
+			return err
+		}
+		*t = *next
+		return nil
+	}
+
+	for {
+		r.r.StartRecord()
+		err := vm.EvalWithOptions(r.r, r.p, t, &r.opts)
+		if err == nil || err == io.EOF {
+			return err
+		}
+		// In recovery mode the rest of the block is skipped, and the record is read from the next one
+		if err := r.r.Recover(err); err != nil {
+			return err
+		}
+	}
+}
+
+// Metadata returns the metadata in the header of the file, see container.Reader.Metadata
+func (r *DemoSchemaReader) Metadata() map[string][]byte {
+	return r.r.Metadata()
+}
+
+// Close stops the goroutines decoding blocks ahead with container.WithParallelism.
+// It doesn't close the underlying io.Reader.
+func (r *DemoSchemaReader) Close() error {
+	if r.parallel != nil {
+		return r.parallel.Close()
+	}
+	return nil
+}
+
+// Return the next record decoded ahead
+func (r *DemoSchemaReader) next() (*DemoSchema, error) {
+	for len(r.block) == 0 {
+		records, err := r.parallel.Next()
+		if err != nil {
+			return nil, err
+		}
+		r.block = records.([]*DemoSchema)
+	}
+	t := r.block[0]
+	r.block = r.block[1:]
+	return t, nil
+}
+
+// Decode the records of a block, on the worker goroutines of the parallel reader
+func (r *DemoSchemaReader) decodeBlock(block []byte, records int64) (interface{}, error) {
+	input := bytes.NewReader(block)
+	opts := vm.Options{Limits: r.opts.Limits}
+	decoded := make([]*DemoSchema, 0)
+	for i := int64(0); i < records; i++ {
+		t := NewDemoSchema()
+		if err := vm.EvalWithOptions(input, r.p, t, &opts); err != nil {
+			// The block ended before all of its records, which isn't the end of the file
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		decoded = append(decoded, t)
+	}
+	return decoded, nil
+}
@@ -0,0 +1,366 @@
+// Generic provides a types.Field which decodes Avro data without generated code.
+// Values are stored as plain Go types:
+//  - records as map[string]interface{}, keyed by field name
+//  - arrays as []interface{}
+//  - maps as map[string]interface{}
+//  - unions as the value of the selected branch, or nil for null
+//  - enums as the symbol string
+//  - fixed and bytes as []byte
+//  - primitives as bool, int32, int64, float32, float64 and string
+package generic
+
+import (
+	"fmt"
+
+	"github.com/actgardner/gogen-avro/schema"
+	"github.com/actgardner/gogen-avro/vm/types"
+)
+
+// Datum is a types.Field which stores a decoded value of the given schema.
+// A Datum can be used as the target of a vm.Program compiled for its schema,
+// including programs built with compiler.CompileProjection for a projected schema.
+type Datum struct {
+	t     schema.AvroType
+	set   func(interface{})
+	value interface{}
+
+	record map[string]interface{}
+	array  []interface{}
+	m      map[string]interface{}
+}
+
+// NewDatum creates an empty Datum for values of type t
+func NewDatum(t schema.AvroType) *Datum {
+	d := &Datum{t: t}
+	d.set = func(v interface{}) { d.value = v }
+	d.init()
+	return d
+}
+
+// Value returns the decoded value
+func (d *Datum) Value() interface{} {
+	return d.value
+}
+
+func newChild(t schema.AvroType, set func(interface{})) *Datum {
+	d := &Datum{t: t, set: set}
+	d.init()
+	return d
+}
+
+// Allocate the value of records, arrays and maps, which are filled in by their nested fields
+func (d *Datum) init() {
+	switch t := d.t.(type) {
+	case *schema.ArrayField:
+		d.array = make([]interface{}, 0)
+		d.set(d.array)
+	case *schema.MapField:
+		d.m = make(map[string]interface{})
+		d.set(d.m)
+	case *schema.Reference:
+		if _, ok := t.Def.(*schema.RecordDefinition); ok {
+			d.record = make(map[string]interface{})
+			d.set(d.record)
+		}
+	}
+}
+
+// The definition of a named type, or the type itself
+func (d *Datum) definition() interface{} {
+	if ref, ok := d.t.(*schema.Reference); ok {
+		return ref.Def
+	}
+	return d.t
+}
+
+func (d *Datum) fieldError(op types.Op, value string) error {
+	return &types.FieldError{Field: d.t.Name(), Op: op, Value: value}
+}
+
+func (d *Datum) SetBoolean(v bool) error {
+	if _, ok := d.t.(*schema.BoolField); ok {
+		d.set(v)
+		return nil
+	}
+	return d.fieldError(types.OpAssign, "boolean")
+}
+
+func (d *Datum) SetInt(v int32) error {
+	switch t := d.definition().(type) {
+	case *schema.IntField:
+		d.set(v)
+	case *schema.LongField:
+		d.set(int64(v))
+	case *schema.FloatField:
+		d.set(float32(v))
+	case *schema.DoubleField:
+		d.set(float64(v))
+	case *schema.EnumDefinition:
+		if v < 0 || int(v) >= len(t.Symbols()) {
+			return d.fieldError(types.OpAssign, "int")
+		}
+		d.set(t.Symbols()[v])
+	default:
+		return d.fieldError(types.OpAssign, "int")
+	}
+	return nil
+}
+
+func (d *Datum) SetLong(v int64) error {
+	switch t := d.t.(type) {
+	case *schema.LongField:
+		d.set(v)
+	case *schema.FloatField:
+		d.set(float32(v))
+	case *schema.DoubleField:
+		d.set(float64(v))
+	case *schema.UnionField:
+		// Selects the branch, which is set by entering it. The null branch has nothing to enter.
+		if v < 0 || int(v) >= len(t.AvroTypes()) {
+			return d.fieldError(types.OpAssign, "long")
+		}
+		if _, ok := t.AvroTypes()[v].(*schema.NullField); ok {
+			d.set(nil)
+		}
+	default:
+		return d.fieldError(types.OpAssign, "long")
+	}
+	return nil
+}
+
+func (d *Datum) SetFloat(v float32) error {
+	switch d.t.(type) {
+	case *schema.FloatField:
+		d.set(v)
+	case *schema.DoubleField:
+		d.set(float64(v))
+	default:
+		return d.fieldError(types.OpAssign, "float")
+	}
+	return nil
+}
+
+func (d *Datum) SetDouble(v float64) error {
+	if _, ok := d.t.(*schema.DoubleField); ok {
+		d.set(v)
+		return nil
+	}
+	return d.fieldError(types.OpAssign, "double")
+}
+
+func (d *Datum) SetBytes(v []byte) error {
+	switch d.definition().(type) {
+	case *schema.BytesField, *schema.FixedDefinition:
+		d.set(append([]byte{}, v...))
+	case *schema.StringField:
+		d.set(string(v))
+	default:
+		return d.fieldError(types.OpAssign, "bytes")
+	}
+	return nil
+}
+
+func (d *Datum) SetString(v string) error {
+	switch d.t.(type) {
+	case *schema.StringField:
+		d.set(v)
+	case *schema.BytesField:
+		d.set([]byte(v))
+	default:
+		return d.fieldError(types.OpAssign, "string")
+	}
+	return nil
+}
+
+func (d *Datum) Get(i int) (types.Field, error) {
+	switch t := d.definition().(type) {
+	case *schema.RecordDefinition:
+		if f := recordField(t, i); f != nil {
+			record := d.record
+			name := f.Name()
+			return newChild(f.Type(), func(v interface{}) { record[name] = v }), nil
+		}
+	case *schema.UnionField:
+		if i >= 0 && i < len(t.AvroTypes()) {
+			branch := t.AvroTypes()[i]
+			if _, ok := branch.(*schema.NullField); ok {
+				d.set(nil)
+			}
+			return newChild(branch, d.set), nil
+		}
+	}
+	return nil, &types.FieldError{Field: d.t.Name(), Op: types.OpGet, Index: i}
+}
+
+func (d *Datum) SetDefault(i int) error {
+	if def, ok := d.definition().(*schema.RecordDefinition); ok {
+		if f := recordField(def, i); f != nil && f.HasDefault() {
+			value, err := defaultValue(f.Type(), f.Default())
+			if err != nil {
+				return fmt.Errorf("Invalid default for field %v: %v", f.Name(), err)
+			}
+			d.record[f.Name()] = value
+			return nil
+		}
+	}
+	return &types.FieldError{Field: d.t.Name(), Op: types.OpSetDefault, Index: i}
+}
+
+func (d *Datum) AppendMap(key string) (types.Field, error) {
+	t, ok := d.t.(*schema.MapField)
+	if !ok {
+		return nil, d.fieldError(types.OpAppendMap, "")
+	}
+	m := d.m
+	return newChild(t.ItemType(), func(v interface{}) { m[key] = v }), nil
+}
+
+func (d *Datum) AppendArray() (types.Field, error) {
+	t, ok := d.t.(*schema.ArrayField)
+	if !ok {
+		return nil, d.fieldError(types.OpAppendArray, "")
+	}
+	index := len(d.array)
+	d.array = append(d.array, nil)
+	d.set(d.array)
+	return newChild(t.ItemType(), func(v interface{}) { d.array[index] = v }), nil
+}
+
+func (d *Datum) Finalize() {}
+
+func recordField(def *schema.RecordDefinition, i int) *schema.Field {
+	for _, f := range def.Fields() {
+		if f.Index() == i {
+			return f
+		}
+	}
+	return nil
+}
+
+// Convert the default value of a field, as parsed from the JSON schema, to the Go type
+// the value would be decoded as
+func defaultValue(t schema.AvroType, value interface{}) (interface{}, error) {
+	switch v := t.(type) {
+	case *schema.NullField:
+		if value != nil {
+			return nil, fmt.Errorf("expected null, got %v", value)
+		}
+		return nil, nil
+	case *schema.BoolField:
+		if _, ok := value.(bool); !ok {
+			return nil, fmt.Errorf("expected a boolean, got %v", value)
+		}
+		return value, nil
+	case *schema.IntField, *schema.LongField, *schema.FloatField, *schema.DoubleField:
+		n, ok := value.(float64)
+		if !ok {
+			return nil, fmt.Errorf("expected a number, got %v", value)
+		}
+		switch t.(type) {
+		case *schema.IntField:
+			return int32(n), nil
+		case *schema.LongField:
+			return int64(n), nil
+		case *schema.FloatField:
+			return float32(n), nil
+		}
+		return n, nil
+	case *schema.StringField:
+		if _, ok := value.(string); !ok {
+			return nil, fmt.Errorf("expected a string, got %v", value)
+		}
+		return value, nil
+	case *schema.BytesField:
+		return defaultBytes(value)
+	case *schema.UnionField:
+		// The default of a union is a value of its first type
+		return defaultValue(v.AvroTypes()[0], value)
+	case *schema.ArrayField:
+		items, ok := value.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("expected an array, got %v", value)
+		}
+		array := make([]interface{}, len(items))
+		for i, item := range items {
+			var err error
+			if array[i], err = defaultValue(v.ItemType(), item); err != nil {
+				return nil, err
+			}
+		}
+		return array, nil
+	case *schema.MapField:
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("expected an object, got %v", value)
+		}
+		values := make(map[string]interface{}, len(m))
+		for key, item := range m {
+			var err error
+			if values[key], err = defaultValue(v.ItemType(), item); err != nil {
+				return nil, err
+			}
+		}
+		return values, nil
+	case *schema.Reference:
+		return defaultRefValue(v, value)
+	}
+	return nil, fmt.Errorf("unsupported type %v", t.Name())
+}
+
+func defaultRefValue(ref *schema.Reference, value interface{}) (interface{}, error) {
+	switch def := ref.Def.(type) {
+	case *schema.RecordDefinition:
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("expected an object, got %v", value)
+		}
+		record := make(map[string]interface{}, len(def.Fields()))
+		for _, field := range def.Fields() {
+			fieldValue, ok := m[field.Name()]
+			if !ok {
+				if !field.HasDefault() {
+					return nil, fmt.Errorf("no value for field %v", field.Name())
+				}
+				fieldValue = field.Default()
+			}
+			var err error
+			if record[field.Name()], err = defaultValue(field.Type(), fieldValue); err != nil {
+				return nil, err
+			}
+		}
+		return record, nil
+	case *schema.EnumDefinition:
+		for _, symbol := range def.Symbols() {
+			if symbol == value {
+				return symbol, nil
+			}
+		}
+		return nil, fmt.Errorf("unknown symbol %v for enum %v", value, def.AvroName())
+	case *schema.FixedDefinition:
+		b, err := defaultBytes(value)
+		if err != nil {
+			return nil, err
+		}
+		if len(b) != def.SizeBytes() {
+			return nil, fmt.Errorf("expected %v bytes for fixed %v, got %v", def.SizeBytes(), def.AvroName(), len(b))
+		}
+		return b, nil
+	}
+	return nil, fmt.Errorf("unsupported type %v", ref.Name())
+}
+
+// Bytes and fixed defaults are strings, where each code point is a byte
+func defaultBytes(value interface{}) ([]byte, error) {
+	s, ok := value.(string)
+	if !ok {
+		return nil, fmt.Errorf("expected a string, got %v", value)
+	}
+	b := make([]byte, 0, len(s))
+	for _, r := range s {
+		if r > 255 {
+			return nil, fmt.Errorf("invalid byte %q", r)
+		}
+		b = append(b, byte(r))
+	}
+	return b, nil
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/actgardner/gogen-avro/container"
+)
+
+// concat copies the blocks of container files with the same schema and codec into a new file,
+// without decoding them. The user metadata of the first file is kept.
+func concat(args []string) {
+	flags := flag.NewFlagSet("concat", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s concat <output file> <container files>\n\nThe container files must have the same schema and codec.\n", os.Args[0])
+		os.Exit(1)
+	}
+	flags.Parse(args)
+	if flags.NArg() < 2 {
+		flags.Usage()
+	}
+
+	output, err := os.Create(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating file %q - %v\n", flags.Arg(0), err)
+		os.Exit(2)
+	}
+	defer output.Close()
+
+	var writer *container.Writer
+	for _, fileName := range flags.Args()[1:] {
+		input, err := os.Open(fileName)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading file %q - %v\n", fileName, err)
+			os.Exit(2)
+		}
+		reader, err := container.NewReader(input)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading file %q - %v\n", fileName, err)
+			os.Exit(2)
+		}
+
+		if writer == nil {
+			options := make([]container.WriterOption, 0)
+			for key, value := range reader.Metadata() {
+				if !strings.HasPrefix(key, "avro.") {
+					options = append(options, container.WithMetadata(key, value))
+				}
+			}
+			writer, err = container.NewWriter(output, reader.Codec(), 1, string(reader.AvroContainerSchema()), options...)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error writing file %q - %v\n", flags.Arg(0), err)
+				os.Exit(3)
+			}
+		}
+
+		if err := writer.AppendBlocks(reader); err != nil {
+			fmt.Fprintf(os.Stderr, "Error copying blocks from %q - %v\n", fileName, err)
+			os.Exit(3)
+		}
+		input.Close()
+	}
+}
@@ -17,6 +17,8 @@ const (
 	defaultContainers      = false
 	defaultShortUnions     = false
 	defaultNamespacedNames = nsNone
+	defaultPrecompile      = false
+	defaultVersions        = false
 )
 
 type config struct {
@@ -24,6 +26,8 @@ type config struct {
 	containers      bool
 	shortUnions     bool
 	namespacedNames string
+	precompile      bool
+	versions        bool
 	targetDir       string
 	files           []string
 }
@@ -36,10 +40,12 @@ func parseCmdLine() config {
 	flag.StringVar(&cfg.packageName, "package", defaultPackageName, "Name of generated package.")
 	flag.BoolVar(&cfg.containers, "containers", defaultContainers, "Whether to generate container writer methods.")
 	flag.BoolVar(&cfg.shortUnions, "short-unions", defaultShortUnions, "Whether to use shorter names for Union types.")
+	flag.BoolVar(&cfg.precompile, "precompile", defaultPrecompile, "Whether to embed precompiled deserializer programs, so Deserialize<RecordType> doesn't parse the schema at runtime.")
+	flag.BoolVar(&cfg.versions, "versions", defaultVersions, "Whether the schema files are successive versions of the same schema. Each version is generated into its own package v1, v2, etc. in the target directory, with a function converting the structs of each version into the next.")
 	flag.StringVar(&cfg.namespacedNames, "namespaced-names", defaultNamespacedNames, "Whether to generate namespaced names for types. Default is \"none\"; \"short\" uses the last part of the namespace (last word after a separator); \"full\" uses all namespace string.")
 
 	flag.Usage = func() {
-		fmt.Fprintf(os.Stderr, "Usage: %s [flags] <target directory> <schema files>\n\nWhere 'flags' are:\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Usage: %s [flags] <target directory> <schema files>\n       %s disasm <writer schema> [<reader schema>]\n       %s concat <output file> <container files>\n\nWhere 'flags' are:\n", os.Args[0], os.Args[0], os.Args[0])
 		flag.PrintDefaults()
 		os.Exit(1)
 	}
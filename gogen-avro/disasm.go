@@ -0,0 +1,48 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/actgardner/gogen-avro/compiler"
+)
+
+// disasm compiles the program which reads data written with one schema into another,
+// and prints it in the assembly format with the schema field each instruction reads.
+func disasm(args []string) {
+	flags := flag.NewFlagSet("disasm", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s disasm <writer schema> [<reader schema>]\n\nThe reader schema defaults to the writer schema.\n", os.Args[0])
+		os.Exit(1)
+	}
+	flags.Parse(args)
+	if flags.NArg() < 1 || flags.NArg() > 2 {
+		flags.Usage()
+	}
+
+	writerFile := flags.Arg(0)
+	readerFile := writerFile
+	if flags.NArg() == 2 {
+		readerFile = flags.Arg(1)
+	}
+
+	writer, err := ioutil.ReadFile(writerFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading file %q - %v\n", writerFile, err)
+		os.Exit(2)
+	}
+	reader, err := ioutil.ReadFile(readerFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading file %q - %v\n", readerFile, err)
+		os.Exit(2)
+	}
+
+	program, err := compiler.CompileSchemaBytes(writer, reader)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error compiling %q to read data written with %q - %v\n", readerFile, writerFile, err)
+		os.Exit(3)
+	}
+	fmt.Print(program.Disassemble())
+}
@@ -12,11 +12,16 @@ import (
 )
 
 func main() {
-	cfg := parseCmdLine()
+	if len(os.Args) > 1 && os.Args[1] == "disasm" {
+		disasm(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "concat" {
+		concat(os.Args[2:])
+		return
+	}
 
-	var err error
-	pkg := generator.NewPackage(cfg.packageName)
-	namespace := schema.NewNamespace(cfg.shortUnions)
+	cfg := parseCmdLine()
 
 	switch cfg.namespacedNames {
 	case nsShort:
@@ -25,6 +30,15 @@ func main() {
 		generator.SetNamer(generator.NewNamespaceNamer(false))
 	}
 
+	if cfg.versions {
+		generateVersions(cfg)
+		return
+	}
+
+	var err error
+	pkg := generator.NewPackage(cfg.packageName)
+	namespace := schema.NewNamespace(cfg.shortUnions)
+
 	for _, fileName := range cfg.files {
 		schema, err := ioutil.ReadFile(fileName)
 		if err != nil {
@@ -45,6 +59,14 @@ func main() {
 		os.Exit(4)
 	}
 
+	if cfg.precompile {
+		err = addPrecompiledPrograms(namespace, pkg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error precompiling deserializer programs - %v\n", err)
+			os.Exit(4)
+		}
+	}
+
 	err = pkg.WriteFiles(cfg.targetDir)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error writing source files to directory %q - %v\n", cfg.targetDir, err)
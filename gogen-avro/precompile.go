@@ -0,0 +1,36 @@
+package main
+
+import (
+	"github.com/actgardner/gogen-avro/compiler"
+	"github.com/actgardner/gogen-avro/generator"
+	"github.com/actgardner/gogen-avro/schema"
+)
+
+// addPrecompiledPrograms compiles the program which deserializes each record with its own schema,
+// and embeds it in the generated code.
+func addPrecompiledPrograms(namespace *schema.Namespace, pkg *generator.Package) error {
+	for name, def := range namespace.Definitions {
+		record, ok := def.(*schema.RecordDefinition)
+		// Aliases are registered as additional names for the same definition, skip them
+		if !ok || record.AvroName() != name {
+			continue
+		}
+
+		ref := schema.NewReference(name)
+		if err := ref.ResolveReferences(namespace); err != nil {
+			return err
+		}
+
+		program, err := compiler.Compile(ref, ref)
+		if err != nil {
+			return err
+		}
+
+		programBytes, err := program.MarshalBinary()
+		if err != nil {
+			return err
+		}
+		record.AddPrecompiledProgram(pkg, programBytes)
+	}
+	return nil
+}
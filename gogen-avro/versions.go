@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"go/build"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/actgardner/gogen-avro/generator"
+	"github.com/actgardner/gogen-avro/schema"
+)
+
+// generateVersions generates a package for each version of a schema, v1 for the first file, v2 for the second
+// and so on. The package of each version after the first has a function converting the previous version into it.
+func generateVersions(cfg config) {
+	var previous schema.AvroType
+	var previousImport string
+	for i, fileName := range cfg.files {
+		version := fmt.Sprintf("v%v", i+1)
+		targetDir := filepath.Join(cfg.targetDir, version)
+		pkg := generator.NewPackage(version)
+		namespace := schema.NewNamespace(cfg.shortUnions)
+
+		s, err := ioutil.ReadFile(fileName)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading file %q - %v\n", fileName, err)
+			os.Exit(2)
+		}
+
+		avroType, err := namespace.TypeForSchema(s)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error decoding schema for file %q - %v\n", fileName, err)
+			os.Exit(3)
+		}
+
+		err = namespace.AddToPackage(pkg, codegenComment([]string{fileName}))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error generating code for schema - %v\n", err)
+			os.Exit(4)
+		}
+
+		if cfg.precompile {
+			err = addPrecompiledPrograms(namespace, pkg)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error precompiling deserializer programs - %v\n", err)
+				os.Exit(4)
+			}
+		}
+
+		if previous != nil {
+			converter := schema.NewConverter(pkg, fmt.Sprintf("v%v", i), previousImport)
+			err = converter.AddConversion(fmt.Sprintf("ConvertV%vToV%v", i, i+1), previous, avroType)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error generating the conversion from %q to %q - %v\n", cfg.files[i-1], fileName, err)
+				os.Exit(4)
+			}
+			pkg.AddHeader("convert.go", codegenComment(cfg.files[i-1:i+1]))
+		}
+
+		err = os.MkdirAll(targetDir, 0755)
+		if err == nil {
+			err = pkg.WriteFiles(targetDir)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing source files to directory %q - %v\n", targetDir, err)
+			os.Exit(4)
+		}
+
+		if i+1 < len(cfg.files) {
+			previousImport, err = importPath(targetDir)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error finding the import path of %q - %v\n", targetDir, err)
+				os.Exit(4)
+			}
+		}
+		previous = avroType
+	}
+}
+
+// importPath finds the Go import path of a directory, from the go.mod file of its module or from GOPATH
+func importPath(dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+
+	for root := dir; ; root = filepath.Dir(root) {
+		if module, ok := moduleName(filepath.Join(root, "go.mod")); ok {
+			rel, err := filepath.Rel(root, dir)
+			if err != nil {
+				return "", err
+			}
+			return strings.TrimSuffix(module+"/"+filepath.ToSlash(rel), "/."), nil
+		}
+		if filepath.Dir(root) == root {
+			break
+		}
+	}
+
+	for _, gopath := range filepath.SplitList(build.Default.GOPATH) {
+		src := filepath.Join(gopath, "src") + string(filepath.Separator)
+		if strings.HasPrefix(dir, src) {
+			return filepath.ToSlash(strings.TrimPrefix(dir, src)), nil
+		}
+	}
+	return "", fmt.Errorf("the directory is not in a Go module or in GOPATH")
+}
+
+// The module path declared in a go.mod file
+func moduleName(goMod string) (string, bool) {
+	f, err := os.Open(goMod)
+	if err != nil {
+		return "", false
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "module ") {
+			return strings.Trim(strings.TrimSpace(strings.TrimPrefix(line, "module ")), `"`), true
+		}
+	}
+	return "", false
+}
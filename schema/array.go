@@ -25,23 +25,26 @@ func %v(r %v, w io.Writer) error {
 const arrayWrapperTemplate = `
 type %[1]v %[2]v
 
-func (_ *%[1]v) SetBoolean(v bool) { panic("Unsupported operation") }
-func (_ *%[1]v) SetInt(v int32) { panic("Unsupported operation") }
-func (_ *%[1]v) SetLong(v int64) { panic("Unsupported operation") }
-func (_ *%[1]v) SetFloat(v float32) { panic("Unsupported operation") }
-func (_ *%[1]v) SetDouble(v float64) { panic("Unsupported operation") }
-func (_ *%[1]v) SetBytes(v []byte) { panic("Unsupported operation") }
-func (_ *%[1]v) SetString(v string) { panic("Unsupported operation") }
-func (_ *%[1]v) SetUnionElem(v int64) { panic("Unsupported operation") }
-func (_ *%[1]v) Get(i int) types.Field { panic("Unsupported operation") }
-func (_ *%[1]v) AppendMap(key string) types.Field { panic("Unsupported operation") }
+func (_ *%[1]v) SetBoolean(v bool) error { return &types.FieldError{Field: "%[1]v", Op: types.OpAssign, Value: "boolean"} }
+func (_ *%[1]v) SetInt(v int32) error { return &types.FieldError{Field: "%[1]v", Op: types.OpAssign, Value: "int"} }
+func (_ *%[1]v) SetLong(v int64) error { return &types.FieldError{Field: "%[1]v", Op: types.OpAssign, Value: "long"} }
+func (_ *%[1]v) SetFloat(v float32) error { return &types.FieldError{Field: "%[1]v", Op: types.OpAssign, Value: "float"} }
+func (_ *%[1]v) SetDouble(v float64) error { return &types.FieldError{Field: "%[1]v", Op: types.OpAssign, Value: "double"} }
+func (_ *%[1]v) SetBytes(v []byte) error { return &types.FieldError{Field: "%[1]v", Op: types.OpAssign, Value: "bytes"} }
+func (_ *%[1]v) SetString(v string) error { return &types.FieldError{Field: "%[1]v", Op: types.OpAssign, Value: "string"} }
+func (_ *%[1]v) Get(i int) (types.Field, error) { return nil, &types.FieldError{Field: "%[1]v", Op: types.OpGet, Index: i} }
+func (_ *%[1]v) AppendMap(key string) (types.Field, error) { return nil, &types.FieldError{Field: "%[1]v", Op: types.OpAppendMap} }
 func (_ *%[1]v) Finalize() { }
-func (_ *%[1]v) SetDefault(i int) { panic("Unsupported operation") }
-func (r *%[1]v) AppendArray() types.Field {
+func (_ *%[1]v) SetDefault(i int) error { return &types.FieldError{Field: "%[1]v", Op: types.OpSetDefault, Index: i} }
+func (r *%[1]v) AppendArray() (types.Field, error) {
 	var v %[3]v
-        %[5]v
+	// Reuse the element left over from a previous decode, if there is one
+	if len(*r) < cap(*r) {
+		v = (*r)[:len(*r)+1][len(*r)]
+	}
+	%[5]v
 	*r = append(*r, v)
-	return %[4]v
+	return %[4]v, nil
 }
 `
 
@@ -147,11 +150,8 @@ func (s *ArrayField) SimpleName() string {
 }
 
 func (s *ArrayField) appendMethodDef() string {
-	constructElem := ""
+	constructElem := reuseOrConstruct("v", s.itemType)
 	ret := ""
-	if constructor, ok := getConstructableForType(s.itemType); ok {
-		constructElem = fmt.Sprintf("v = %v\n", constructor.ConstructorMethod())
-	}
 	if s.itemType.WrapperType() != "" {
 		ret = fmt.Sprintf("(*%v)(&(*r)[len(*r)-1])", s.itemType.WrapperType())
 	} else {
@@ -1,5 +1,9 @@
 package schema
 
+import (
+	"fmt"
+)
+
 type Constructable interface {
 	ConstructorMethod() string
 }
@@ -15,3 +19,26 @@ func getConstructableForType(t AvroType) (Constructable, bool) {
 	}
 	return nil, false
 }
+
+// Generate the code which prepares `lvalue` to be decoded into by the VM.
+// Nil values are constructed, existing values are reset so they (and their
+// capacity) can be reused.
+func reuseOrConstruct(lvalue string, t AvroType) string {
+	constructor, ok := getConstructableForType(t)
+	if !ok {
+		return ""
+	}
+
+	reset := ""
+	switch t.(type) {
+	case *ArrayField:
+		reset = fmt.Sprintf("%v = %v[:0]", lvalue, lvalue)
+	case *MapField:
+		reset = fmt.Sprintf("%v.reset()", lvalue)
+	}
+
+	if reset == "" {
+		return fmt.Sprintf("if %v == nil {\n%v = %v\n}\n", lvalue, lvalue, constructor.ConstructorMethod())
+	}
+	return fmt.Sprintf("if %v == nil {\n%v = %v\n} else {\n%v\n}\n", lvalue, lvalue, constructor.ConstructorMethod(), reset)
+}
@@ -0,0 +1,347 @@
+package schema
+
+import (
+	"fmt"
+
+	"github.com/actgardner/gogen-avro/generator"
+)
+
+const convertFile = "convert.go"
+
+const convertFunctionTemplate = `
+// %[1]v converts %[2]v from the %[3]v package into %[4]v, following the rules for reading data
+// written with the %[3]v schema: fields which were removed are dropped, new fields get their default values,
+// enums are mapped by symbol and union values become the first branch of the new union which can hold them.
+func %[1]v(in %[2]v) (%[4]v, error) {
+	return %[5]v(in)
+}
+`
+
+const convertRecordTemplate = `
+func %[1]v(in %[2]v) (out %[3]v, err error) {
+	if in == nil {
+		return nil, nil
+	}
+	out = %[4]v
+%[5]v
+	return out, nil
+}
+`
+
+const convertEnumTemplate = `
+func %[1]v(in %[2]v) (out %[3]v, err error) {
+	switch in {
+%[4]v
+	}
+	return out, fmt.Errorf("Unable to convert %[5]v: symbol %%v is not in the new schema", in)
+}
+`
+
+const convertFixedTemplate = `
+func %[1]v(in %[2]v) (out %[3]v, err error) {
+	return %[3]v(in), nil
+}
+`
+
+const convertArrayTemplate = `
+func %[1]v(in %[2]v) (out %[3]v, err error) {
+	if in == nil {
+		return nil, nil
+	}
+	out = make(%[3]v, len(in))
+	for i, v := range in {
+%[4]v
+	}
+	return out, nil
+}
+`
+
+const convertMapTemplate = `
+func %[1]v(in %[2]v) (out %[3]v, err error) {
+	if in == nil {
+		return nil, nil
+	}
+	out = %[4]v
+	for k, v := range in.M {
+		var item %[5]v
+%[6]v
+		out.M[k] = item
+	}
+	return out, nil
+}
+`
+
+const convertFromUnionTemplate = `
+func %[1]v(in %[2]v) (out %[3]v, err error) {
+	if in == nil {
+		return
+	}
+	switch in.UnionType {
+%[4]v
+	}
+	return out, fmt.Errorf("Unable to convert %[5]v: type %%v is not in the new schema", in.UnionType)
+}
+`
+
+const convertToUnionTemplate = `
+func %[1]v(in %[2]v) (out %[3]v, err error) {
+	out = %[4]v
+	out.UnionType = %[5]v
+%[6]v
+	return out, nil
+}
+`
+
+// A Converter generates functions which convert the structs generated for one version of a schema
+// into the structs generated for the next version, in the package of the next version.
+// The conversions follow the rules the compiler uses to read data written with the older schema.
+type Converter struct {
+	p *generator.Package
+	// The name and import path of the package generated for the older version
+	fromPackage string
+	fromImport  string
+	// The names of the functions already generated
+	functions map[string]bool
+}
+
+func NewConverter(p *generator.Package, fromPackage, fromImport string) *Converter {
+	return &Converter{
+		p:           p,
+		fromPackage: fromPackage,
+		fromImport:  fromImport,
+		functions:   make(map[string]bool),
+	}
+}
+
+// AddConversion generates the function `name`, which converts a value of type `from` in the
+// older package into a value of type `to`.
+func (c *Converter) AddConversion(name string, from, to AvroType) error {
+	function, err := c.function(from, to)
+	if err != nil {
+		return err
+	}
+	c.p.AddImport(convertFile, c.fromImport)
+	c.p.AddFunction(convertFile, "", name, fmt.Sprintf(convertFunctionTemplate, name, c.fromGoType(from), c.fromPackage, c.toGoType(to), function))
+	return nil
+}
+
+func isPrimitive(t AvroType) bool {
+	switch t.(type) {
+	case *NullField, *BoolField, *IntField, *LongField, *FloatField, *DoubleField, *StringField, *BytesField:
+		return true
+	}
+	return false
+}
+
+// The Go type of a value in the older package
+func (c *Converter) fromGoType(t AvroType) string {
+	if isPrimitive(t) {
+		return c.toGoType(t)
+	}
+	if array, ok := t.(*ArrayField); ok {
+		return "[]" + c.fromGoType(array.ItemType())
+	}
+	goType := t.GoType()
+	if goType[0] == '*' {
+		return "*" + c.fromPackage + "." + goType[1:]
+	}
+	return c.fromPackage + "." + goType
+}
+
+// The Go type of a value in the generated package
+func (c *Converter) toGoType(t AvroType) string {
+	if _, ok := t.(*NullField); ok {
+		c.p.AddImport(convertFile, "github.com/actgardner/gogen-avro/vm/types")
+	}
+	return t.GoType()
+}
+
+// Generate the statements which convert `in` of type from, and assign it to `lvalue` of type to
+func (c *Converter) assign(lvalue, in string, from, to AvroType) (string, error) {
+	_, fromUnion := from.(*UnionField)
+	_, toUnion := to.(*UnionField)
+	if !fromUnion && !toUnion && isPrimitive(from) {
+		if !from.IsReadableBy(to) {
+			return "", fmt.Errorf("Incompatible types: %v %v", to, from)
+		}
+		switch to.(type) {
+		case *NullField:
+			return "", nil
+		case *LongField, *FloatField, *DoubleField, *StringField, *BytesField:
+			return fmt.Sprintf("%v = %v(%v)", lvalue, to.GoType(), in), nil
+		}
+		return fmt.Sprintf("%v = %v", lvalue, in), nil
+	}
+
+	function, err := c.function(from, to)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("if %v, err = %v(%v); err != nil {\nreturn\n}", lvalue, function, in), nil
+}
+
+// Generate the function which converts a value of type from into to, and return its name
+func (c *Converter) function(from, to AvroType) (string, error) {
+	name := fmt.Sprintf("convert%v%vTo%v", generator.ToPublicName(c.fromPackage), from.Name(), to.Name())
+	if c.functions[name] {
+		return name, nil
+	}
+	// Register the function before generating it, so recursive types refer to it
+	c.functions[name] = true
+
+	var def string
+	var err error
+	if fromUnion, ok := from.(*UnionField); ok {
+		def, err = c.fromUnion(name, fromUnion, to)
+	} else if toUnion, ok := to.(*UnionField); ok {
+		def, err = c.toUnion(name, from, toUnion)
+	} else if !from.IsReadableBy(to) {
+		err = fmt.Errorf("Incompatible types: %v %v", to, from)
+	} else {
+		switch v := from.(type) {
+		case *Reference:
+			def, err = c.fromReference(name, v, to.(*Reference))
+		case *ArrayField:
+			def, err = c.array(name, v, to.(*ArrayField))
+		case *MapField:
+			def, err = c.mapField(name, v, to.(*MapField))
+		default:
+			err = fmt.Errorf("Unsupported type: %v", from)
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+	c.p.AddFunction(convertFile, "", name, def)
+	return name, nil
+}
+
+func (c *Converter) fromReference(name string, from, to *Reference) (string, error) {
+	switch v := from.Def.(type) {
+	case *RecordDefinition:
+		return c.record(name, v, to.Def.(*RecordDefinition))
+	case *EnumDefinition:
+		return c.enum(name, v, to.Def.(*EnumDefinition)), nil
+	case *FixedDefinition:
+		return fmt.Sprintf(convertFixedTemplate, name, c.fromGoType(from), c.toGoType(to)), nil
+	}
+	return "", fmt.Errorf("Unsupported reference type %v", from)
+}
+
+func (c *Converter) record(name string, from, to *RecordDefinition) (string, error) {
+	body := ""
+	for _, field := range to.Fields() {
+		if from.GetReaderField(field) != nil {
+			continue
+		}
+		if !field.HasDefault() {
+			return "", fmt.Errorf("Incompatible schemas: field %v in reader is not present in writer and has no default value", field.Name())
+		}
+		lvalue := "out." + field.GoName()
+		// Unions construct themselves in their default value
+		if _, ok := field.Type().(*UnionField); !ok {
+			if constructor, ok := getConstructableForType(field.Type()); ok {
+				body += fmt.Sprintf("%v = %v\n", lvalue, constructor.ConstructorMethod())
+			}
+		}
+		def, err := field.Type().DefaultValue(lvalue, field.Default())
+		if err != nil {
+			return "", err
+		}
+		body += def + "\n"
+	}
+
+	for _, field := range from.Fields() {
+		toField := to.GetReaderField(field)
+		if toField == nil {
+			continue
+		}
+		assignment, err := c.assign("out."+toField.GoName(), "in."+field.GoName(), field.Type(), toField.Type())
+		if err != nil {
+			return "", err
+		}
+		body += assignment + "\n"
+	}
+	return fmt.Sprintf(convertRecordTemplate, name, c.fromGoType(&Reference{Def: from}), to.GoType(), to.ConstructorMethod(), body), nil
+}
+
+func (c *Converter) enum(name string, from, to *EnumDefinition) string {
+	cases := ""
+	for _, symbol := range from.Symbols() {
+		for _, toSymbol := range to.Symbols() {
+			if symbol == toSymbol {
+				cases += fmt.Sprintf("case %v.%v:\nreturn %v, nil\n", c.fromPackage, from.symbolConstant(symbol), to.symbolConstant(symbol))
+			}
+		}
+	}
+	c.p.AddImport(convertFile, "fmt")
+	return fmt.Sprintf(convertEnumTemplate, name, c.fromGoType(&Reference{Def: from}), to.GoType(), cases, to.AvroName())
+}
+
+func (c *Converter) array(name string, from, to *ArrayField) (string, error) {
+	assignment, err := c.assign("out[i]", "v", from.ItemType(), to.ItemType())
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf(convertArrayTemplate, name, c.fromGoType(from), c.toGoType(to), assignment), nil
+}
+
+func (c *Converter) mapField(name string, from, to *MapField) (string, error) {
+	assignment, err := c.assign("item", "v", from.ItemType(), to.ItemType())
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf(convertMapTemplate, name, c.fromGoType(from), c.toGoType(to), to.ConstructorMethod(), c.toGoType(to.ItemType()), assignment), nil
+}
+
+// Convert each branch of a union into the first type of the new union which can read it, or into the new type
+func (c *Converter) fromUnion(name string, from *UnionField, to AvroType) (string, error) {
+	cases := ""
+	for _, t := range from.AvroTypes() {
+		var target AvroType
+		var setType string
+		if toUnion, ok := to.(*UnionField); ok {
+			for _, r := range toUnion.AvroTypes() {
+				if t.IsReadableBy(r) {
+					target = r
+					setType = fmt.Sprintf("out = %v\nout.UnionType = %v\n", toUnion.ConstructorMethod(), toUnion.unionEnumType()+r.Name())
+					break
+				}
+			}
+		} else if t.IsReadableBy(to) {
+			target = to
+		}
+		if target == nil {
+			continue
+		}
+
+		lvalue := "out"
+		if setType != "" {
+			lvalue = "out." + target.Name()
+		}
+		assignment, err := c.assign(lvalue, "in."+t.Name(), t, target)
+		if err != nil {
+			return "", err
+		}
+		cases += fmt.Sprintf("case %v.%v:\n%v%v\nreturn\n", c.fromPackage, from.unionEnumType()+t.Name(), setType, assignment)
+	}
+	if cases == "" {
+		return "", fmt.Errorf("Incompatible types: %v %v", to, from)
+	}
+	c.p.AddImport(convertFile, "fmt")
+	return fmt.Sprintf(convertFromUnionTemplate, name, c.fromGoType(from), c.toGoType(to), cases, from.Name()), nil
+}
+
+// Convert a value into the first type of the new union which can read it
+func (c *Converter) toUnion(name string, from AvroType, to *UnionField) (string, error) {
+	for _, r := range to.AvroTypes() {
+		if from.IsReadableBy(r) {
+			assignment, err := c.assign("out."+r.Name(), "in", from, r)
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf(convertToUnionTemplate, name, c.fromGoType(from), c.toGoType(to), to.ConstructorMethod(), to.unionEnumType()+r.Name(), assignment), nil
+		}
+	}
+	return "", fmt.Errorf("Incompatible types: %v %v", to, from)
+}
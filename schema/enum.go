@@ -69,10 +69,15 @@ func (e *EnumDefinition) GoType() string {
 	return generator.ToPublicName(e.name.Name)
 }
 
+// The name of the generated constant for an enum symbol
+func (e *EnumDefinition) symbolConstant(symbol string) string {
+	return generator.ToPublicName(e.GoType() + strings.Title(symbol))
+}
+
 func (e *EnumDefinition) typeList() string {
 	typeStr := ""
 	for i, t := range e.symbols {
-		typeStr += fmt.Sprintf("%v %v = %v\n", generator.ToPublicName(e.GoType()+strings.Title(t)), e.GoType(), i)
+		typeStr += fmt.Sprintf("%v %v = %v\n", e.symbolConstant(t), e.GoType(), i)
 	}
 	return typeStr
 }
@@ -80,7 +85,7 @@ func (e *EnumDefinition) typeList() string {
 func (e *EnumDefinition) stringerList() string {
 	stringerStr := ""
 	for _, t := range e.symbols {
-		stringerStr += fmt.Sprintf("case %v:\n return %q\n", generator.ToPublicName(e.GoType()+strings.Title(t)), t)
+		stringerStr += fmt.Sprintf("case %v:\n return %q\n", e.symbolConstant(t), t)
 	}
 	return stringerStr
 }
@@ -140,7 +145,7 @@ func (s *EnumDefinition) DefaultValue(lvalue string, rvalue interface{}) (string
 		return "", fmt.Errorf("Expected string as default for field %v, got %q", lvalue, rvalue)
 	}
 
-	return fmt.Sprintf("%v = %v", lvalue, generator.ToPublicName(s.GoType()+strings.Title(rvalue.(string)))), nil
+	return fmt.Sprintf("%v = %v", lvalue, s.symbolConstant(rvalue.(string))), nil
 }
 
 func (s *EnumDefinition) IsReadableBy(d Definition) bool {
@@ -151,3 +156,7 @@ func (s *EnumDefinition) IsReadableBy(d Definition) bool {
 func (s *EnumDefinition) WrapperType() string {
 	return "types.Int"
 }
+
+func (e *EnumDefinition) Symbols() []string {
+	return e.symbols
+}
@@ -16,21 +16,21 @@ func %v(r %v, w io.Writer) error {
 const fixedFieldTemplate = `
 type %[1]v %[2]v
 
-func (_ *%[1]v) SetBoolean(v bool) { panic("Unsupported operation") }
-func (_ *%[1]v) SetInt(v int32) { panic("Unsupported operation") }
-func (_ *%[1]v) SetLong(v int64) { panic("Unsupported operation") }
-func (_ *%[1]v) SetFloat(v float32) { panic("Unsupported operation") }
-func (_ *%[1]v) SetDouble(v float64) { panic("Unsupported operation") }
-func (r *%[1]v) SetBytes(v []byte) { 
+func (_ *%[1]v) SetBoolean(v bool) error { return &types.FieldError{Field: "%[2]v", Op: types.OpAssign, Value: "boolean"} }
+func (_ *%[1]v) SetInt(v int32) error { return &types.FieldError{Field: "%[2]v", Op: types.OpAssign, Value: "int"} }
+func (_ *%[1]v) SetLong(v int64) error { return &types.FieldError{Field: "%[2]v", Op: types.OpAssign, Value: "long"} }
+func (_ *%[1]v) SetFloat(v float32) error { return &types.FieldError{Field: "%[2]v", Op: types.OpAssign, Value: "float"} }
+func (_ *%[1]v) SetDouble(v float64) error { return &types.FieldError{Field: "%[2]v", Op: types.OpAssign, Value: "double"} }
+func (r *%[1]v) SetBytes(v []byte) error {
 	copy((*r)[:], v)
+	return nil
 }
-func (_ *%[1]v) SetString(v string) { panic("Unsupported operation") }
-func (_ *%[1]v) SetUnionElem(v int64) { panic("Unsupported operation") }
-func (_ *%[1]v) Get(i int) types.Field { panic("Unsupported operation") }
-func (_ *%[1]v) AppendMap(key string) types.Field { panic("Unsupported operation") }
-func (_ *%[1]v) AppendArray() types.Field { panic("Unsupported operation") }
+func (_ *%[1]v) SetString(v string) error { return &types.FieldError{Field: "%[2]v", Op: types.OpAssign, Value: "string"} }
+func (_ *%[1]v) Get(i int) (types.Field, error) { return nil, &types.FieldError{Field: "%[2]v", Op: types.OpGet, Index: i} }
+func (_ *%[1]v) AppendMap(key string) (types.Field, error) { return nil, &types.FieldError{Field: "%[2]v", Op: types.OpAppendMap} }
+func (_ *%[1]v) AppendArray() (types.Field, error) { return nil, &types.FieldError{Field: "%[2]v", Op: types.OpAppendArray} }
 func (_ *%[1]v) Finalize() { }
-func (_ *%[1]v) SetDefault(i int) { panic("Unsupported operation") }
+func (_ *%[1]v) SetDefault(i int) error { return &types.FieldError{Field: "%[2]v", Op: types.OpSetDefault, Index: i} }
 `
 
 type FixedDefinition struct {
@@ -41,16 +41,15 @@ func New%[1]v() *%[1]v {
 	}
 }
 
-func (_ *%[1]v) SetBoolean(v bool) { panic("Unsupported operation") }
-func (_ *%[1]v) SetInt(v int32) { panic("Unsupported operation") }
-func (_ *%[1]v) SetLong(v int64) { panic("Unsupported operation") }
-func (_ *%[1]v) SetFloat(v float32) { panic("Unsupported operation") }
-func (_ *%[1]v) SetDouble(v float64) { panic("Unsupported operation") }
-func (_ *%[1]v) SetBytes(v []byte) { panic("Unsupported operation") }
-func (_ *%[1]v) SetString(v string) { panic("Unsupported operation") }
-func (_ *%[1]v) SetUnionElem(v int64) { panic("Unsupported operation") }
-func (_ *%[1]v) Get(i int) types.Field { panic("Unsupported operation") }
-func (_ *%[1]v) SetDefault(i int) { panic("Unsupported operation") }
+func (_ *%[1]v) SetBoolean(v bool) error { return &types.FieldError{Field: "%[1]v", Op: types.OpAssign, Value: "boolean"} }
+func (_ *%[1]v) SetInt(v int32) error { return &types.FieldError{Field: "%[1]v", Op: types.OpAssign, Value: "int"} }
+func (_ *%[1]v) SetLong(v int64) error { return &types.FieldError{Field: "%[1]v", Op: types.OpAssign, Value: "long"} }
+func (_ *%[1]v) SetFloat(v float32) error { return &types.FieldError{Field: "%[1]v", Op: types.OpAssign, Value: "float"} }
+func (_ *%[1]v) SetDouble(v float64) error { return &types.FieldError{Field: "%[1]v", Op: types.OpAssign, Value: "double"} }
+func (_ *%[1]v) SetBytes(v []byte) error { return &types.FieldError{Field: "%[1]v", Op: types.OpAssign, Value: "bytes"} }
+func (_ *%[1]v) SetString(v string) error { return &types.FieldError{Field: "%[1]v", Op: types.OpAssign, Value: "string"} }
+func (_ *%[1]v) Get(i int) (types.Field, error) { return nil, &types.FieldError{Field: "%[1]v", Op: types.OpGet, Index: i} }
+func (_ *%[1]v) SetDefault(i int) error { return &types.FieldError{Field: "%[1]v", Op: types.OpSetDefault, Index: i} }
 func (r *%[1]v) Finalize() { 
 	for i := range r.keys {
 		r.M[r.keys[i]] = r.values[i]
@@ -59,15 +58,22 @@ func (r *%[1]v) Finalize() {
 	r.values = nil
 }
 
-func (r *%[1]v) AppendMap(key string) types.Field { 
+// Remove all the entries from the map before it's decoded into again, keeping the allocated space
+func (r *%[1]v) reset() {
+	for k := range r.M {
+		delete(r.M, k)
+	}
+}
+
+func (r *%[1]v) AppendMap(key string) (types.Field, error) {
 	r.keys = append(r.keys, key)
 	var v %[3]v
-        %[5]v
+	%[5]v
 	r.values = append(r.values, v)
-	return %[4]v
+	return %[4]v, nil
 }
 
-func (_ *%[1]v) AppendArray() types.Field { panic("Unsupported operation") }
+func (_ *%[1]v) AppendArray() (types.Field, error) { return nil, &types.FieldError{Field: "%[1]v", Op: types.OpAppendArray} }
 `
 
 type MapField struct {
@@ -166,11 +172,8 @@ func (s *MapField) IsReadableBy(f AvroType) bool {
 }
 
 func (s *MapField) appendMethodDef() string {
-	constructElem := ""
+	constructElem := reuseOrConstruct("v", s.itemType)
 	ret := ""
-	if constructor, ok := getConstructableForType(s.itemType); ok {
-		constructElem = fmt.Sprintf("v = %v\n", constructor.ConstructorMethod())
-	}
 	if s.itemType.WrapperType() != "" {
 		ret = fmt.Sprintf("(*%v)(&r.values[len(r.values)-1])", s.itemType.WrapperType())
 	} else {
@@ -0,0 +1,217 @@
+package schema
+
+import (
+	"fmt"
+	"strings"
+)
+
+/*
+  Projections of record schemas onto a subset of their fields.
+
+  A path names a field by its Avro name, with nested record fields separated by dots.
+  A field which is an array or map is followed by `[]` to select fields of its items or values,
+  and paths pass through unions into any branch which has the field. For example
+  `user.address.city` or `items[].sku`. A path which ends at a field selects all of it.
+*/
+
+// The fields needed from a named record, collected from all the paths which reach it
+type recordProjection struct {
+	all    bool
+	fields map[string]bool
+}
+
+type projector struct {
+	needs map[QualifiedName]*recordProjection
+	built map[QualifiedName]*RecordDefinition
+}
+
+// Project builds a reader schema for `writer` which only has the fields at the given paths,
+// so compiling it with the writer schema gives a program which skips all the other fields.
+// Named records used in several places are projected onto all the fields needed from them.
+func Project(writer AvroType, paths []string) (AvroType, error) {
+	if _, ok := recordDefinition(writer); !ok {
+		return nil, fmt.Errorf("Unable to project %v: only records can be projected", writer.Name())
+	}
+
+	p := &projector{
+		needs: make(map[QualifiedName]*recordProjection),
+		built: make(map[QualifiedName]*RecordDefinition),
+	}
+	for _, path := range paths {
+		if path == "" {
+			return nil, fmt.Errorf("Invalid projection path: empty path")
+		}
+		if err := p.walk(writer, strings.Split(path, ".")); err != nil {
+			return nil, fmt.Errorf("Invalid projection path %q: %v", path, err)
+		}
+	}
+	return p.build(writer), nil
+}
+
+func recordDefinition(t AvroType) (*RecordDefinition, bool) {
+	if ref, ok := t.(*Reference); ok {
+		def, ok := ref.Def.(*RecordDefinition)
+		return def, ok
+	}
+	return nil, false
+}
+
+func (p *projector) need(def *RecordDefinition) *recordProjection {
+	need, ok := p.needs[def.AvroName()]
+	if !ok {
+		need = &recordProjection{fields: make(map[string]bool)}
+		p.needs[def.AvroName()] = need
+	}
+	return need
+}
+
+// Mark the fields selected by the remaining path segments, starting at a value of type t
+func (p *projector) walk(t AvroType, segments []string) error {
+	if len(segments) == 0 {
+		p.selectAll(t)
+		return nil
+	}
+
+	if union, ok := t.(*UnionField); ok {
+		found := false
+		for _, branch := range union.AvroTypes() {
+			if p.hasPath(branch, segments[0]) {
+				if err := p.walk(branch, segments); err != nil {
+					return err
+				}
+				found = true
+			}
+		}
+		if !found {
+			return fmt.Errorf("no branch of %v has field %q", union.Name(), segments[0])
+		}
+		return nil
+	}
+
+	def, ok := recordDefinition(t)
+	if !ok {
+		return fmt.Errorf("%v is not a record", t.Name())
+	}
+
+	name := strings.TrimRight(segments[0], "[]")
+	field := def.FieldByName(name)
+	if field == nil {
+		return fmt.Errorf("record %v has no field %q", def.AvroName(), name)
+	}
+	p.need(def).fields[field.Name()] = true
+
+	fieldType := field.Type()
+	for items := segments[0][len(name):]; items != ""; items = items[2:] {
+		if !strings.HasPrefix(items, "[]") {
+			return fmt.Errorf("invalid field %q", segments[0])
+		}
+		var err error
+		if fieldType, err = itemType(fieldType); err != nil {
+			return err
+		}
+	}
+	return p.walk(fieldType, segments[1:])
+}
+
+// Whether a union branch can be followed by a path starting with segment
+func (p *projector) hasPath(t AvroType, segment string) bool {
+	def, ok := recordDefinition(t)
+	return ok && def.FieldByName(strings.TrimRight(segment, "[]")) != nil
+}
+
+// The item type of an array or map, or of the array and map branches of a union
+func itemType(t AvroType) (AvroType, error) {
+	switch v := t.(type) {
+	case *ArrayField:
+		return v.ItemType(), nil
+	case *MapField:
+		return v.ItemType(), nil
+	case *UnionField:
+		for _, branch := range v.AvroTypes() {
+			if item, err := itemType(branch); err == nil {
+				return item, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("%v is not an array or map", t.Name())
+}
+
+// Mark every field of t, and of all the records nested in it
+func (p *projector) selectAll(t AvroType) {
+	switch v := t.(type) {
+	case *ArrayField:
+		p.selectAll(v.ItemType())
+	case *MapField:
+		p.selectAll(v.ItemType())
+	case *UnionField:
+		for _, branch := range v.AvroTypes() {
+			p.selectAll(branch)
+		}
+	case *Reference:
+		def, ok := v.Def.(*RecordDefinition)
+		if !ok {
+			return
+		}
+		need := p.need(def)
+		if need.all {
+			return
+		}
+		need.all = true
+		for _, f := range def.Fields() {
+			p.selectAll(f.Type())
+		}
+	}
+}
+
+// Build the reader type for t, containing only the marked fields
+func (p *projector) build(t AvroType) AvroType {
+	switch v := t.(type) {
+	case *ArrayField:
+		return NewArrayField(p.build(v.ItemType()), copyDefinition(v.definition))
+	case *MapField:
+		return NewMapField(p.build(v.ItemType()), copyDefinition(v.definition))
+	case *UnionField:
+		branches := make([]AvroType, len(v.AvroTypes()))
+		for i, branch := range v.AvroTypes() {
+			branches[i] = p.build(branch)
+		}
+		return NewUnionField(v.name, branches, make([]interface{}, len(branches)))
+	case *Reference:
+		def, ok := v.Def.(*RecordDefinition)
+		if !ok {
+			return v
+		}
+		return &Reference{TypeName: v.TypeName, Def: p.buildRecord(def)}
+	}
+	return t
+}
+
+func (p *projector) buildRecord(def *RecordDefinition) *RecordDefinition {
+	if projected, ok := p.built[def.AvroName()]; ok {
+		return projected
+	}
+
+	// Register the projection before building the fields, so recursive types refer to it
+	projected := NewRecordDefinition(def.AvroName(), def.Aliases(), nil, def.doc, copyDefinition(def.metadata))
+	p.built[def.AvroName()] = projected
+
+	need := p.need(def)
+	fields := make([]*Field, 0)
+	for _, f := range def.Fields() {
+		if !need.all && !need.fields[f.Name()] {
+			continue
+		}
+		fields = append(fields, NewField(f.Name(), p.build(f.Type()), f.defValue, f.hasDef, f.aliases, f.doc, copyDefinition(f.definition), len(fields), f.fieldTags))
+	}
+	projected.fields = fields
+	return projected
+}
+
+// Copy a definition, so the Definition methods of the projected types don't modify the original
+func copyDefinition(definition map[string]interface{}) map[string]interface{} {
+	copied := make(map[string]interface{}, len(definition))
+	for k, v := range definition {
+		copied[k] = v
+	}
+	return copied
+}
@@ -40,21 +40,47 @@ func (r %v) Serialize(w io.Writer) error {
 const recordStructPublicDeserializerTemplate = `
 func %v(r io.Reader) (%v, error) {
 	t := %v
+	err := %v(r, t)
+	return t, err
+}
+`
 
+const recordStructPublicDeserializerIntoTemplate = `
+// %[1]v deserializes a record into t, reusing any nested values already allocated in t.
+func %[1]v(r io.Reader, t %[2]v) error {
 	deser, err := compiler.CompileSchemaBytes([]byte(t.Schema()), []byte(t.Schema()))
-        if err != nil {
-		return nil, err
+	if err != nil {
+		return err
 	}
 
-        err = vm.Eval(r, deser, t)
-	return t, err
+	return vm.Eval(r, deser, t)
+}
+`
+
+const recordStructPrecompiledDeserializerIntoTemplate = `
+// %[1]v deserializes a record into t, reusing any nested values already allocated in t.
+func %[1]v(r io.Reader, t %[2]v) error {
+	return vm.Eval(r, %[3]v, t)
 }
 `
 
+const recordProgramTemplate = `
+// The precompiled program which deserializes %v written with its own schema
+var %v = vm.MustLoadProgram([]byte(%v))
+`
+
 const recordWriterTemplate = `
-func %v(writer io.Writer, codec container.Codec, recordsPerBlock int64) (*container.Writer, error) {
+func %v(writer io.Writer, codec container.Codec, recordsPerBlock int64, options ...container.WriterOption) (*container.Writer, error) {
+	str := &%v{}
+	return container.NewWriter(writer, codec, recordsPerBlock, str.Schema(), options...)
+}
+`
+
+const recordAppendWriterTemplate = `
+// %v appends %v records to an existing container file with the same schema, see container.OpenAppend.
+func %v(file io.ReadWriteSeeker, codec container.Codec, recordsPerBlock int64, options ...container.WriterOption) (*container.Writer, error) {
 	str := &%v{}
-	return container.NewWriter(writer, codec, recordsPerBlock, str.Schema())
+	return container.OpenAppend(file, codec, recordsPerBlock, str.Schema(), options...)
 }
 `
 
@@ -68,60 +94,155 @@ func %v(r io.Reader) (%v, error) {
 `
 
 const recordFieldTemplate = `
-func (_ %[1]v) SetBoolean(v bool) { panic("Unsupported operation") }
-func (_ %[1]v) SetInt(v int32) { panic("Unsupported operation") }
-func (_ %[1]v) SetLong(v int64) { panic("Unsupported operation") }
-func (_ %[1]v) SetFloat(v float32) { panic("Unsupported operation") }
-func (_ %[1]v) SetDouble(v float64) { panic("Unsupported operation") }
-func (_ %[1]v) SetBytes(v []byte) { panic("Unsupported operation") }
-func (_ %[1]v) SetString(v string) { panic("Unsupported operation") }
-func (_ %[1]v) SetUnionElem(v int64) { panic("Unsupported operation") }
-func (r %[1]v) Get(i int) types.Field {
+func (_ %[1]v) SetBoolean(v bool) error { return &types.FieldError{Field: %[4]q, Op: types.OpAssign, Value: "boolean"} }
+func (_ %[1]v) SetInt(v int32) error { return &types.FieldError{Field: %[4]q, Op: types.OpAssign, Value: "int"} }
+func (_ %[1]v) SetLong(v int64) error { return &types.FieldError{Field: %[4]q, Op: types.OpAssign, Value: "long"} }
+func (_ %[1]v) SetFloat(v float32) error { return &types.FieldError{Field: %[4]q, Op: types.OpAssign, Value: "float"} }
+func (_ %[1]v) SetDouble(v float64) error { return &types.FieldError{Field: %[4]q, Op: types.OpAssign, Value: "double"} }
+func (_ %[1]v) SetBytes(v []byte) error { return &types.FieldError{Field: %[4]q, Op: types.OpAssign, Value: "bytes"} }
+func (_ %[1]v) SetString(v string) error { return &types.FieldError{Field: %[4]q, Op: types.OpAssign, Value: "string"} }
+func (r %[1]v) Get(i int) (types.Field, error) {
 	switch (i) {
 		%[2]v
 	}
-	panic("Unknown field index")
+	return nil, &types.FieldError{Field: %[4]q, Op: types.OpGet, Index: i}
 }
-func (r %[1]v) SetDefault(i int) {
+func (r %[1]v) SetDefault(i int) error {
 	switch (i) {
 		%[3]v
 	}
-	panic("Unknown field index")
+	return &types.FieldError{Field: %[4]q, Op: types.OpSetDefault, Index: i}
 }
-func (_ %[1]v) AppendMap(key string) types.Field { panic("Unsupported operation") }
-func (_ %[1]v) AppendArray() types.Field { panic("Unsupported operation") }
+func (_ %[1]v) AppendMap(key string) (types.Field, error) { return nil, &types.FieldError{Field: %[4]q, Op: types.OpAppendMap} }
+func (_ %[1]v) AppendArray() (types.Field, error) { return nil, &types.FieldError{Field: %[4]q, Op: types.OpAppendArray} }
 func (_ %[1]v) Finalize() { }
 `
 
 const recordReaderTemplate = `
 type %[1]v struct {
-	r io.Reader
+	r *container.Reader
 	p *vm.Program
+	opts vm.Options
+
+	// With container.WithParallelism, the reader decoding blocks ahead and the records left in the current block
+	parallel *container.ParallelReader
+	block []%[2]v
 }
 
-func New%[1]v(r io.Reader) (*%[1]v, error){
-	containerReader, err := container.NewReader(r)
+// New%[1]v creates a reader for a container file, the options are passed to container.NewReader.
+func New%[1]v(r io.Reader, options ...container.ReaderOption) (*%[1]v, error){
+	containerReader, err := container.NewReader(r, options...)
 	if err != nil {
 		return nil, err
 	}
+	return New%[1]vFromContainer(containerReader)
+}
 
+// New%[1]vFromContainer creates a reader for the records of a container.Reader, like one returned by container.NewSplitReader.
+func New%[1]vFromContainer(containerReader *container.Reader) (*%[1]v, error){
 	t := %[3]v
 	deser, err := compiler.CompileSchemaBytes([]byte(containerReader.AvroContainerSchema()), []byte(t.Schema()))
 	if err != nil {
 		return nil, err
 	}
 
-	return &%[1]v{
+	reader := &%[1]v{
 		r: containerReader,
 		p: deser,
-	}, nil
+		opts: vm.Options{ReuseBuffers: true, Limits: containerReader.Limits()},
+	}
+	if n := containerReader.Parallelism(); n > 0 {
+		reader.parallel = container.NewParallelReader(containerReader, n, reader.decodeBlock)
+	}
+	return reader, nil
+}
+
+// New%[1]vWithLimits creates a reader which rejects blocks and records exceeding the given limits,
+// for reading files from untrusted sources.
+func New%[1]vWithLimits(r io.Reader, limits vm.Limits) (*%[1]v, error){
+	return New%[1]v(r, container.WithLimits(limits))
 }
 
 func (r *%[1]v) Read() (%[2]v, error) {
+	if r.parallel != nil {
+		return r.next()
+	}
 	t := %[3]v
-        err := vm.Eval(r.r, r.p, t)
+	err := r.ReadInto(t)
 	return t, err
 }
+
+// ReadInto reads the next record into t, reusing any nested values already allocated in t.
+// With container.WithParallelism the record is decoded ahead and copied into t instead.
+func (r *%[1]v) ReadInto(t %[2]v) error {
+	if r.parallel != nil {
+		next, err := r.next()
+		if err != nil {
+			return err
+		}
+		*t = *next
+		return nil
+	}
+
+	for {
+		r.r.StartRecord()
+		err := vm.EvalWithOptions(r.r, r.p, t, &r.opts)
+		if err == nil || err == io.EOF {
+			return err
+		}
+		// In recovery mode the rest of the block is skipped, and the record is read from the next one
+		if err := r.r.Recover(err); err != nil {
+			return err
+		}
+	}
+}
+
+// Metadata returns the metadata in the header of the file, see container.Reader.Metadata
+func (r *%[1]v) Metadata() map[string][]byte {
+	return r.r.Metadata()
+}
+
+// Close stops the goroutines decoding blocks ahead with container.WithParallelism.
+// It doesn't close the underlying io.Reader.
+func (r *%[1]v) Close() error {
+	if r.parallel != nil {
+		return r.parallel.Close()
+	}
+	return nil
+}
+
+// Return the next record decoded ahead
+func (r *%[1]v) next() (%[2]v, error) {
+	for len(r.block) == 0 {
+		records, err := r.parallel.Next()
+		if err != nil {
+			return nil, err
+		}
+		r.block = records.([]%[2]v)
+	}
+	t := r.block[0]
+	r.block = r.block[1:]
+	return t, nil
+}
+
+// Decode the records of a block, on the worker goroutines of the parallel reader
+func (r *%[1]v) decodeBlock(block []byte, records int64) (interface{}, error) {
+	input := bytes.NewReader(block)
+	opts := vm.Options{Limits: r.opts.Limits}
+	decoded := make([]%[2]v, 0)
+	for i := int64(0); i < records; i++ {
+		t := %[3]v
+		if err := vm.EvalWithOptions(input, r.p, t, &opts); err != nil {
+			// The block ended before all of its records, which isn't the end of the file
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		decoded = append(decoded, t)
+	}
+	return decoded, nil
+}
 `
 
 type RecordDefinition struct {
@@ -220,6 +341,14 @@ func (r *RecordDefinition) recordWriterMethodDef() string {
 	return fmt.Sprintf(recordWriterTemplate, r.recordWriterMethod(), r.Name())
 }
 
+func (r *RecordDefinition) recordAppendWriterMethod() string {
+	return fmt.Sprintf("New%vAppendWriter", r.Name())
+}
+
+func (r *RecordDefinition) recordAppendWriterMethodDef() string {
+	return fmt.Sprintf(recordAppendWriterTemplate, r.recordAppendWriterMethod(), r.Name(), r.recordAppendWriterMethod(), r.Name())
+}
+
 func (r *RecordDefinition) publicSerializerMethodDef() string {
 	return fmt.Sprintf(recordStructPublicSerializerTemplate, r.GoType(), r.SerializerMethod())
 }
@@ -243,7 +372,28 @@ func (r *RecordDefinition) publicDeserializerMethod() string {
 }
 
 func (r *RecordDefinition) publicDeserializerMethodDef() string {
-	return fmt.Sprintf(recordStructPublicDeserializerTemplate, r.publicDeserializerMethod(), r.GoType(), r.ConstructorMethod())
+	return fmt.Sprintf(recordStructPublicDeserializerTemplate, r.publicDeserializerMethod(), r.GoType(), r.ConstructorMethod(), r.publicDeserializerIntoMethod())
+}
+
+func (r *RecordDefinition) publicDeserializerIntoMethod() string {
+	return fmt.Sprintf("Deserialize%vInto", r.Name())
+}
+
+func (r *RecordDefinition) publicDeserializerIntoMethodDef() string {
+	return fmt.Sprintf(recordStructPublicDeserializerIntoTemplate, r.publicDeserializerIntoMethod(), r.GoType())
+}
+
+func (r *RecordDefinition) programVarName() string {
+	return fmt.Sprintf("_%vProgram", r.Name())
+}
+
+// AddPrecompiledProgram embeds a program which deserializes this record written with its own schema,
+// encoded with vm.Program.MarshalBinary, and uses it in the generated Deserialize methods instead of
+// compiling the schema every time.
+func (r *RecordDefinition) AddPrecompiledProgram(p *generator.Package, program []byte) {
+	p.AddImport(r.filename(), "github.com/actgardner/gogen-avro/vm")
+	p.AddFunction(r.filename(), "", r.programVarName(), fmt.Sprintf(recordProgramTemplate, r.Name(), r.programVarName(), strconv.Quote(string(program))))
+	p.AddFunction(r.filename(), r.GoType(), r.publicDeserializerIntoMethod(), fmt.Sprintf(recordStructPrecompiledDeserializerIntoTemplate, r.publicDeserializerIntoMethod(), r.GoType(), r.programVarName()))
 }
 
 func (r *RecordDefinition) schemaNameMethodDef() (string, error) {
@@ -275,15 +425,18 @@ func (r *RecordDefinition) AddStruct(p *generator.Package, containers bool) erro
 		if containers {
 			p.AddImport(r.filename(), "github.com/actgardner/gogen-avro/container")
 			p.AddFunction(r.filename(), "", r.recordWriterMethod(), r.recordWriterMethodDef())
+			p.AddFunction(r.filename(), "", r.recordAppendWriterMethod(), r.recordAppendWriterMethodDef())
 		}
 
 		p.AddImport(r.filename(), "github.com/actgardner/gogen-avro/vm/types")
 		p.AddImport(r.filename(), "github.com/actgardner/gogen-avro/vm")
 		p.AddImport(r.filename(), "github.com/actgardner/gogen-avro/compiler")
 		p.AddFunction(r.filename(), r.GoType(), "fieldTemplate", r.FieldsMethodDef())
+		p.AddImport(r.filename(), "bytes")
 		p.AddFunction(r.filename(), r.GoType(), "recordReader", r.recordReaderDef())
 		p.AddFunction(r.filename(), r.GoType(), r.ConstructorMethod(), constructorMethodDef)
 		p.AddFunction(r.filename(), r.GoType(), r.publicDeserializerMethod(), r.publicDeserializerMethodDef())
+		p.AddFunction(r.filename(), r.GoType(), r.publicDeserializerIntoMethod(), r.publicDeserializerIntoMethodDef())
 		for _, f := range r.fields {
 			f.Type().AddStruct(p, containers)
 		}
@@ -355,7 +508,7 @@ func (r *RecordDefinition) defaultMethodDef() (string, error) {
 			if err != nil {
 				return "", err
 			}
-			defaults += def + "\nreturn\n"
+			defaults += def + "\nreturn nil\n"
 		}
 	}
 	return defaults, nil
@@ -365,13 +518,11 @@ func (r *RecordDefinition) getMethodDef() string {
 	getBody := ""
 	for i, f := range r.fields {
 		getBody += fmt.Sprintf("case %v:\n", i)
-		if constructor, ok := getConstructableForType(f.Type()); ok {
-			getBody += fmt.Sprintf("r.%v = %v\n", f.GoName(), constructor.ConstructorMethod())
-		}
+		getBody += reuseOrConstruct(fmt.Sprintf("r.%v", f.GoName()), f.Type())
 		if f.Type().WrapperType() == "" {
-			getBody += fmt.Sprintf("return r.%v\n", f.GoName())
+			getBody += fmt.Sprintf("return r.%v, nil\n", f.GoName())
 		} else {
-			getBody += fmt.Sprintf("return (*%v)(&r.%v)\n", f.Type().WrapperType(), f.GoName())
+			getBody += fmt.Sprintf("return (*%v)(&r.%v), nil\n", f.Type().WrapperType(), f.GoName())
 		}
 	}
 	return getBody
@@ -380,7 +531,7 @@ func (r *RecordDefinition) getMethodDef() string {
 func (r *RecordDefinition) FieldsMethodDef() string {
 	getBody := r.getMethodDef()
 	defaultBody, _ := r.defaultMethodDef()
-	return fmt.Sprintf(recordFieldTemplate, r.GoType(), getBody, defaultBody)
+	return fmt.Sprintf(recordFieldTemplate, r.GoType(), getBody, defaultBody, r.Name())
 }
 
 func (r *RecordDefinition) ConstructorMethodDef() (string, error) {
@@ -26,24 +26,28 @@ func %v %v {
 `
 
 const unionFieldTemplate = `
-func (_ %[1]v) SetBoolean(v bool) { panic("Unsupported operation") }
-func (_ %[1]v) SetInt(v int32) { panic("Unsupported operation") }
-func (_ %[1]v) SetFloat(v float32) { panic("Unsupported operation") }
-func (_ %[1]v) SetDouble(v float64) { panic("Unsupported operation") }
-func (_ %[1]v) SetBytes(v []byte) { panic("Unsupported operation") }
-func (_ %[1]v) SetString(v string) { panic("Unsupported operation") }
-func (r %[1]v) SetLong(v int64) { 
-	r.UnionType = (%[2]v)(v)
+func (_ %[1]v) SetBoolean(v bool) error { return &types.FieldError{Field: %[4]q, Op: types.OpAssign, Value: "boolean"} }
+func (_ %[1]v) SetInt(v int32) error { return &types.FieldError{Field: %[4]q, Op: types.OpAssign, Value: "int"} }
+func (_ %[1]v) SetFloat(v float32) error { return &types.FieldError{Field: %[4]q, Op: types.OpAssign, Value: "float"} }
+func (_ %[1]v) SetDouble(v float64) error { return &types.FieldError{Field: %[4]q, Op: types.OpAssign, Value: "double"} }
+func (_ %[1]v) SetBytes(v []byte) error { return &types.FieldError{Field: %[4]q, Op: types.OpAssign, Value: "bytes"} }
+func (_ %[1]v) SetString(v string) error { return &types.FieldError{Field: %[4]q, Op: types.OpAssign, Value: "string"} }
+func (r %[1]v) SetLong(v int64) error {
+	if t := (%[2]v)(v); t != r.UnionType {
+		// Clear the branch decoded into a reused union before, which isn't selected any more
+		*r = %[5]v{UnionType: t}
+	}
+	return nil
 }
-func (r %[1]v) Get(i int) types.Field {
+func (r %[1]v) Get(i int) (types.Field, error) {
 	switch (i) {
 		%[3]v
 	}
-	panic("Unknown field index")
+	return nil, &types.FieldError{Field: %[4]q, Op: types.OpGet, Index: i}
 }
-func (_ %[1]v) SetDefault(i int) { panic("Unsupported operation") }
-func (_ %[1]v) AppendMap(key string) types.Field { panic("Unsupported operation") }
-func (_ %[1]v) AppendArray() types.Field { panic("Unsupported operation") }
+func (_ %[1]v) SetDefault(i int) error { return &types.FieldError{Field: %[4]q, Op: types.OpSetDefault, Index: i} }
+func (_ %[1]v) AppendMap(key string) (types.Field, error) { return nil, &types.FieldError{Field: %[4]q, Op: types.OpAppendMap} }
+func (_ %[1]v) AppendArray() (types.Field, error) { return nil, &types.FieldError{Field: %[4]q, Op: types.OpAppendArray} }
 func (_ %[1]v) Finalize()  { }
 `
 
@@ -117,16 +121,14 @@ func (s *UnionField) FieldsMethodDef() string {
 	getBody := ""
 	for i, f := range s.itemType {
 		getBody += fmt.Sprintf("case %v:\n", i)
-		if constructor, ok := getConstructableForType(f); ok {
-			getBody += fmt.Sprintf("r.%v = %v\n", f.Name(), constructor.ConstructorMethod())
-		}
+		getBody += reuseOrConstruct(fmt.Sprintf("r.%v", f.Name()), f)
 		if f.WrapperType() == "" {
-			getBody += fmt.Sprintf("return r.%v\n", f.Name())
+			getBody += fmt.Sprintf("return r.%v, nil\n", f.Name())
 		} else {
-			getBody += fmt.Sprintf("return (*%v)(&r.%v)\n", f.WrapperType(), f.Name())
+			getBody += fmt.Sprintf("return (*%v)(&r.%v), nil\n", f.WrapperType(), f.Name())
 		}
 	}
-	return fmt.Sprintf(unionFieldTemplate, s.GoType(), s.unionEnumType(), getBody)
+	return fmt.Sprintf(unionFieldTemplate, s.GoType(), s.unionEnumType(), getBody, s.Name(), s.Name())
 }
 
 func (s *UnionField) filename() string {
@@ -0,0 +1,63 @@
+package avro
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/actgardner/gogen-avro/container"
+	"github.com/stretchr/testify/assert"
+)
+
+func tempFile(t *testing.T, data []byte) *os.File {
+	file, err := ioutil.TempFile("", "append")
+	assert.Nil(t, err)
+	_, err = file.Write(data)
+	assert.Nil(t, err)
+	return file
+}
+
+func TestAppend(t *testing.T) {
+	for _, codec := range []container.Codec{container.Null, container.Snappy} {
+		file := tempFile(t, writeEventsWithCodec(t, codec, 4))
+		defer os.Remove(file.Name())
+		defer file.Close()
+
+		writer, err := NewEventAppendWriter(file, codec, 2, container.WithCompressionWorkers(2))
+		assert.Nil(t, err)
+		for i := 4; i < 7; i++ {
+			assert.Nil(t, writer.WriteRecord(&Event{Id: int64(i), Name: "event"}))
+		}
+		assert.Nil(t, writer.Close())
+
+		data, err := ioutil.ReadFile(file.Name())
+		assert.Nil(t, err)
+		// The appended blocks use the file's sync marker
+		assert.Equal(t, 5, len(syncOffsets(data)))
+		reader, err := NewEventReader(bytes.NewReader(data))
+		assert.Nil(t, err)
+		assert.Equal(t, []int64{0, 1, 2, 3, 4, 5, 6}, readAll(t, reader))
+	}
+}
+
+func TestAppendMismatch(t *testing.T) {
+	file := tempFile(t, writeEventsWithCodec(t, container.Null, 4))
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	_, err := NewEventAppendWriter(file, container.Snappy, 2)
+	assert.NotNil(t, err)
+
+	_, err = container.OpenAppend(file, container.Null, 2, `{"type": "record", "name": "Other", "fields": []}`)
+	assert.NotNil(t, err)
+
+	_, err = NewEventAppendWriter(file, container.Null, 2, container.WithMetadata("key", []byte("value")))
+	assert.NotNil(t, err)
+
+	_, err = NewEventAppendWriter(file, container.Null, 2, container.WithSyncMarker([16]byte{}))
+	assert.NotNil(t, err)
+
+	_, err = NewEventAppendWriter(tempFile(t, []byte("not a container file")), container.Null, 2)
+	assertHeaderError(t, err, container.InvalidMagic)
+}
@@ -0,0 +1,76 @@
+package avro
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/actgardner/gogen-avro/container"
+	"github.com/stretchr/testify/assert"
+)
+
+func blockSizes(t *testing.T, data []byte) (records []int64, sizes []int) {
+	reader, err := container.NewReader(bytes.NewReader(data))
+	assert.Nil(t, err)
+	for {
+		block, err := reader.NextBlock()
+		if err == io.EOF {
+			return records, sizes
+		}
+		assert.Nil(t, err)
+		records = append(records, block.NumRecords)
+		sizes = append(sizes, len(block.RecordBytes))
+	}
+}
+
+func TestBlockSize(t *testing.T) {
+	// Each event is 7 bytes with the null codec
+	var buf bytes.Buffer
+	writer, err := NewEventWriter(&buf, container.Null, 0, container.WithBlockSize(20))
+	assert.Nil(t, err)
+	for i := 0; i < 10; i++ {
+		assert.Nil(t, writer.WriteRecord(&Event{Id: int64(i), Name: "event"}))
+	}
+	assert.Nil(t, writer.Close())
+
+	records, sizes := blockSizes(t, buf.Bytes())
+	assert.Equal(t, []int64{3, 3, 3, 1}, records)
+	assert.Equal(t, []int{21, 21, 21, 7}, sizes)
+}
+
+func TestBlockSizeWithRecordCap(t *testing.T) {
+	var buf bytes.Buffer
+	writer, err := NewEventWriter(&buf, container.Null, 2, container.WithBlockSize(20))
+	assert.Nil(t, err)
+	for i := 0; i < 5; i++ {
+		assert.Nil(t, writer.WriteRecord(&Event{Id: int64(i), Name: "event"}))
+	}
+	assert.Nil(t, writer.Close())
+
+	records, _ := blockSizes(t, buf.Bytes())
+	assert.Equal(t, []int64{2, 2, 1}, records)
+}
+
+func TestFlushInterval(t *testing.T) {
+	var buf bytes.Buffer
+	writer, err := NewEventWriter(&buf, container.Null, 100, container.WithFlushInterval(20*time.Millisecond))
+	assert.Nil(t, err)
+	headerSize := buf.Len()
+
+	assert.Nil(t, writer.WriteRecord(&Event{Id: 0, Name: "event"}))
+	assert.Nil(t, writer.FlushIfDue())
+	assert.Equal(t, headerSize, buf.Len())
+
+	time.Sleep(30 * time.Millisecond)
+	assert.Nil(t, writer.FlushIfDue())
+	records, _ := blockSizes(t, buf.Bytes())
+	assert.Equal(t, []int64{1}, records)
+
+	// WriteRecord flushes a block which is due too
+	assert.Nil(t, writer.WriteRecord(&Event{Id: 1, Name: "event"}))
+	time.Sleep(30 * time.Millisecond)
+	assert.Nil(t, writer.WriteRecord(&Event{Id: 2, Name: "event"}))
+	records, _ = blockSizes(t, buf.Bytes())
+	assert.Equal(t, []int64{1, 2}, records)
+}
@@ -0,0 +1,75 @@
+package avro
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/actgardner/gogen-avro/container"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBlockIterator(t *testing.T) {
+	data := writeEventsWithCodec(t, container.Deflate, 5)
+	syncs := syncOffsets(data)
+
+	reader, err := container.NewReader(bytes.NewReader(data))
+	assert.Nil(t, err)
+	counts := make([]int64, 0)
+	for i := 0; ; i++ {
+		block, err := reader.NextBlock()
+		if err == io.EOF {
+			break
+		}
+		if !assert.Nil(t, err) {
+			break
+		}
+		counts = append(counts, block.NumRecords)
+		assert.Equal(t, int64(syncs[i]+len(syncMarker)), block.Offset)
+		assert.True(t, len(block.RecordBytes) > 0)
+	}
+	assert.Equal(t, []int64{2, 2, 1}, counts)
+}
+
+func TestAppendBlocks(t *testing.T) {
+	first := writeEventsWithCodec(t, container.Snappy, 3)
+	second := writeEventsWithCodec(t, container.Snappy, 4)
+
+	var buf bytes.Buffer
+	writer, err := NewEventWriter(&buf, container.Snappy, 10)
+	assert.Nil(t, err)
+	// Records written before the blocks come first
+	assert.Nil(t, writer.WriteRecord(&Event{Id: 100, Name: "event"}))
+	for _, data := range [][]byte{first, second} {
+		reader, err := container.NewReader(bytes.NewReader(data))
+		assert.Nil(t, err)
+		assert.Nil(t, writer.AppendBlocks(reader))
+	}
+	assert.Nil(t, writer.Flush())
+
+	// The blocks are written with the new file's sync marker
+	assert.Equal(t, 0, len(syncOffsets(buf.Bytes())))
+	ids := make([]int64, 0)
+	for _, event := range readEvents(t, buf.Bytes()) {
+		ids = append(ids, event.Id)
+	}
+	assert.Equal(t, []int64{100, 0, 1, 2, 0, 1, 2, 3}, ids)
+}
+
+func TestAppendBlocksMismatch(t *testing.T) {
+	var buf bytes.Buffer
+	writer, err := NewEventWriter(&buf, container.Null, 10)
+	assert.Nil(t, err)
+
+	reader, err := container.NewReader(bytes.NewReader(writeEventsWithCodec(t, container.Snappy, 1)))
+	assert.Nil(t, err)
+	assert.NotNil(t, writer.AppendBlocks(reader))
+
+	var other bytes.Buffer
+	otherWriter, err := container.NewWriter(&other, container.Null, 1, `{"type": "record", "name": "Other", "fields": []}`)
+	assert.Nil(t, err)
+	assert.Nil(t, otherWriter.Flush())
+	reader, err = container.NewReader(bytes.NewReader(other.Bytes()))
+	assert.Nil(t, err)
+	assert.NotNil(t, writer.AppendBlocks(reader))
+}
@@ -0,0 +1,125 @@
+package avro
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/actgardner/gogen-avro/container"
+	"github.com/stretchr/testify/assert"
+)
+
+type closeRecorder struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (c *closeRecorder) Close() error {
+	c.closed = true
+	return nil
+}
+
+func TestWriterClose(t *testing.T) {
+	for _, closeWriter := range []bool{false, true} {
+		options := []container.WriterOption{}
+		if closeWriter {
+			options = append(options, container.WithCloseWriter())
+		}
+		output := &closeRecorder{}
+		writer, err := NewEventWriter(output, container.Snappy, 10, options...)
+		assert.Nil(t, err)
+		assert.Nil(t, writer.WriteRecord(&Event{Id: 0, Name: "event"}))
+		assert.Nil(t, writer.Close())
+		assert.Equal(t, closeWriter, output.closed)
+		assert.Equal(t, 1, len(readEvents(t, output.Bytes())))
+
+		assert.Equal(t, container.ErrWriterClosed, writer.WriteRecord(&Event{Id: 1, Name: "event"}))
+		assert.Equal(t, container.ErrWriterClosed, writer.Flush())
+		assert.Equal(t, container.ErrWriterClosed, writer.FlushIfDue())
+		assert.Equal(t, container.ErrWriterClosed, writer.WriteBlock(&container.Block{}))
+		assert.Equal(t, container.ErrWriterClosed, writer.Close())
+	}
+}
+
+var errWrite = errors.New("write failed")
+
+// Accepts the first limit bytes written to it, and fails part way through the write which goes past them
+type limitedWriter struct {
+	bytes.Buffer
+	limit int
+}
+
+func (w *limitedWriter) Write(p []byte) (int, error) {
+	if w.Len()+len(p) > w.limit {
+		n, _ := w.Buffer.Write(p[:w.limit-w.Len()])
+		return n, errWrite
+	}
+	return w.Buffer.Write(p)
+}
+
+func TestWriterPartialWrite(t *testing.T) {
+	for _, workers := range []int{0, 2} {
+		var header bytes.Buffer
+		_, err := NewEventWriter(&header, container.Null, 2)
+		assert.Nil(t, err)
+
+		// The header and the first block fit, the second block is cut off
+		output := &limitedWriter{limit: header.Len() + 35}
+		writer, err := NewEventWriter(output, container.Null, 2, container.WithCompressionWorkers(workers))
+		assert.Nil(t, err)
+		for i := 0; i < 4 && err == nil; i++ {
+			err = writer.WriteRecord(&Event{Id: int64(i), Name: "event"})
+		}
+		if err == nil {
+			err = writer.Flush()
+		}
+		assert.Equal(t, errWrite, err)
+
+		// Nothing more is written after the failure
+		size := output.Len()
+		assert.Equal(t, errWrite, writer.WriteRecord(&Event{Id: 4, Name: "event"}))
+		assert.Equal(t, errWrite, writer.Flush())
+		assert.Equal(t, errWrite, writer.Close())
+		assert.Equal(t, size, output.Len())
+		assert.Equal(t, container.ErrWriterClosed, writer.Close())
+	}
+}
+
+func TestWriterCompressionError(t *testing.T) {
+	container.RegisterCodec("failing", failingCodec{})
+
+	writer, err := NewEventWriter(ioutil.Discard, "failing", 1)
+	assert.Nil(t, err)
+	assert.Equal(t, errCompress, writer.WriteRecord(&Event{Id: 0, Name: "event"}))
+	assert.Equal(t, errCompress, writer.WriteRecord(&Event{Id: 1, Name: "event"}))
+	assert.Equal(t, errCompress, writer.Close())
+}
+
+var errSerialize = errors.New("serialize failed")
+
+// A record which writes part of itself before failing
+type brokenRecord struct {
+	Event
+}
+
+func (r *brokenRecord) Serialize(w io.Writer) error {
+	w.Write([]byte{0x02, 0x04})
+	return errSerialize
+}
+
+func TestWriteRecordError(t *testing.T) {
+	var buf bytes.Buffer
+	writer, err := NewEventWriter(&buf, container.Null, 2)
+	assert.Nil(t, err)
+	assert.Nil(t, writer.WriteRecord(&Event{Id: 0, Name: "event"}))
+	// The part of the record written is dropped, and the writer can still be used
+	assert.Equal(t, errSerialize, writer.WriteRecord(&brokenRecord{}))
+	assert.Nil(t, writer.WriteRecord(&Event{Id: 1, Name: "event"}))
+	assert.Nil(t, writer.Close())
+
+	reader, err := NewEventReader(bytes.NewReader(buf.Bytes()))
+	assert.Nil(t, err)
+	assert.Equal(t, []int64{0, 1}, readAll(t, reader))
+}
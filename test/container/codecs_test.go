@@ -0,0 +1,124 @@
+package avro
+
+import (
+	"bytes"
+	"compress/flate"
+	"io/ioutil"
+	"testing"
+
+	"github.com/actgardner/gogen-avro/container"
+	"github.com/stretchr/testify/assert"
+)
+
+// A codec which stores blocks reversed, to check registered codecs are used
+type reverseCodec struct{}
+
+func reverse(block []byte) []byte {
+	reversed := make([]byte, len(block))
+	for i, b := range block {
+		reversed[len(block)-1-i] = b
+	}
+	return reversed
+}
+
+func (reverseCodec) Compress(dst, block []byte) ([]byte, error) {
+	return append(dst, reverse(block)...), nil
+}
+
+func (reverseCodec) Decompress(block []byte, max int64) ([]byte, error) {
+	return reverse(block), nil
+}
+
+func TestCodecs(t *testing.T) {
+	for _, codec := range []container.Codec{container.Null, container.Deflate, container.Snappy} {
+		var buf bytes.Buffer
+		writer, err := NewEventWriter(&buf, codec, 3)
+		assert.Nil(t, err)
+		for i := 0; i < 10; i++ {
+			assert.Nil(t, writer.WriteRecord(&Event{Id: int64(i), Name: "event"}))
+		}
+		assert.Nil(t, writer.Flush())
+
+		events := readEvents(t, buf.Bytes())
+		if assert.Equal(t, 10, len(events), "codec %v", codec) {
+			assert.Equal(t, int64(9), events[9].Id)
+		}
+	}
+}
+
+func TestDeflateLevel(t *testing.T) {
+	var fast, best bytes.Buffer
+	for _, w := range []struct {
+		buf   *bytes.Buffer
+		level int
+	}{{&fast, flate.NoCompression}, {&best, flate.BestCompression}} {
+		writer, err := NewEventWriter(w.buf, container.Deflate, 100, container.WithSyncMarker(syncMarker), container.WithDeflateLevel(w.level))
+		assert.Nil(t, err)
+		for i := 0; i < 100; i++ {
+			assert.Nil(t, writer.WriteRecord(&Event{Id: int64(i), Name: "event"}))
+		}
+		assert.Nil(t, writer.Flush())
+	}
+	assert.True(t, best.Len() < fast.Len())
+	assert.Equal(t, 100, len(readEvents(t, fast.Bytes())))
+	assert.Equal(t, 100, len(readEvents(t, best.Bytes())))
+}
+
+func TestDeflateLevelInvalid(t *testing.T) {
+	_, err := NewEventWriter(&bytes.Buffer{}, container.Snappy, 100, container.WithDeflateLevel(flate.BestCompression))
+	assert.EqualError(t, err, `Unable to set a deflate level for codec "snappy"`)
+
+	_, err = NewEventWriter(&bytes.Buffer{}, container.Deflate, 100, container.WithDeflateLevel(flate.BestCompression+1))
+	assert.EqualError(t, err, "Invalid deflate level 10")
+}
+
+func TestRegisterCodec(t *testing.T) {
+	container.RegisterCodec("reverse", reverseCodec{})
+	codec, ok := container.LookupCodec("reverse")
+	assert.True(t, ok)
+	assert.Equal(t, reverseCodec{}, codec)
+
+	data := writeEvents(t, 5)
+	var buf bytes.Buffer
+	writer, err := NewEventWriter(&buf, "reverse", 2)
+	assert.Nil(t, err)
+	for i := 0; i < 5; i++ {
+		assert.Nil(t, writer.WriteRecord(&Event{Id: int64(i), Name: "event"}))
+	}
+	assert.Nil(t, writer.Flush())
+	assert.NotEqual(t, data, buf.Bytes())
+
+	events := readEvents(t, buf.Bytes())
+	if assert.Equal(t, 5, len(events)) {
+		assert.Equal(t, "event", events[4].Name)
+	}
+}
+
+func TestUnknownCodec(t *testing.T) {
+	var buf bytes.Buffer
+	_, err := NewEventWriter(&buf, "lz4", 1)
+	assert.NotNil(t, err)
+
+	data := bytes.Replace(writeEvents(t, 1), []byte("\x08null"), []byte("\x08lz4x"), 1)
+	_, err = NewEventReader(bytes.NewReader(data))
+	assertHeaderError(t, err, container.UnknownCodec)
+}
+
+func TestBzip2WriteUnsupported(t *testing.T) {
+	var buf bytes.Buffer
+	writer, err := NewEventWriter(&buf, container.Bzip2, 1)
+	assert.Nil(t, err)
+	assert.NotNil(t, writer.WriteRecord(&Event{Id: 1, Name: "event"}))
+}
+
+func TestBzip2Read(t *testing.T) {
+	// Written with the bzip2 codec by another implementation
+	data, err := ioutil.ReadFile("events_bzip2.avro")
+	assert.Nil(t, err)
+
+	events := readEvents(t, data)
+	if assert.Equal(t, 3, len(events)) {
+		assert.Equal(t, int64(2), events[2].Id)
+		assert.Equal(t, "event", events[2].Name)
+	}
+}
@@ -0,0 +1,76 @@
+package avro
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/actgardner/gogen-avro/container"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSnappyChecksum(t *testing.T) {
+	data := writeEventsWithCodec(t, container.Snappy, 6)
+	syncs := syncOffsets(data)
+	// Corrupt the checksum at the end of the first block
+	data[syncs[1]-1] ^= 0xff
+
+	reader, err := NewEventReader(bytes.NewReader(data))
+	assert.Nil(t, err)
+	_, err = reader.Read()
+
+	var blockErr *container.BlockError
+	if assert.True(t, errors.As(err, &blockErr), "Expected a BlockError, got %v", err) {
+		assert.Equal(t, int64(syncs[0]+len(syncMarker)), blockErr.Offset)
+		assert.Equal(t, int64(2), blockErr.Records)
+	}
+	var checksumErr *container.ChecksumError
+	assert.True(t, errors.As(err, &checksumErr), "Expected a ChecksumError, got %v", err)
+}
+
+func TestSkipCorruptBlocks(t *testing.T) {
+	for _, codec := range []container.Codec{container.Null, container.Snappy} {
+		data := writeEventsWithCodec(t, codec, 6)
+		syncs := syncOffsets(data)
+		// Corrupt the sync marker after the second block
+		data[syncs[2]] ^= 0xff
+
+		corrupt := make([]*container.BlockError, 0)
+		reader, err := NewEventReader(bytes.NewReader(data), container.WithCorruptBlockHandler(func(err *container.BlockError) error {
+			corrupt = append(corrupt, err)
+			return nil
+		}))
+		assert.Nil(t, err)
+
+		ids := make([]int64, 0)
+		for {
+			event, err := reader.Read()
+			if err == io.EOF {
+				break
+			}
+			if !assert.Nil(t, err) {
+				break
+			}
+			ids = append(ids, event.Id)
+		}
+		assert.Equal(t, []int64{0, 1, 4, 5}, ids, "codec %v", codec)
+		if assert.Equal(t, 1, len(corrupt)) {
+			assert.Equal(t, int64(syncs[1]+len(syncMarker)), corrupt[0].Offset)
+			assert.Equal(t, int64(2), corrupt[0].Records)
+		}
+	}
+}
+
+func TestCorruptBlockHandlerError(t *testing.T) {
+	data := writeEventsWithCodec(t, container.Null, 4)
+	data[syncOffsets(data)[1]] ^= 0xff
+
+	stop := errors.New("stop")
+	reader, err := NewEventReader(bytes.NewReader(data), container.WithCorruptBlockHandler(func(err *container.BlockError) error {
+		return stop
+	}))
+	assert.Nil(t, err)
+	_, err = reader.Read()
+	assert.True(t, errors.Is(err, stop))
+}
@@ -0,0 +1,61 @@
+package avro
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/actgardner/gogen-avro/container"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRandomSyncMarker(t *testing.T) {
+	first := writeEvents(t, 5)
+	second := writeEvents(t, 5)
+	assert.NotEqual(t, first, second)
+	assert.Equal(t, 5, len(readEvents(t, first)))
+	assert.Equal(t, 5, len(readEvents(t, second)))
+}
+
+func TestFixedSyncMarker(t *testing.T) {
+	first := writeEvents(t, 5, container.WithSyncMarker(syncMarker))
+	second := writeEvents(t, 5, container.WithSyncMarker(syncMarker))
+	assert.Equal(t, first, second)
+	assert.True(t, bytes.HasSuffix(first, syncMarker[:]))
+	assert.Equal(t, 5, len(readEvents(t, first)))
+}
+
+func TestInvalidMagic(t *testing.T) {
+	data := writeEvents(t, 1)
+	copy(data, "obj\x01")
+
+	_, err := NewEventReader(bytes.NewReader(data))
+	assertHeaderError(t, err, container.InvalidMagic)
+}
+
+func TestMissingMetadata(t *testing.T) {
+	var buf bytes.Buffer
+	_, err := container.NewWriter(&buf, container.Null, 1, "")
+	assert.Nil(t, err)
+	// Rename the avro.schema key
+	data := bytes.Replace(buf.Bytes(), []byte("avro.schema"), []byte("avro.schemx"), 1)
+
+	_, err = NewEventReader(bytes.NewReader(data))
+	assertHeaderError(t, err, container.MissingSchema)
+
+	data = bytes.Replace(buf.Bytes(), []byte("avro.codec"), []byte("avro.codex"), 1)
+	_, err = NewEventReader(bytes.NewReader(data))
+	assertHeaderError(t, err, container.MissingCodec)
+}
+
+func TestTruncatedHeader(t *testing.T) {
+	data := writeEvents(t, 1)
+
+	_, err := NewEventReader(bytes.NewReader(data[:10]))
+	assertHeaderError(t, err, container.UnreadableHeader)
+
+	_, err = NewEventReader(bytes.NewReader(nil))
+	assertHeaderError(t, err, container.UnreadableHeader)
+	assert.True(t, errors.Is(err, io.EOF))
+}
@@ -0,0 +1,93 @@
+package avro
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/actgardner/gogen-avro/container"
+	"github.com/stretchr/testify/assert"
+)
+
+var syncMarker = [16]byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+
+func writeEvents(t *testing.T, count int, options ...container.WriterOption) []byte {
+	var buf bytes.Buffer
+	writer, err := NewEventWriter(&buf, container.Null, 2, options...)
+	assert.Nil(t, err)
+	for i := 0; i < count; i++ {
+		assert.Nil(t, writer.WriteRecord(&Event{Id: int64(i), Name: "event"}))
+	}
+	assert.Nil(t, writer.Flush())
+	return buf.Bytes()
+}
+
+func readEvents(t *testing.T, data []byte) []*Event {
+	reader, err := NewEventReader(bytes.NewReader(data))
+	assert.Nil(t, err)
+	events := make([]*Event, 0)
+	for {
+		event, err := reader.Read()
+		if err == io.EOF {
+			return events
+		}
+		assert.Nil(t, err)
+		events = append(events, event)
+	}
+}
+
+func assertHeaderError(t *testing.T, err error, kind container.HeaderErrorKind) {
+	var headerErr *container.HeaderError
+	if assert.True(t, errors.As(err, &headerErr), "Expected a HeaderError, got %v", err) {
+		assert.Equal(t, kind, headerErr.Kind)
+	}
+}
+
+// Find the offsets of the sync markers in a file written with syncMarker
+func syncOffsets(data []byte) []int {
+	offsets := make([]int, 0)
+	for i := 0; i+len(syncMarker) <= len(data); i++ {
+		if bytes.Equal(data[i:i+len(syncMarker)], syncMarker[:]) {
+			offsets = append(offsets, i)
+		}
+	}
+	return offsets
+}
+
+func writeEventsWithCodec(t *testing.T, codec container.Codec, count int) []byte {
+	var buf bytes.Buffer
+	writer, err := NewEventWriter(&buf, codec, 2, container.WithSyncMarker(syncMarker))
+	assert.Nil(t, err)
+	for i := 0; i < count; i++ {
+		assert.Nil(t, writer.WriteRecord(&Event{Id: int64(i), Name: "event"}))
+	}
+	assert.Nil(t, writer.Flush())
+	return buf.Bytes()
+}
+
+func readAll(t *testing.T, reader *EventReader) []int64 {
+	ids := make([]int64, 0)
+	for {
+		event, err := reader.Read()
+		if err == io.EOF {
+			return ids
+		}
+		if !assert.Nil(t, err) {
+			return ids
+		}
+		ids = append(ids, event.Id)
+	}
+}
+
+var errCompress = errors.New("compression failed")
+
+type failingCodec struct{}
+
+func (failingCodec) Compress(dst, block []byte) ([]byte, error) {
+	return nil, errCompress
+}
+
+func (failingCodec) Decompress(block []byte, max int64) ([]byte, error) {
+	return block, nil
+}
@@ -0,0 +1,34 @@
+package avro
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/actgardner/gogen-avro/container"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetadata(t *testing.T) {
+	data := writeEvents(t, 3, container.WithMetadata("producer", []byte("billing")), container.WithMetadata("version", []byte("7")))
+
+	reader, err := container.NewReader(bytes.NewReader(data))
+	assert.Nil(t, err)
+	assert.Equal(t, container.Null, reader.Codec())
+	metadata := reader.Metadata()
+	assert.Equal(t, []byte("billing"), metadata["producer"])
+	assert.Equal(t, []byte("7"), metadata["version"])
+	assert.Equal(t, []byte(container.Null), metadata["avro.codec"])
+	assert.Equal(t, reader.AvroContainerSchema(), metadata["avro.schema"])
+
+	eventReader, err := NewEventReader(bytes.NewReader(data))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("billing"), eventReader.Metadata()["producer"])
+	assert.Equal(t, 3, len(readEvents(t, data)))
+}
+
+func TestReservedMetadata(t *testing.T) {
+	var buf bytes.Buffer
+	_, err := NewEventWriter(&buf, container.Null, 1, container.WithMetadata("avro.codec", []byte("deflate")))
+	assert.NotNil(t, err)
+	assert.Equal(t, 0, buf.Len())
+}
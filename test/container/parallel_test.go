@@ -0,0 +1,91 @@
+package avro
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/actgardner/gogen-avro/container"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParallelRead(t *testing.T) {
+	var buf bytes.Buffer
+	writer, err := NewEventWriter(&buf, container.Deflate, 7)
+	assert.Nil(t, err)
+	for i := 0; i < 1000; i++ {
+		assert.Nil(t, writer.WriteRecord(&Event{Id: int64(i), Name: "event"}))
+	}
+	assert.Nil(t, writer.Flush())
+
+	for _, n := range []int{1, 4, 16} {
+		reader, err := NewEventReader(bytes.NewReader(buf.Bytes()), container.WithParallelism(n))
+		assert.Nil(t, err)
+		ids := readAll(t, reader)
+		if assert.Equal(t, 1000, len(ids)) {
+			for i, id := range ids {
+				assert.Equal(t, int64(i), id)
+			}
+		}
+		assert.Nil(t, reader.Close())
+	}
+}
+
+func TestParallelReadInto(t *testing.T) {
+	data := writeEventsWithCodec(t, container.Snappy, 5)
+	reader, err := NewEventReader(bytes.NewReader(data), container.WithParallelism(2))
+	assert.Nil(t, err)
+	defer reader.Close()
+
+	event := NewEvent()
+	for i := 0; i < 5; i++ {
+		assert.Nil(t, reader.ReadInto(event))
+		assert.Equal(t, int64(i), event.Id)
+	}
+	assert.Equal(t, io.EOF, reader.ReadInto(event))
+}
+
+func TestParallelClose(t *testing.T) {
+	data := writeEventsWithCodec(t, container.Deflate, 100)
+	reader, err := NewEventReader(bytes.NewReader(data), container.WithParallelism(3))
+	assert.Nil(t, err)
+
+	event, err := reader.Read()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), event.Id)
+	assert.Nil(t, reader.Close())
+
+	// The rest of the current block was already decoded
+	event, err = reader.Read()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), event.Id)
+	_, err = reader.Read()
+	assert.Equal(t, container.ErrClosed, err)
+}
+
+func TestParallelRecovery(t *testing.T) {
+	data := writeEventsWithCodec(t, container.Null, 8)
+	syncs := syncOffsets(data)
+	// A block with the wrong checksum isn't possible with the null codec, so damage a record
+	// in the second block and the size of the third
+	data[syncs[1]+len(syncMarker)+3] = 0x01
+	data[syncs[2]+len(syncMarker)+1] = 0x7f
+
+	skipped := make([]*container.SkippedRange, 0)
+	reader, err := NewEventReader(bytes.NewReader(data), container.WithParallelism(4), container.WithRecovery(func(s *container.SkippedRange) error {
+		skipped = append(skipped, s)
+		return nil
+	}))
+	assert.Nil(t, err)
+	defer reader.Close()
+
+	assert.Equal(t, []int64{0, 1, 6, 7}, readAll(t, reader))
+	if assert.Equal(t, 2, len(skipped)) {
+		assert.Equal(t, int64(syncs[1]+len(syncMarker)), skipped[0].Start)
+		assert.Equal(t, int64(syncs[2]+len(syncMarker)), skipped[0].End)
+		assert.False(t, skipped[0].Estimated)
+		assert.Equal(t, int64(syncs[2]+len(syncMarker)), skipped[1].Start)
+		assert.Equal(t, int64(syncs[3]+len(syncMarker)), skipped[1].End)
+		assert.True(t, skipped[1].Estimated)
+	}
+}
@@ -0,0 +1,61 @@
+package avro
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/actgardner/gogen-avro/container"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeEventsInParallel(t *testing.T, codec container.Codec, count int, workers int) []byte {
+	var buf bytes.Buffer
+	writer, err := NewEventWriter(&buf, codec, 3, container.WithSyncMarker(syncMarker), container.WithCompressionWorkers(workers))
+	assert.Nil(t, err)
+	for i := 0; i < count; i++ {
+		assert.Nil(t, writer.WriteRecord(&Event{Id: int64(i), Name: "event"}))
+		if i == count/2 {
+			assert.Nil(t, writer.Flush())
+		}
+	}
+	assert.Nil(t, writer.Close())
+	return buf.Bytes()
+}
+
+func TestParallelCompression(t *testing.T) {
+	for _, codec := range []container.Codec{container.Null, container.Deflate, container.Snappy} {
+		var buf bytes.Buffer
+		writer, err := NewEventWriter(&buf, codec, 3, container.WithSyncMarker(syncMarker))
+		assert.Nil(t, err)
+		for i := 0; i < 101; i++ {
+			assert.Nil(t, writer.WriteRecord(&Event{Id: int64(i), Name: "event"}))
+			if i == 50 {
+				assert.Nil(t, writer.Flush())
+			}
+		}
+		assert.Nil(t, writer.Close())
+
+		for _, workers := range []int{1, 4} {
+			assert.Equal(t, buf.Bytes(), writeEventsInParallel(t, codec, 101, workers), "codec %v with %v workers", codec, workers)
+		}
+	}
+}
+
+func TestParallelCompressionError(t *testing.T) {
+	container.RegisterCodec("failing", failingCodec{})
+
+	var buf bytes.Buffer
+	writer, err := NewEventWriter(&buf, "failing", 2, container.WithCompressionWorkers(2))
+	assert.Nil(t, err)
+	headerSize := buf.Len()
+	for i := 0; i < 20 && err == nil; i++ {
+		err = writer.WriteRecord(&Event{Id: int64(i), Name: "event"})
+	}
+	if err == nil {
+		err = writer.Flush()
+	}
+	assert.Equal(t, errCompress, err)
+	assert.Equal(t, errCompress, writer.Close())
+	// No blocks are written after one fails
+	assert.Equal(t, headerSize, buf.Len())
+}
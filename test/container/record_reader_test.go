@@ -0,0 +1,129 @@
+package avro
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/actgardner/gogen-avro/container"
+	"github.com/actgardner/gogen-avro/generic"
+	"github.com/actgardner/gogen-avro/schema"
+	"github.com/actgardner/gogen-avro/vm/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecordReader(t *testing.T) {
+	data := writeEventsWithCodec(t, container.Snappy, 5)
+	syncs := syncOffsets(data)
+	reader, err := container.NewReader(bytes.NewReader(data))
+	assert.Nil(t, err)
+	records, err := container.NewRecordReader(reader, nil, func() types.Field { return NewEvent() })
+	assert.Nil(t, err)
+
+	ids := make([]int64, 0)
+	for records.Next() {
+		event := records.Record().(*Event)
+		ids = append(ids, event.Id)
+		// Two records per block
+		assert.Equal(t, int64(syncs[event.Id/2]+len(syncMarker)), records.BlockOffset())
+		assert.Equal(t, event.Id%2, records.Index())
+	}
+	assert.Nil(t, records.Err())
+	assert.Equal(t, []int64{0, 1, 2, 3, 4}, ids)
+	assert.False(t, records.Next())
+	assert.Nil(t, records.Record())
+}
+
+const eventNameSchema = `{"type": "record", "name": "Event", "fields": [
+	{"name": "name", "type": "string"},
+	{"name": "source", "type": "string", "default": "unknown"}
+]}`
+
+func TestRecordReaderDynamic(t *testing.T) {
+	ns := schema.NewNamespace(false)
+	readerType, err := ns.TypeForSchema([]byte(eventNameSchema))
+	assert.Nil(t, err)
+	assert.Nil(t, readerType.ResolveReferences(ns))
+
+	reader, err := container.NewReader(bytes.NewReader(writeEvents(t, 3)))
+	assert.Nil(t, err)
+	records, err := container.NewRecordReader(reader, []byte(eventNameSchema), func() types.Field { return generic.NewDatum(readerType) })
+	assert.Nil(t, err)
+
+	values := make([]interface{}, 0)
+	for records.Next() {
+		values = append(values, records.Record().(*generic.Datum).Value())
+	}
+	assert.Nil(t, records.Err())
+	event := map[string]interface{}{"name": "event", "source": "unknown"}
+	assert.Equal(t, []interface{}{event, event, event}, values)
+}
+
+func TestRecordReaderIncompatibleSchema(t *testing.T) {
+	reader, err := container.NewReader(bytes.NewReader(writeEvents(t, 3)))
+	assert.Nil(t, err)
+	_, err = container.NewRecordReader(reader, []byte(`{"type": "record", "name": "Event", "fields": [{"name": "missing", "type": "int"}]}`), nil)
+	assert.NotNil(t, err)
+}
+
+func TestRecordReaderErrors(t *testing.T) {
+	data := writeEventsWithCodec(t, container.Null, 6)
+	syncs := syncOffsets(data)
+	// Damage a record in the second block
+	data[syncs[1]+len(syncMarker)+3] = 0x01
+
+	reader, err := container.NewReader(bytes.NewReader(data))
+	assert.Nil(t, err)
+	records, err := container.NewRecordReader(reader, nil, func() types.Field { return NewEvent() })
+	assert.Nil(t, err)
+	count := 0
+	for records.Next() {
+		count++
+	}
+	assert.Equal(t, 2, count)
+	assert.NotNil(t, records.Err())
+	assert.False(t, records.Next())
+
+	skipped := 0
+	reader, err = container.NewReader(bytes.NewReader(data), container.WithRecovery(func(*container.SkippedRange) error {
+		skipped++
+		return nil
+	}))
+	assert.Nil(t, err)
+	records, err = container.NewRecordReader(reader, nil, func() types.Field { return NewEvent() })
+	assert.Nil(t, err)
+	ids := make([]int64, 0)
+	for records.Next() {
+		ids = append(ids, records.Record().(*Event).Id)
+	}
+	assert.Nil(t, records.Err())
+	assert.Equal(t, []int64{0, 1, 4, 5}, ids)
+	assert.Equal(t, 1, skipped)
+	assert.Equal(t, int64(syncs[2]+len(syncMarker)), records.BlockOffset())
+}
+
+func TestRecordReaderRecoveryIndex(t *testing.T) {
+	data := writeEventsWithCodec(t, container.Null, 6)
+	syncs := syncOffsets(data)
+	// Damage the second record of the second block, after the block's record count and size and the first record
+	data[syncs[1]+len(syncMarker)+2+7+1] = 0x01
+
+	reader, err := container.NewReader(bytes.NewReader(data), container.WithRecovery(func(*container.SkippedRange) error {
+		return nil
+	}))
+	assert.Nil(t, err)
+	records, err := container.NewRecordReader(reader, nil, func() types.Field { return NewEvent() })
+	assert.Nil(t, err)
+
+	type location struct {
+		id, offset, index int64
+	}
+	locations := make([]location, 0)
+	for records.Next() {
+		locations = append(locations, location{records.Record().(*Event).Id, records.BlockOffset(), records.Index()})
+	}
+	assert.Nil(t, records.Err())
+
+	// The index starts again in the block after the one which was cut short
+	block := func(i int) int64 { return int64(syncs[i] + len(syncMarker)) }
+	assert.Equal(t, []location{{0, block(0), 0}, {1, block(0), 1}, {2, block(1), 0}, {4, block(2), 0}, {5, block(2), 1}}, locations)
+}
@@ -0,0 +1,138 @@
+package avro
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/actgardner/gogen-avro/container"
+	"github.com/stretchr/testify/assert"
+)
+
+func readRecovering(t *testing.T, data []byte) ([]int64, []*container.SkippedRange) {
+	skipped := make([]*container.SkippedRange, 0)
+	reader, err := NewEventReader(bytes.NewReader(data), container.WithRecovery(func(s *container.SkippedRange) error {
+		skipped = append(skipped, s)
+		return nil
+	}))
+	assert.Nil(t, err)
+
+	ids := make([]int64, 0)
+	for {
+		event, err := reader.Read()
+		if err == io.EOF {
+			return ids, skipped
+		}
+		if !assert.Nil(t, err) {
+			return ids, skipped
+		}
+		ids = append(ids, event.Id)
+	}
+}
+
+func TestRecoverDamagedFraming(t *testing.T) {
+	data := writeEventsWithCodec(t, container.Null, 8)
+	syncs := syncOffsets(data)
+	// Make the size of the second block negative
+	data[syncs[1]+len(syncMarker)+1] = 0x7f
+
+	ids, skipped := readRecovering(t, data)
+	assert.Equal(t, []int64{0, 1, 4, 5, 6, 7}, ids)
+	if assert.Equal(t, 1, len(skipped)) {
+		assert.Equal(t, int64(syncs[1]+len(syncMarker)), skipped[0].Start)
+		assert.Equal(t, int64(syncs[2]+len(syncMarker)), skipped[0].End)
+		assert.True(t, skipped[0].Estimated)
+		assert.Equal(t, int64(2), skipped[0].Records)
+	}
+}
+
+func TestRecoverChecksum(t *testing.T) {
+	data := writeEventsWithCodec(t, container.Snappy, 6)
+	syncs := syncOffsets(data)
+	data[syncs[2]-1] ^= 0xff
+
+	ids, skipped := readRecovering(t, data)
+	assert.Equal(t, []int64{0, 1, 4, 5}, ids)
+	if assert.Equal(t, 1, len(skipped)) {
+		assert.Equal(t, int64(syncs[1]+len(syncMarker)), skipped[0].Start)
+		assert.Equal(t, int64(syncs[2]+len(syncMarker)), skipped[0].End)
+		assert.False(t, skipped[0].Estimated)
+		assert.Equal(t, int64(2), skipped[0].Records)
+		var checksumErr *container.ChecksumError
+		assert.True(t, errors.As(skipped[0].Err, &checksumErr))
+	}
+}
+
+func TestRecoverDecodeError(t *testing.T) {
+	data := writeEventsWithCodec(t, container.Null, 8)
+	syncs := syncOffsets(data)
+	// Make the length of the name of the first record in the second block negative,
+	// after the block's record count and size and the record's id
+	data[syncs[1]+len(syncMarker)+3] = 0x01
+
+	ids, skipped := readRecovering(t, data)
+	assert.Equal(t, []int64{0, 1, 4, 5, 6, 7}, ids)
+	if assert.Equal(t, 1, len(skipped)) {
+		assert.Equal(t, int64(syncs[1]+len(syncMarker)), skipped[0].Start)
+		assert.Equal(t, int64(syncs[2]+len(syncMarker)), skipped[0].End)
+		assert.Equal(t, int64(2), skipped[0].Records)
+	}
+}
+
+func TestRecoverRecordOverrunningBlock(t *testing.T) {
+	data := writeEventsWithCodec(t, container.Null, 8)
+	syncs := syncOffsets(data)
+	// Make the name of the last record in the second block longer than the rest of the block,
+	// after the record's id
+	data[syncs[2]-6] = 0x20
+
+	ids, skipped := readRecovering(t, data)
+	assert.Equal(t, []int64{0, 1, 2, 4, 5, 6, 7}, ids)
+	if assert.Equal(t, 1, len(skipped)) {
+		assert.Equal(t, int64(syncs[1]+len(syncMarker)), skipped[0].Start)
+		assert.Equal(t, int64(syncs[2]+len(syncMarker)), skipped[0].End)
+		assert.Equal(t, int64(2), skipped[0].Records)
+		assert.True(t, errors.Is(skipped[0].Err, io.ErrUnexpectedEOF))
+	}
+
+	// Without recovery the record isn't decoded from the next block either
+	reader, err := NewEventReader(bytes.NewReader(data))
+	assert.Nil(t, err)
+	for i := 0; i < 3; i++ {
+		_, err = reader.Read()
+		assert.Nil(t, err)
+	}
+	_, err = reader.Read()
+	assert.True(t, errors.Is(err, io.ErrUnexpectedEOF))
+}
+
+func TestRecoverTrailingGarbage(t *testing.T) {
+	data := writeEventsWithCodec(t, container.Null, 4)
+	end := len(data)
+	data = append(data, []byte("this is not a block")...)
+
+	ids, skipped := readRecovering(t, data)
+	assert.Equal(t, []int64{0, 1, 2, 3}, ids)
+	if assert.Equal(t, 1, len(skipped)) {
+		assert.Equal(t, int64(end), skipped[0].Start)
+		assert.Equal(t, int64(len(data)), skipped[0].End)
+	}
+}
+
+func TestRecoverHandlerError(t *testing.T) {
+	data := writeEventsWithCodec(t, container.Null, 4)
+	data[syncOffsets(data)[1]+len(syncMarker)+1] = 0x7f
+
+	stop := errors.New("stop")
+	reader, err := NewEventReader(bytes.NewReader(data), container.WithRecovery(func(*container.SkippedRange) error {
+		return stop
+	}))
+	assert.Nil(t, err)
+	for i := 0; i < 2; i++ {
+		_, err = reader.Read()
+		assert.Nil(t, err)
+	}
+	_, err = reader.Read()
+	assert.True(t, errors.Is(err, stop))
+}
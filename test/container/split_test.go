@@ -0,0 +1,64 @@
+package avro
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/actgardner/gogen-avro/container"
+	"github.com/stretchr/testify/assert"
+)
+
+func readSplit(t *testing.T, data []byte, start, end int64) []int64 {
+	header, err := container.ReadHeader(bytes.NewReader(data))
+	assert.Nil(t, err)
+	split, err := container.NewSplitReader(header, bytes.NewReader(data), start, end)
+	assert.Nil(t, err)
+	reader, err := NewEventReaderFromContainer(split)
+	assert.Nil(t, err)
+
+	ids := make([]int64, 0)
+	for {
+		event, err := reader.Read()
+		if err == io.EOF {
+			return ids
+		}
+		if !assert.Nil(t, err) {
+			return ids
+		}
+		ids = append(ids, event.Id)
+	}
+}
+
+func TestSplitBoundaries(t *testing.T) {
+	data := writeEventsWithCodec(t, container.Deflate, 7)
+	syncs := syncOffsets(data)
+	header, err := container.ReadHeader(bytes.NewReader(data))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(syncs[0]+len(syncMarker)), header.Size)
+	assert.Equal(t, container.Deflate, header.Codec)
+
+	// A block belongs to the range its preceding sync marker starts in
+	assert.Equal(t, []int64{0, 1}, readSplit(t, data, 0, int64(syncs[1])))
+	assert.Equal(t, []int64{0, 1, 2, 3}, readSplit(t, data, 0, int64(syncs[1]+1)))
+	assert.Equal(t, []int64{}, readSplit(t, data, 0, int64(syncs[0])))
+	assert.Equal(t, []int64{2, 3, 4, 5}, readSplit(t, data, int64(syncs[0]+1), int64(syncs[2]+1)))
+	assert.Equal(t, []int64{6}, readSplit(t, data, int64(syncs[3]), int64(len(data))))
+	assert.Equal(t, []int64{}, readSplit(t, data, int64(syncs[3]+1), int64(len(data))))
+	assert.Equal(t, []int64{}, readSplit(t, data, int64(len(data)+10), int64(len(data)+20)))
+}
+
+func TestSplitsCoverFile(t *testing.T) {
+	data := writeEventsWithCodec(t, container.Snappy, 101)
+	for _, size := range []int64{1, 7, 16, 50, 333, int64(len(data))} {
+		ids := make([]int64, 0)
+		for start := int64(0); start < int64(len(data)); start += size {
+			ids = append(ids, readSplit(t, data, start, start+size)...)
+		}
+		if assert.Equal(t, 101, len(ids), "split size %v", size) {
+			for i, id := range ids {
+				assert.Equal(t, int64(i), id)
+			}
+		}
+	}
+}
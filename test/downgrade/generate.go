@@ -0,0 +1,5 @@
+package avro
+
+//go:generate $GOPATH/bin/gogen-avro . order.avsc
+//go:generate mkdir -p old
+//go:generate $GOPATH/bin/gogen-avro old old_order.avsc
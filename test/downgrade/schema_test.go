@@ -0,0 +1,239 @@
+package avro
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"testing"
+
+	"github.com/actgardner/gogen-avro/compiler"
+	old "github.com/actgardner/gogen-avro/test/downgrade/old"
+
+	"github.com/linkedin/goavro"
+	"github.com/stretchr/testify/assert"
+)
+
+// Round-trip some values through our serializer and goavro to verify
+const fixtureJson = `
+[
+{
+	"Id": 1234,
+	"Status": 1,
+	"Customer": {"Name": "Ada", "Email": "ada@example.com"},
+	"Payment": {"UnionType": 2, "Long": 500},
+	"Notes": "leave at the door",
+	"Quantity": 3,
+	"Tags": {"m": {"gift": "yes"}},
+	"Items": [{"Sku": "a-1", "Price": 1.5}, {"Sku": "b-2", "Price": 2.25}]
+},
+{
+	"Id": -5,
+	"Status": 0,
+	"Customer": {"Name": "", "Email": ""},
+	"Payment": {"UnionType": 0},
+	"Notes": "",
+	"Quantity": -2147483648,
+	"Tags": {"m": {}},
+	"Items": []
+}
+]
+`
+
+func fixtures(t testing.TB) []*Order {
+	records := make([]*Order, 0)
+	assert.Nil(t, json.Unmarshal([]byte(fixtureJson), &records))
+	return records
+}
+
+func goavroCodec(t *testing.T, file string) *goavro.Codec {
+	schemaJson, err := ioutil.ReadFile(file)
+	assert.Nil(t, err)
+	codec, err := goavro.NewCodec(string(schemaJson))
+	assert.Nil(t, err)
+	return codec
+}
+
+func goavroDecode(t *testing.T, codec *goavro.Codec, data []byte) map[string]interface{} {
+	datum, remaining, err := codec.NativeFromBinary(data)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(remaining))
+	return datum.(map[string]interface{})
+}
+
+func goavroTags(expected *Order) map[string]interface{} {
+	tags := make(map[string]interface{})
+	for k, v := range expected.Tags.M {
+		tags[k] = v
+	}
+	return tags
+}
+
+func compareFixtureGoAvro(t *testing.T, record map[string]interface{}, expected *Order) {
+	assert.Equal(t, expected.Id, record["id"])
+	assert.Equal(t, expected.Status.String(), record["status"])
+	assert.Equal(t, map[string]interface{}{"name": expected.Customer.Name, "email": expected.Customer.Email}, record["customer"])
+	switch expected.Payment.UnionType {
+	case UnionNullStringLongTypeEnumNull:
+		assert.Nil(t, record["payment"])
+	case UnionNullStringLongTypeEnumString:
+		assert.Equal(t, map[string]interface{}{"string": expected.Payment.String}, record["payment"])
+	case UnionNullStringLongTypeEnumLong:
+		assert.Equal(t, map[string]interface{}{"long": expected.Payment.Long}, record["payment"])
+	}
+	assert.Equal(t, expected.Notes, record["notes"])
+	assert.Equal(t, expected.Quantity, record["quantity"])
+	assert.Equal(t, goavroTags(expected), record["tags"])
+	items := make([]interface{}, 0)
+	for _, item := range expected.Items {
+		items = append(items, map[string]interface{}{"sku": item.Sku, "price": item.Price})
+	}
+	assert.Equal(t, items, record["items"])
+}
+
+// Compare a record decoded with the old schema to the record which was downgraded
+func compareDowngradedGoAvro(t *testing.T, record map[string]interface{}, expected *Order) {
+	assert.Equal(t, int32(3), record["priority"])
+	assert.Equal(t, expected.Id, record["id"])
+	assert.Equal(t, map[string]interface{}{"name": expected.Customer.Name, "tier": "basic"}, record["customer"])
+	assert.Equal(t, expected.Status.String(), record["status"])
+	if expected.Payment.UnionType == UnionNullStringLongTypeEnumNull {
+		assert.Nil(t, record["payment"])
+	} else {
+		assert.Equal(t, map[string]interface{}{"long": expected.Payment.Long}, record["payment"])
+	}
+	assert.Equal(t, int64(expected.Quantity), record["quantity"])
+	assert.Equal(t, goavroTags(expected), record["tags"])
+	items := make([]interface{}, 0)
+	for _, item := range expected.Items {
+		items = append(items, map[string]interface{}{"price": float64(item.Price), "sku": item.Sku})
+	}
+	assert.Equal(t, items, record["items"])
+}
+
+func downgrade(t testing.TB) *compiler.Downgrade {
+	d, err := compiler.CompileDowngradeBytes([]byte(NewOrder().Schema()), []byte(old.NewOrder().Schema()))
+	assert.Nil(t, err)
+	return d
+}
+
+func TestDowngrade(t *testing.T) {
+	codec := goavroCodec(t, "order.avsc")
+	oldCodec := goavroCodec(t, "old_order.avsc")
+	d := downgrade(t)
+
+	var buf bytes.Buffer
+	for _, f := range fixtures(t) {
+		buf.Reset()
+		assert.Nil(t, f.Serialize(&buf))
+		compareFixtureGoAvro(t, goavroDecode(t, codec, buf.Bytes()), f)
+
+		converted, err := d.Convert(buf.Bytes())
+		assert.Nil(t, err)
+		compareDowngradedGoAvro(t, goavroDecode(t, oldCodec, converted), f)
+	}
+}
+
+func TestDowngradeGeneratedTarget(t *testing.T) {
+	var buf bytes.Buffer
+	err := downgrade(t).Serialize(fixtures(t)[0], &buf)
+	assert.Nil(t, err)
+
+	order, err := old.DeserializeOrder(&buf)
+	assert.Nil(t, err)
+	assert.Equal(t, int32(3), order.Priority)
+	assert.Equal(t, int64(1234), order.Id)
+	assert.Equal(t, "Ada", order.Customer.Name)
+	assert.Equal(t, "basic", order.Customer.Tier)
+	assert.Equal(t, old.StatusSHIPPED, order.Status)
+	assert.Equal(t, old.UnionNullLongTypeEnumLong, order.Payment.UnionType)
+	assert.Equal(t, int64(500), order.Payment.Long)
+	assert.Equal(t, int64(3), order.Quantity)
+	assert.Equal(t, map[string]string{"gift": "yes"}, order.Tags.M)
+	assert.Equal(t, []*old.Item{{Price: 1.5, Sku: "a-1"}, {Price: 2.25, Sku: "b-2"}}, order.Items)
+}
+
+func TestDowngradeNull(t *testing.T) {
+	var buf bytes.Buffer
+	err := downgrade(t).Serialize(fixtures(t)[1], &buf)
+	assert.Nil(t, err)
+
+	order, err := old.DeserializeOrder(&buf)
+	assert.Nil(t, err)
+	assert.Equal(t, old.StatusPENDING, order.Status)
+	assert.Equal(t, old.UnionNullLongTypeEnumNull, order.Payment.UnionType)
+}
+
+func TestDowngradeUnrepresentable(t *testing.T) {
+	record := fixtures(t)[0]
+	record.Status = StatusRETURNED
+	err := downgrade(t).Serialize(record, &bytes.Buffer{})
+	assert.EqualError(t, err, `Unable to downgrade Order.status: the target schema has no enum symbol "RETURNED"`)
+
+	record = fixtures(t)[0]
+	record.Payment = &UnionNullStringLong{UnionType: UnionNullStringLongTypeEnumString, String: "card"}
+	err = downgrade(t).Serialize(record, &bytes.Buffer{})
+	assert.EqualError(t, err, "Unable to downgrade Order.payment: the target schema has no type String in the union")
+}
+
+func TestDowngradeTruncated(t *testing.T) {
+	var buf bytes.Buffer
+	assert.Nil(t, fixtures(t)[0].Serialize(&buf))
+
+	d := downgrade(t)
+	for i := 0; i < buf.Len(); i++ {
+		_, err := d.Convert(buf.Bytes()[:i])
+		assert.NotNil(t, err)
+	}
+	_, err := d.Convert(append(buf.Bytes(), 0))
+	assert.NotNil(t, err)
+}
+
+const (
+	countsSchema    = `{"type": "record", "name": "Counts", "fields": [{"name": "total", "type": "long"}, {"name": "last", "type": ["null", "long"]}]}`
+	oldCountsSchema = `{"type": "record", "name": "Counts", "fields": [{"name": "total", "type": "int"}, {"name": "last", "type": ["null", "int"]}]}`
+)
+
+func TestDowngradeLongToInt(t *testing.T) {
+	d, err := compiler.CompileDowngradeBytes([]byte(countsSchema), []byte(oldCountsSchema))
+	assert.Nil(t, err)
+
+	codec, err := goavro.NewCodec(countsSchema)
+	assert.Nil(t, err)
+	oldCodec, err := goavro.NewCodec(oldCountsSchema)
+	assert.Nil(t, err)
+
+	data, err := codec.BinaryFromNative(nil, map[string]interface{}{"total": int64(-2147483648), "last": goavro.Union("long", int64(2147483647))})
+	assert.Nil(t, err)
+	converted, err := d.Convert(data)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"total": int32(-2147483648), "last": goavro.Union("int", int32(2147483647))}, goavroDecode(t, oldCodec, converted))
+
+	data, err = codec.BinaryFromNative(nil, map[string]interface{}{"total": int64(1) << 40, "last": nil})
+	assert.Nil(t, err)
+	_, err = d.Convert(data)
+	assert.EqualError(t, err, "Unable to downgrade Counts.total: 1099511627776 doesn't fit in an int")
+
+	data, err = codec.BinaryFromNative(nil, map[string]interface{}{"total": int64(1), "last": goavro.Union("long", int64(-2147483649))})
+	assert.Nil(t, err)
+	_, err = d.Convert(data)
+	assert.EqualError(t, err, "Unable to downgrade Counts.last: -2147483649 doesn't fit in an int")
+}
+
+func TestDowngradeIncompatible(t *testing.T) {
+	_, err := compiler.CompileDowngradeBytes([]byte(old.NewOrder().Schema()), []byte(NewOrder().Schema()))
+	assert.NotNil(t, err)
+}
+
+func BenchmarkDowngrade(b *testing.B) {
+	var buf bytes.Buffer
+	assert.Nil(b, fixtures(b)[0].Serialize(&buf))
+	d := downgrade(b)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := d.Convert(buf.Bytes()); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package avro
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/actgardner/gogen-avro/vm"
+	"github.com/stretchr/testify/assert"
+)
+
+func serializedOrder(t *testing.T) []byte {
+	order := &Order{
+		Id: 1,
+		Items: []*Item{
+			{Name: "first", Price: 1.5},
+			{Name: "second", Price: 2.5},
+		},
+		Tags: NewMapItem(),
+	}
+	order.Tags.M["tag"] = &Item{Name: "third", Price: 3.5}
+	var buf bytes.Buffer
+	assert.Nil(t, order.Serialize(&buf))
+	return buf.Bytes()
+}
+
+func TestEvalErrorPath(t *testing.T) {
+	data := serializedOrder(t)
+
+	// Truncate the input in the middle of the price of the second item
+	end := bytes.Index(data, []byte("second")) + len("second") + 4
+	_, err := DeserializeOrder(bytes.NewReader(data[:end]))
+
+	evalErr, ok := err.(*vm.EvalError)
+	if !assert.True(t, ok, "Expected an EvalError, got %v", err) {
+		return
+	}
+	assert.Equal(t, "Order.items[1].price", evalErr.Path)
+	assert.Equal(t, "double", evalErr.WireType)
+	assert.Equal(t, int64(end), evalErr.Offset)
+	assert.Equal(t, io.ErrUnexpectedEOF, evalErr.Err)
+}
+
+func TestEvalErrorMapPath(t *testing.T) {
+	data := serializedOrder(t)
+
+	end := bytes.Index(data, []byte("third")) + 2
+	_, err := DeserializeOrder(bytes.NewReader(data[:end]))
+
+	evalErr, ok := err.(*vm.EvalError)
+	if !assert.True(t, ok, "Expected an EvalError, got %v", err) {
+		return
+	}
+	assert.Equal(t, `Order.tags["tag"].name`, evalErr.Path)
+	assert.Equal(t, "string", evalErr.WireType)
+}
+
+func TestEvalErrorEndOfStream(t *testing.T) {
+	_, err := DeserializeOrder(bytes.NewReader(nil))
+	assert.Equal(t, io.EOF, err)
+}
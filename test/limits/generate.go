@@ -0,0 +1,3 @@
+package avro
+
+//go:generate $GOPATH/bin/gogen-avro . limits.avsc
@@ -0,0 +1,151 @@
+package avro
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"testing"
+
+	"github.com/actgardner/gogen-avro/compiler"
+	"github.com/actgardner/gogen-avro/container"
+	"github.com/actgardner/gogen-avro/vm"
+	"github.com/linkedin/goavro"
+	"github.com/stretchr/testify/assert"
+)
+
+// Records nested 1, 3 and 5 deep
+const fixtureJson = `
+[
+{"Name": "a record with a reasonably long name", "Values": [1, 2, 3, 4, 5, 6, 7, 8], "Next": {"UnionType": 0}},
+{"Name": "a record with a reasonably long name", "Values": [1, 2, 3, 4, 5, 6, 7, 8], "Next": {"UnionType": 1, "LimitsTestRecord":
+	{"Name": "a record with a reasonably long name", "Values": [1, 2, 3, 4, 5, 6, 7, 8], "Next": {"UnionType": 1, "LimitsTestRecord":
+		{"Name": "a record with a reasonably long name", "Values": [1, 2, 3, 4, 5, 6, 7, 8], "Next": {"UnionType": 0}}}}}},
+{"Name": "1", "Values": [], "Next": {"UnionType": 1, "LimitsTestRecord":
+	{"Name": "2", "Values": [], "Next": {"UnionType": 1, "LimitsTestRecord":
+		{"Name": "3", "Values": [], "Next": {"UnionType": 1, "LimitsTestRecord":
+			{"Name": "4", "Values": [], "Next": {"UnionType": 1, "LimitsTestRecord":
+				{"Name": "5", "Values": [], "Next": {"UnionType": 0}}}}}}}}}}
+]
+`
+
+func fixtures(t *testing.T) []*LimitsTestRecord {
+	records := make([]*LimitsTestRecord, 0)
+	assert.Nil(t, json.Unmarshal([]byte(fixtureJson), &records))
+	return records
+}
+
+func compareFixtureGoAvro(t *testing.T, actual interface{}, expected *LimitsTestRecord) {
+	record := actual.(map[string]interface{})
+	assert.Equal(t, expected.Name, record["Name"])
+	values := make([]interface{}, 0)
+	for _, v := range expected.Values {
+		values = append(values, v)
+	}
+	assert.Equal(t, values, record["Values"])
+	if expected.Next.UnionType == UnionNullLimitsTestRecordTypeEnumNull {
+		assert.Nil(t, record["Next"])
+		return
+	}
+	next := record["Next"].(map[string]interface{})
+	compareFixtureGoAvro(t, next["LimitsTestRecord"], expected.Next.LimitsTestRecord)
+}
+
+func TestLimitsFixture(t *testing.T) {
+	schemaJson, err := ioutil.ReadFile("limits.avsc")
+	assert.Nil(t, err)
+	codec, err := goavro.NewCodec(string(schemaJson))
+	assert.Nil(t, err)
+
+	var buf bytes.Buffer
+	for _, f := range fixtures(t) {
+		buf.Reset()
+		assert.Nil(t, f.Serialize(&buf))
+
+		datum, remaining, err := codec.NativeFromBinary(buf.Bytes())
+		assert.Nil(t, err)
+		assert.Equal(t, 0, len(remaining))
+		compareFixtureGoAvro(t, datum, f)
+
+		// The records are within generous limits
+		assert.Nil(t, evalWithLimits(t, f, vm.Limits{MaxBytesLength: 64, MaxBlockItems: 8, MaxItems: 8, MaxDepth: 20, MaxBytesRead: 1024}))
+	}
+}
+
+func evalWithLimits(t *testing.T, record *LimitsTestRecord, limits vm.Limits) error {
+	var buf bytes.Buffer
+	assert.Nil(t, record.Serialize(&buf))
+
+	program, err := compiler.CompileSchemaBytes([]byte(record.Schema()), []byte(record.Schema()))
+	assert.Nil(t, err)
+	return vm.EvalWithOptions(&buf, program, NewLimitsTestRecord(), &vm.Options{Limits: limits})
+}
+
+func assertLimitError(t *testing.T, err error, kind vm.LimitKind, path string) {
+	evalErr, ok := err.(*vm.EvalError)
+	if !assert.True(t, ok, "Expected an EvalError, got %v", err) {
+		return
+	}
+	limitErr, ok := evalErr.Err.(*vm.LimitError)
+	if !assert.True(t, ok, "Expected a LimitError, got %v", evalErr.Err) {
+		return
+	}
+	assert.Equal(t, kind, limitErr.Kind)
+	assert.Equal(t, path, evalErr.Path)
+}
+
+func TestBytesLengthLimit(t *testing.T) {
+	err := evalWithLimits(t, fixtures(t)[0], vm.Limits{MaxBytesLength: 8})
+	assertLimitError(t, err, vm.BytesLengthLimit, "LimitsTestRecord.Name")
+}
+
+func TestBlockItemsLimit(t *testing.T) {
+	err := evalWithLimits(t, fixtures(t)[0], vm.Limits{MaxBlockItems: 4})
+	assertLimitError(t, err, vm.BlockItemsLimit, "LimitsTestRecord.Values")
+}
+
+func TestItemsLimit(t *testing.T) {
+	err := evalWithLimits(t, fixtures(t)[0], vm.Limits{MaxItems: 7})
+	assertLimitError(t, err, vm.ItemsLimit, "LimitsTestRecord.Values")
+}
+
+func TestDepthLimit(t *testing.T) {
+	err := evalWithLimits(t, fixtures(t)[2], vm.Limits{MaxDepth: 8})
+	assertLimitError(t, err, vm.DepthLimit, "LimitsTestRecord.Next.Next.Next.Next.Name")
+}
+
+func TestBytesReadLimit(t *testing.T) {
+	// The first record is 48 bytes long, so the limit is hit reading the name of the second
+	err := evalWithLimits(t, fixtures(t)[1], vm.Limits{MaxBytesRead: 64})
+	assertLimitError(t, err, vm.BytesReadLimit, "LimitsTestRecord.Next.Name")
+}
+
+func TestContainerBlockLimits(t *testing.T) {
+	var buf bytes.Buffer
+	writer, err := NewLimitsTestRecordWriter(&buf, container.Null, 10)
+	assert.Nil(t, err)
+	for i := 0; i < 10; i++ {
+		assert.Nil(t, writer.WriteRecord(fixtures(t)[0]))
+	}
+	assert.Nil(t, writer.Flush())
+
+	reader, err := NewLimitsTestRecordReaderWithLimits(bytes.NewReader(buf.Bytes()), vm.Limits{MaxBlockItems: 20})
+	assert.Nil(t, err)
+	_, err = reader.Read()
+	assert.Nil(t, err)
+
+	reader, err = NewLimitsTestRecordReaderWithLimits(bytes.NewReader(buf.Bytes()), vm.Limits{MaxBlockItems: 5})
+	assert.Nil(t, err)
+	_, err = reader.Read()
+	var limitErr *vm.LimitError
+	if assert.True(t, errors.As(err, &limitErr), "Expected a LimitError, got %v", err) {
+		assert.Equal(t, vm.BlockItemsLimit, limitErr.Kind)
+	}
+
+	reader, err = NewLimitsTestRecordReaderWithLimits(bytes.NewReader(buf.Bytes()), vm.Limits{MaxBytesLength: 100})
+	assert.Nil(t, err)
+	_, err = reader.Read()
+	if assert.True(t, errors.As(err, &limitErr), "Expected a LimitError, got %v", err) {
+		assert.Equal(t, vm.BytesLengthLimit, limitErr.Kind)
+	}
+}
@@ -0,0 +1,298 @@
+package avro
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/actgardner/gogen-avro/compiler"
+	"github.com/actgardner/gogen-avro/container"
+	"github.com/actgardner/gogen-avro/vm"
+
+	"github.com/linkedin/goavro"
+	"github.com/stretchr/testify/assert"
+)
+
+// Round-trip some values through our serializer and goavro to verify
+const fixtureJson = `
+[
+{
+	"IntField": 1,
+	"StringField": "abc",
+	"NestedField": {"BytesField": "AQID", "DoubleField": 4.5},
+	"ArrayField": [{"BytesField": "AQID", "DoubleField": 4.5}, {"BytesField": "BAU=", "DoubleField": -1}],
+	"MapField": {"m": {"a": 2}},
+	"UnionField": {"UnionType": 2, "PrecompiledNestedRecord": {"BytesField": "AQID", "DoubleField": 4.5}},
+	"FixedField": [1, 2, 3, 4]
+},
+{
+	"IntField": -2147483647,
+	"StringField": "a slightly longer string",
+	"NestedField": {"BytesField": "", "DoubleField": 1.7976931348623157e+308},
+	"ArrayField": [],
+	"MapField": {"m": {}},
+	"UnionField": {"UnionType": 1, "String": "xyz"},
+	"FixedField": [0, 0, 0, 0]
+},
+{
+	"IntField": 0,
+	"StringField": "",
+	"NestedField": {"BytesField": "VGhpcyBpcyBhIHRlc3Qgc3RyaW5n", "DoubleField": 0},
+	"ArrayField": [{"BytesField": "", "DoubleField": 2.2250738585072014e-308}],
+	"MapField": {"m": {"b": -9223372036854775807, "c": 0}},
+	"UnionField": {"UnionType": 0},
+	"FixedField": [255, 254, 253, 252]
+}
+]
+`
+
+func fixtures(t testing.TB) []*PrecompiledTestRecord {
+	records := make([]*PrecompiledTestRecord, 0)
+	assert.Nil(t, json.Unmarshal([]byte(fixtureJson), &records))
+	return records
+}
+
+func fixtureBytes(t testing.TB, record *PrecompiledTestRecord) []byte {
+	var buf bytes.Buffer
+	assert.Nil(t, record.Serialize(&buf))
+	return buf.Bytes()
+}
+
+func compareNestedGoAvro(t *testing.T, actual interface{}, expected *PrecompiledNestedRecord) {
+	record := actual.(map[string]interface{})
+	assert.Equal(t, expected.BytesField, record["BytesField"])
+	assert.Equal(t, expected.DoubleField, record["DoubleField"])
+}
+
+func compareFixtureGoAvro(t *testing.T, actual interface{}, expected *PrecompiledTestRecord) {
+	record := actual.(map[string]interface{})
+	assert.Equal(t, expected.IntField, record["IntField"])
+	assert.Equal(t, expected.StringField, record["StringField"])
+	compareNestedGoAvro(t, record["NestedField"], expected.NestedField)
+
+	items := record["ArrayField"].([]interface{})
+	if assert.Equal(t, len(expected.ArrayField), len(items)) {
+		for i, item := range items {
+			compareNestedGoAvro(t, item, expected.ArrayField[i])
+		}
+	}
+
+	values := record["MapField"].(map[string]interface{})
+	assert.Equal(t, len(expected.MapField.M), len(values))
+	for key, value := range values {
+		assert.Equal(t, expected.MapField.M[key], value)
+	}
+
+	switch expected.UnionField.UnionType {
+	case UnionNullStringPrecompiledNestedRecordTypeEnumNull:
+		assert.Nil(t, record["UnionField"])
+	case UnionNullStringPrecompiledNestedRecordTypeEnumString:
+		assert.Equal(t, map[string]interface{}{"string": expected.UnionField.String}, record["UnionField"])
+	case UnionNullStringPrecompiledNestedRecordTypeEnumPrecompiledNestedRecord:
+		union := record["UnionField"].(map[string]interface{})
+		compareNestedGoAvro(t, union["PrecompiledNestedRecord"], expected.UnionField.PrecompiledNestedRecord)
+	}
+
+	assert.Equal(t, expected.FixedField[:], record["FixedField"])
+}
+
+func goavroCodec(t *testing.T) *goavro.Codec {
+	schemaJson, err := ioutil.ReadFile("precompiled.avsc")
+	assert.Nil(t, err)
+	codec, err := goavro.NewCodec(string(schemaJson))
+	assert.Nil(t, err)
+	return codec
+}
+
+func TestPrecompiledFixture(t *testing.T) {
+	codec := goavroCodec(t)
+	for _, f := range fixtures(t) {
+		recordBytes := fixtureBytes(t, f)
+		datum, remaining, err := codec.NativeFromBinary(recordBytes)
+		assert.Nil(t, err)
+		assert.Equal(t, 0, len(remaining))
+		compareFixtureGoAvro(t, datum, f)
+
+		// The precompiled deserializer decodes the same values as goavro
+		decoded, err := DeserializePrecompiledTestRecord(bytes.NewReader(recordBytes))
+		assert.Nil(t, err)
+		compareFixtureGoAvro(t, datum, decoded)
+	}
+}
+
+func TestPrecompiledProgramMatchesCompiler(t *testing.T) {
+	record := NewPrecompiledTestRecord()
+	program, err := compiler.CompileSchemaBytes([]byte(record.Schema()), []byte(record.Schema()))
+	assert.Nil(t, err)
+	assert.Equal(t, program.Instructions, _PrecompiledTestRecordProgram.Instructions)
+	assert.Equal(t, program.Errors, _PrecompiledTestRecordProgram.Errors)
+}
+
+func BenchmarkDeserializePrecompiled(b *testing.B) {
+	recordBytes := fixtureBytes(b, fixtures(b)[0])
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := DeserializePrecompiledTestRecord(bytes.NewReader(recordBytes))
+		assert.Nil(b, err)
+	}
+}
+
+// Compare decoding from an io.Reader and from a byte slice, with and without copying strings
+func BenchmarkEvalReader(b *testing.B) {
+	recordBytes := fixtureBytes(b, fixtures(b)[0])
+	r := bytes.NewReader(recordBytes)
+	target := NewPrecompiledTestRecord()
+	opts := &vm.Options{ReuseBuffers: true}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r.Reset(recordBytes)
+		if err := vm.EvalWithOptions(r, _PrecompiledTestRecordProgram, target, opts); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkEvalBytes(b *testing.B) {
+	benchmarkEvalBytes(b, &vm.Options{ReuseBuffers: true})
+}
+
+func BenchmarkEvalBytesZeroCopy(b *testing.B) {
+	benchmarkEvalBytes(b, &vm.Options{ZeroCopy: true})
+}
+
+func benchmarkEvalBytes(b *testing.B, opts *vm.Options) {
+	recordBytes := fixtureBytes(b, fixtures(b)[0])
+	target := NewPrecompiledTestRecord()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := vm.EvalBytesWithOptions(recordBytes, _PrecompiledTestRecordProgram, target, opts); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestEvalBytes(t *testing.T) {
+	codec := goavroCodec(t)
+	for _, f := range fixtures(t) {
+		recordBytes := fixtureBytes(t, f)
+		datum, _, err := codec.NativeFromBinary(recordBytes)
+		assert.Nil(t, err)
+
+		for _, opts := range []*vm.Options{nil, {ZeroCopy: true}} {
+			target := NewPrecompiledTestRecord()
+			err = vm.EvalBytesWithOptions(recordBytes, _PrecompiledTestRecordProgram, target, opts)
+			assert.Nil(t, err)
+			compareFixtureGoAvro(t, datum, target)
+		}
+	}
+
+	recordBytes := fixtureBytes(t, fixtures(t)[0])
+	err := vm.EvalBytes(recordBytes[:len(recordBytes)-1], _PrecompiledTestRecordProgram, NewPrecompiledTestRecord())
+	evalErr, ok := err.(*vm.EvalError)
+	if assert.True(t, ok, "Expected an EvalError, got %v", err) {
+		assert.Equal(t, io.ErrUnexpectedEOF, evalErr.Err)
+	}
+}
+
+func TestZeroCopyAliasing(t *testing.T) {
+	expected := fixtures(t)[0]
+	for _, zeroCopy := range []bool{false, true} {
+		recordBytes := fixtureBytes(t, expected)
+		target := NewPrecompiledTestRecord()
+		err := vm.EvalBytesWithOptions(recordBytes, _PrecompiledTestRecordProgram, target, &vm.Options{ZeroCopy: zeroCopy})
+		assert.Nil(t, err)
+
+		// Overwrite the input: only the strings decoded without copying see the change
+		for i := range recordBytes {
+			recordBytes[i] = 'x'
+		}
+		if zeroCopy {
+			assert.Equal(t, "xxx", target.StringField)
+		} else {
+			assert.Equal(t, expected.StringField, target.StringField)
+		}
+		assert.Equal(t, expected.NestedField.BytesField, target.NestedField.BytesField)
+		assert.Equal(t, expected.ArrayField[1].BytesField, target.ArrayField[1].BytesField)
+		assert.Equal(t, expected.FixedField, target.FixedField)
+	}
+}
+
+func TestDeserializeIntoReusesTarget(t *testing.T) {
+	record := fixtures(t)[0]
+	recordBytes := fixtureBytes(t, record)
+
+	target := NewPrecompiledTestRecord()
+	err := DeserializePrecompiledTestRecordInto(bytes.NewReader(recordBytes), target)
+	assert.Nil(t, err)
+
+	firstElem := target.ArrayField[0]
+	firstBytes := &target.NestedField.BytesField[0]
+
+	err = DeserializePrecompiledTestRecordInto(bytes.NewReader(recordBytes), target)
+	assert.Nil(t, err)
+	assert.Equal(t, record.ArrayField, target.ArrayField)
+	assert.Equal(t, record.MapField.M, target.MapField.M)
+	assert.Equal(t, record.UnionField, target.UnionField)
+	assert.True(t, firstElem == target.ArrayField[0], "array elements should be reused")
+	assert.True(t, firstBytes == &target.NestedField.BytesField[0], "bytes should be decoded into the existing buffer")
+}
+
+func TestDeserializeIntoClearsUnionBranch(t *testing.T) {
+	// The first fixture has a nested record in the union and the second has a string
+	records := fixtures(t)
+	buf := bytes.NewBuffer(fixtureBytes(t, records[0]))
+	buf.Write(fixtureBytes(t, records[1]))
+
+	target := NewPrecompiledTestRecord()
+	err := DeserializePrecompiledTestRecordInto(buf, target)
+	assert.Nil(t, err)
+	assert.NotNil(t, target.UnionField.PrecompiledNestedRecord)
+
+	// The nested record decoded before isn't left in the union once the string branch is selected
+	err = DeserializePrecompiledTestRecordInto(buf, target)
+	assert.Nil(t, err)
+	assert.Equal(t, records[1].UnionField, target.UnionField)
+	assert.Nil(t, target.UnionField.PrecompiledNestedRecord)
+}
+
+func TestReaderReadInto(t *testing.T) {
+	var buf bytes.Buffer
+	writer, err := NewPrecompiledTestRecordWriter(&buf, container.Null, 10)
+	assert.Nil(t, err)
+	for i := 0; i < 5; i++ {
+		record := fixtures(t)[0]
+		record.IntField = int32(i)
+		assert.Nil(t, writer.WriteRecord(record))
+	}
+	assert.Nil(t, writer.Flush())
+
+	reader, err := NewPrecompiledTestRecordReader(bytes.NewReader(buf.Bytes()))
+	assert.Nil(t, err)
+
+	target := NewPrecompiledTestRecord()
+	for i := 0; i < 5; i++ {
+		err = reader.ReadInto(target)
+		assert.Nil(t, err)
+		assert.Equal(t, int32(i), target.IntField)
+		assert.Equal(t, fixtures(t)[0].ArrayField, target.ArrayField)
+	}
+}
+
+func TestDeserializeIntoAllocations(t *testing.T) {
+	r := bytes.NewReader(fixtureBytes(t, fixtures(t)[0]))
+
+	target := NewPrecompiledTestRecord()
+	opts := &vm.Options{ReuseBuffers: true}
+	allocs := testing.AllocsPerRun(100, func() {
+		r.Seek(0, io.SeekStart)
+		err := vm.EvalWithOptions(r, _PrecompiledTestRecordProgram, target, opts)
+		assert.Nil(t, err)
+	})
+	// The evaluator state, the string field and the map wrapper's key and value buffers
+	assert.True(t, allocs <= 4, "expected at most 4 allocations per decode, got %v", allocs)
+}
@@ -0,0 +1,5 @@
+package avro
+
+//go:generate $GOPATH/bin/gogen-avro . order.avsc
+//go:generate mkdir -p projected
+//go:generate $GOPATH/bin/gogen-avro projected projected.avsc
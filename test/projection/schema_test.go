@@ -0,0 +1,204 @@
+package avro
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"testing"
+
+	"github.com/actgardner/gogen-avro/compiler"
+	"github.com/actgardner/gogen-avro/generic"
+	"github.com/actgardner/gogen-avro/schema"
+	projected "github.com/actgardner/gogen-avro/test/projection/projected"
+	"github.com/actgardner/gogen-avro/vm"
+
+	"github.com/linkedin/goavro"
+	"github.com/stretchr/testify/assert"
+)
+
+var projectionPaths = []string{"id", "user.address.city", "items[].sku"}
+
+// Round-trip some values through our serializer and goavro to verify
+const fixtureJson = `
+[
+{
+	"id": 17,
+	"user": {"name": "A. User", "address": {"UnionType": 1, "Address": {"street": "1 Main St", "city": "Springfield", "zip": 12345}}},
+	"items": [
+		{"sku": "sku-1", "quantity": 1, "tags": ["a", "b"]},
+		{"sku": "sku-2", "quantity": 2, "tags": []}
+	],
+	"notes": {"m": {"gift": "yes"}}
+},
+{
+	"id": -1,
+	"user": {"name": "", "address": {"UnionType": 0}},
+	"items": [],
+	"notes": {"m": {}}
+}
+]
+`
+
+func fixtures(t *testing.T) []*Order {
+	records := make([]*Order, 0)
+	assert.Nil(t, json.Unmarshal([]byte(fixtureJson), &records))
+	return records
+}
+
+// Serialize the fixture, and decode it with goavro to get the values projections are expected to read
+func serialize(t *testing.T, order *Order) ([]byte, map[string]interface{}) {
+	var buf bytes.Buffer
+	assert.Nil(t, order.Serialize(&buf))
+
+	schemaJson, err := ioutil.ReadFile("order.avsc")
+	assert.Nil(t, err)
+	codec, err := goavro.NewCodec(string(schemaJson))
+	assert.Nil(t, err)
+	datum, remaining, err := codec.NativeFromBinary(buf.Bytes())
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(remaining))
+	return buf.Bytes(), datum.(map[string]interface{})
+}
+
+// The goavro address record of an order, or nil
+func goavroAddress(order map[string]interface{}) map[string]interface{} {
+	address := order["user"].(map[string]interface{})["address"]
+	if address == nil {
+		return nil
+	}
+	return address.(map[string]interface{})["Address"].(map[string]interface{})
+}
+
+func TestProjectionGenericTarget(t *testing.T) {
+	writer := parse(t, NewOrder().Schema())
+	reader, err := schema.Project(writer, projectionPaths)
+	assert.Nil(t, err)
+
+	program, err := compiler.CompileProjection(writer, projectionPaths)
+	assert.Nil(t, err)
+
+	for _, f := range fixtures(t) {
+		data, order := serialize(t, f)
+		datum := generic.NewDatum(reader)
+		err = vm.EvalBytes(data, program, datum)
+		assert.Nil(t, err)
+
+		var address interface{}
+		if a := goavroAddress(order); a != nil {
+			address = map[string]interface{}{"city": a["city"]}
+		}
+		items := make([]interface{}, 0)
+		for _, item := range order["items"].([]interface{}) {
+			items = append(items, map[string]interface{}{"sku": item.(map[string]interface{})["sku"]})
+		}
+		expected := map[string]interface{}{
+			"id":    order["id"],
+			"user":  map[string]interface{}{"address": address},
+			"items": items,
+		}
+		assert.Equal(t, expected, datum.Value())
+	}
+}
+
+func TestProjectionGeneratedTarget(t *testing.T) {
+	program, err := compiler.CompileProjectionBytes([]byte(NewOrder().Schema()), projectionPaths)
+	assert.Nil(t, err)
+
+	for _, f := range fixtures(t) {
+		data, order := serialize(t, f)
+		target := projected.NewOrder()
+		err = vm.EvalBytes(data, program, target)
+		assert.Nil(t, err)
+		assert.Equal(t, order["id"], target.Id)
+		if a := goavroAddress(order); a != nil {
+			assert.Equal(t, a["city"], target.User.Address.Address.City)
+		} else {
+			assert.Equal(t, projected.UnionNullAddressTypeEnumNull, target.User.Address.UnionType)
+		}
+		items := order["items"].([]interface{})
+		if assert.Equal(t, len(items), len(target.Items)) {
+			for i, item := range items {
+				assert.Equal(t, item.(map[string]interface{})["sku"], target.Items[i].Sku)
+			}
+		}
+	}
+}
+
+func TestProjectionWholeField(t *testing.T) {
+	writer := parse(t, NewOrder().Schema())
+	reader, err := schema.Project(writer, []string{"items", "items[].sku", "notes"})
+	assert.Nil(t, err)
+
+	program, err := compiler.Compile(writer, reader)
+	assert.Nil(t, err)
+
+	for _, f := range fixtures(t) {
+		data, order := serialize(t, f)
+		datum := generic.NewDatum(reader)
+		err = vm.EvalBytes(data, program, datum)
+		assert.Nil(t, err)
+
+		// Whole fields are decoded like goavro decodes them
+		expected := map[string]interface{}{
+			"items": order["items"],
+			"notes": order["notes"],
+		}
+		assert.Equal(t, expected, datum.Value())
+	}
+}
+
+const defaultsSchema = `{"type": "record", "name": "Order", "fields": [
+	{"name": "id", "type": "long"},
+	{"name": "count", "type": "int", "default": 7},
+	{"name": "ratio", "type": "float", "default": 0.5},
+	{"name": "token", "type": "bytes", "default": "\u00ff\u0001"},
+	{"name": "origin", "type": {"type": "record", "name": "Origin", "fields": [
+		{"name": "zip", "type": "int"},
+		{"name": "ids", "type": {"type": "array", "items": "long"}},
+		{"name": "kind", "type": {"type": "enum", "name": "Kind", "symbols": ["A", "B"]}},
+		{"name": "note", "type": ["null", "string"], "default": null}
+	]}, "default": {"zip": 12345, "ids": [1, 2], "kind": "B"}}
+]}`
+
+func TestProjectionGenericDefaults(t *testing.T) {
+	writer := parse(t, NewOrder().Schema())
+	reader := parse(t, defaultsSchema)
+	program, err := compiler.Compile(writer, reader)
+	assert.Nil(t, err)
+
+	data, order := serialize(t, fixtures(t)[0])
+	datum := generic.NewDatum(reader)
+	err = vm.EvalBytes(data, program, datum)
+	assert.Nil(t, err)
+
+	// Defaults have the same types as values decoded from data
+	expected := map[string]interface{}{
+		"id":    order["id"],
+		"count": int32(7),
+		"ratio": float32(0.5),
+		"token": []byte{0xff, 0x01},
+		"origin": map[string]interface{}{
+			"zip":  int32(12345),
+			"ids":  []interface{}{int64(1), int64(2)},
+			"kind": "B",
+			"note": nil,
+		},
+	}
+	assert.Equal(t, expected, datum.Value())
+}
+
+func TestProjectionInvalidPaths(t *testing.T) {
+	writer := parse(t, NewOrder().Schema())
+	for _, path := range []string{"", "missing", "id.value", "user[].name", "items.sku", "user.address.country"} {
+		_, err := schema.Project(writer, []string{path})
+		assert.NotNil(t, err, "Expected an error for path %q", path)
+	}
+}
+
+func parse(t *testing.T, s string) schema.AvroType {
+	ns := schema.NewNamespace(false)
+	writer, err := ns.TypeForSchema([]byte(s))
+	assert.Nil(t, err)
+	assert.Nil(t, writer.ResolveReferences(ns))
+	return writer
+}
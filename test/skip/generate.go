@@ -0,0 +1,5 @@
+package avro
+
+//go:generate $GOPATH/bin/gogen-avro . writer.avsc
+//go:generate mkdir -p projection
+//go:generate $GOPATH/bin/gogen-avro projection projection.avsc
@@ -0,0 +1,216 @@
+package avro
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"testing"
+
+	"github.com/actgardner/gogen-avro/compiler"
+	projection "github.com/actgardner/gogen-avro/test/skip/projection"
+	"github.com/actgardner/gogen-avro/vm"
+	"github.com/actgardner/gogen-avro/vm/types"
+
+	"github.com/linkedin/goavro"
+	"github.com/stretchr/testify/assert"
+)
+
+// Round-trip some values through our serializer and goavro to verify
+const fixtureJson = `
+[
+{
+	"Name": "a record with lots of fields",
+	"Payload": "paWlpaWlpaWlpaWlpaWlpaWlpaWlpaWlpaWlpaWlpaWlpaWlpaWlpaWlpaWlpaWlpaWlpaWlpaWlpaWlpaWlpaWlpaWlpaWlpaWlpaWlpaWlpaWlpaWlpaWlpaWlpaWlpaWlpaWlpaWlpaWlpaWlpaWlpaWlpaWlpaWlpaWlpaWlpaWlpaWlpaWlpaWlpaWlpaWlpaWlpaWlpaWlpaWlpaWlpaWlpaWlpaWlpaWlpaWlpaWlpaWlpaWlpaWlpaWlpaWlpaWlpaWlpaWlpaWlpaWlpaWlpaWlpaWlpaWlpaWlpaWlpaWlpaWlpaWlpaWlpaWlpaWlpaWlpaWlpaWlpQ==",
+	"Hash": [0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15],
+	"Tags": ["one", "two", "three"],
+	"Attributes": {"m": {"key": "value", "other key": "other value"}},
+	"Children": [
+		{"Label": "child", "Weight": 0, "Enabled": true, "Score": 1.5},
+		{"Label": "child", "Weight": 1, "Enabled": false, "Score": 2.5},
+		{"Label": "another child", "Weight": -2.25, "Enabled": true, "Score": 0}
+	],
+	"Id": 1234567,
+	"Note": {"UnionType": 1, "String": "note"},
+	"Count": 42
+},
+{
+	"Name": "",
+	"Payload": "",
+	"Hash": [0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0],
+	"Tags": [],
+	"Attributes": {"m": {}},
+	"Children": [],
+	"Id": -9223372036854775807,
+	"Note": {"UnionType": 0},
+	"Count": -1
+}
+]
+`
+
+func fixtures(t testing.TB) []*SkipTestRecord {
+	records := make([]*SkipTestRecord, 0)
+	assert.Nil(t, json.Unmarshal([]byte(fixtureJson), &records))
+	return records
+}
+
+func compareFixtureGoAvro(t *testing.T, actual interface{}, expected *SkipTestRecord) {
+	record := actual.(map[string]interface{})
+	assert.Equal(t, expected.Name, record["Name"])
+	assert.Equal(t, expected.Payload, record["Payload"])
+	assert.Equal(t, expected.Hash[:], record["Hash"])
+
+	tags := make([]interface{}, 0)
+	for _, tag := range expected.Tags {
+		tags = append(tags, tag)
+	}
+	assert.Equal(t, tags, record["Tags"])
+
+	attributes := make(map[string]interface{})
+	for k, v := range expected.Attributes.M {
+		attributes[k] = v
+	}
+	assert.Equal(t, attributes, record["Attributes"])
+
+	children := record["Children"].([]interface{})
+	if assert.Equal(t, len(expected.Children), len(children)) {
+		for i, c := range children {
+			child := c.(map[string]interface{})
+			assert.Equal(t, expected.Children[i].Label, child["Label"])
+			assert.Equal(t, expected.Children[i].Weight, child["Weight"])
+			assert.Equal(t, expected.Children[i].Enabled, child["Enabled"])
+			assert.Equal(t, expected.Children[i].Score, child["Score"])
+		}
+	}
+
+	assert.Equal(t, expected.Id, record["Id"])
+	if expected.Note.UnionType == UnionNullStringTypeEnumNull {
+		assert.Nil(t, record["Note"])
+	} else {
+		assert.Equal(t, map[string]interface{}{"string": expected.Note.String}, record["Note"])
+	}
+	assert.Equal(t, expected.Count, record["Count"])
+}
+
+func TestSkipFixture(t *testing.T) {
+	schemaJson, err := ioutil.ReadFile("writer.avsc")
+	assert.Nil(t, err)
+	codec, err := goavro.NewCodec(string(schemaJson))
+	assert.Nil(t, err)
+
+	var buf bytes.Buffer
+	for _, f := range fixtures(t) {
+		buf.Reset()
+		assert.Nil(t, f.Serialize(&buf))
+
+		datum, remaining, err := codec.NativeFromBinary(buf.Bytes())
+		assert.Nil(t, err)
+		assert.Equal(t, 0, len(remaining))
+		compareFixtureGoAvro(t, datum, f)
+
+		// Reading every field gives the same values as goavro
+		full := NewSkipTestRecord()
+		assert.Nil(t, vm.EvalBytes(buf.Bytes(), fullProgram(t), full))
+		compareFixtureGoAvro(t, datum, full)
+	}
+}
+
+func projectionProgram(t testing.TB) *vm.Program {
+	program, err := compiler.CompileSchemaBytes([]byte(NewSkipTestRecord().Schema()), []byte(projection.NewSkipTestRecord().Schema()))
+	assert.Nil(t, err)
+	return program
+}
+
+func TestSkipFields(t *testing.T) {
+	program := projectionProgram(t)
+	for _, inst := range program.Instructions {
+		if inst.Op == vm.Read && (inst.Operand == vm.String || inst.Operand == vm.Bytes || inst.Operand > vm.UnusedLong) {
+			t.Fatalf("Expected strings, bytes and fixed fields to be skipped, got %v", program)
+		}
+	}
+
+	var buf bytes.Buffer
+	for _, f := range fixtures(t) {
+		buf.Reset()
+		assert.Nil(t, f.Serialize(&buf))
+
+		target := projection.NewSkipTestRecord()
+		err := vm.Eval(bytes.NewReader(buf.Bytes()), program, target)
+		assert.Nil(t, err)
+		assert.Equal(t, f.Id, target.Id)
+		assert.Equal(t, f.Count, target.Count)
+
+		target = projection.NewSkipTestRecord()
+		err = vm.EvalBytes(buf.Bytes(), program, target)
+		assert.Nil(t, err)
+		assert.Equal(t, f.Id, target.Id)
+		assert.Equal(t, f.Count, target.Count)
+	}
+}
+
+func TestSkipBlocksWithByteSize(t *testing.T) {
+	data := []byte{
+		// Name
+		4, 'a', 'b',
+		// Payload
+		0,
+		// Hash
+		0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15,
+		// Tags: a block of -2 items which is 5 bytes long, then the end of the array
+		3, 10, 2, 'x', 4, 'y', 'z', 0,
+		// Attributes: a block of -1 items which is 4 bytes long
+		1, 8, 2, 'k', 2, 'v', 0,
+		// Children: a block of 1 item with a byte size, which includes a 3 byte label, a double, a boolean and a float
+		1, 32, 4, 'a', 'b', 0, 0, 0, 0, 0, 0, 0xf0, 0x3f, 1, 0, 0, 0xc0, 0x3f, 0,
+		// Id
+		0x54,
+		// Note
+		0,
+		// Count
+		0x54,
+	}
+
+	target := projection.NewSkipTestRecord()
+	err := vm.EvalBytes(data, projectionProgram(t), target)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(42), target.Id)
+	assert.Equal(t, int32(42), target.Count)
+
+	// The same data can be read in full, using the byte sizes only to validate the blocks
+	full := NewSkipTestRecord()
+	err = vm.EvalBytes(data, fullProgram(t), full)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"x", "yz"}, full.Tags)
+	assert.Equal(t, "v", full.Attributes.M["k"])
+	assert.Equal(t, "ab", full.Children[0].Label)
+	assert.Equal(t, int64(42), full.Id)
+}
+
+func fullProgram(t testing.TB) *vm.Program {
+	schema := []byte(NewSkipTestRecord().Schema())
+	program, err := compiler.CompileSchemaBytes(schema, schema)
+	assert.Nil(t, err)
+	return program
+}
+
+// Compare decoding every field with skipping all but two of them
+func BenchmarkDecodeAllFields(b *testing.B) {
+	benchmarkDecode(b, fullProgram(b), NewSkipTestRecord())
+}
+
+func BenchmarkDecodeProjection(b *testing.B) {
+	benchmarkDecode(b, projectionProgram(b), projection.NewSkipTestRecord())
+}
+
+func benchmarkDecode(b *testing.B, program *vm.Program, target types.Field) {
+	var buf bytes.Buffer
+	assert.Nil(b, fixtures(b)[0].Serialize(&buf))
+	r := bytes.NewReader(buf.Bytes())
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r.Reset(buf.Bytes())
+		if err := vm.Eval(r, program, target); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
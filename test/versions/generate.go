@@ -0,0 +1,3 @@
+package avro
+
+//go:generate $GOPATH/bin/gogen-avro -versions . order_v1.avsc order_v2.avsc order_v3.avsc
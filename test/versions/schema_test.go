@@ -0,0 +1,182 @@
+package avro
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/linkedin/goavro"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/actgardner/gogen-avro/test/versions/v1"
+	"github.com/actgardner/gogen-avro/test/versions/v2"
+	"github.com/actgardner/gogen-avro/test/versions/v3"
+)
+
+// Version 1 orders, round-tripped through our serializer and goavro to verify
+const fixtureJson = `
+[
+{
+	"Id": 42,
+	"Status": 1,
+	"Customer": {"Name": "Ada"},
+	"Payment": {"UnionType": 1, "Long": 1200},
+	"Legacy": "dropped",
+	"Tags": {"m": {"gift": "yes"}},
+	"Items": [{"Sku": "A-1", "Price": 2.5}, {"Sku": "B-2", "Price": 4}],
+	"Hash": [1, 2, 3, 4]
+},
+{
+	"Id": -2147483648,
+	"Status": 0,
+	"Customer": {"Name": ""},
+	"Payment": {"UnionType": 0},
+	"Legacy": "",
+	"Tags": {"m": {}},
+	"Items": [],
+	"Hash": [0, 0, 0, 0]
+}
+]
+`
+
+func fixtures(t *testing.T) []*v1.Order {
+	records := make([]*v1.Order, 0)
+	assert.Nil(t, json.Unmarshal([]byte(fixtureJson), &records))
+	return records
+}
+
+func goavroDecode(t *testing.T, file string, record interface{ Serialize(io.Writer) error }) map[string]interface{} {
+	var buf bytes.Buffer
+	assert.Nil(t, record.Serialize(&buf))
+
+	schemaJson, err := ioutil.ReadFile(file)
+	assert.Nil(t, err)
+	codec, err := goavro.NewCodec(string(schemaJson))
+	assert.Nil(t, err)
+	datum, remaining, err := codec.NativeFromBinary(buf.Bytes())
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(remaining))
+	return datum.(map[string]interface{})
+}
+
+func goavroTags(expected *v1.Order) map[string]interface{} {
+	tags := make(map[string]interface{})
+	for k, v := range expected.Tags.M {
+		tags[k] = v
+	}
+	return tags
+}
+
+func compareFixtureGoAvro(t *testing.T, record map[string]interface{}, expected *v1.Order) {
+	assert.Equal(t, expected.Id, record["id"])
+	assert.Equal(t, expected.Status.String(), record["status"])
+	assert.Equal(t, map[string]interface{}{"name": expected.Customer.Name}, record["customer"])
+	if expected.Payment.UnionType == v1.UnionNullLongTypeEnumNull {
+		assert.Nil(t, record["payment"])
+	} else {
+		assert.Equal(t, map[string]interface{}{"long": expected.Payment.Long}, record["payment"])
+	}
+	assert.Equal(t, expected.Legacy, record["legacy"])
+	assert.Equal(t, goavroTags(expected), record["tags"])
+	items := make([]interface{}, 0)
+	for _, item := range expected.Items {
+		items = append(items, map[string]interface{}{"sku": item.Sku, "price": item.Price})
+	}
+	assert.Equal(t, items, record["items"])
+	assert.Equal(t, expected.Hash[:], record["hash"])
+}
+
+// Compare a version 2 order, decoded by goavro, to the version 1 order it was converted from
+func compareConvertedGoAvro(t *testing.T, record map[string]interface{}, expected *v1.Order) {
+	assert.Equal(t, int32(3), record["priority"])
+	assert.Equal(t, int64(expected.Id), record["id"])
+	assert.Equal(t, expected.Status.String(), record["status"])
+	assert.Equal(t, map[string]interface{}{"name": expected.Customer.Name, "email": "unknown"}, record["customer"])
+	if expected.Payment.UnionType == v1.UnionNullLongTypeEnumNull {
+		assert.Nil(t, record["payment"])
+	} else {
+		assert.Equal(t, map[string]interface{}{"long": expected.Payment.Long}, record["payment"])
+	}
+	assert.Nil(t, record["notes"])
+	assert.Equal(t, goavroTags(expected), record["labels"])
+	items := make([]interface{}, 0)
+	for _, item := range expected.Items {
+		items = append(items, map[string]interface{}{"sku": item.Sku, "price": float64(item.Price), "quantity": int32(1)})
+	}
+	assert.Equal(t, items, record["items"])
+	assert.Equal(t, expected.Hash[:], record["hash"])
+}
+
+func TestVersionsFixture(t *testing.T) {
+	for _, f := range fixtures(t) {
+		compareFixtureGoAvro(t, goavroDecode(t, "order_v1.avsc", f), f)
+
+		converted, err := v2.ConvertV1ToV2(f)
+		assert.Nil(t, err)
+		compareConvertedGoAvro(t, goavroDecode(t, "order_v2.avsc", converted), f)
+	}
+}
+
+func TestConvertV1ToV2(t *testing.T) {
+	order, err := v2.ConvertV1ToV2(fixtures(t)[0])
+	assert.Nil(t, err)
+
+	// New fields get their defaults
+	assert.Equal(t, int32(3), order.Priority)
+	assert.Equal(t, v2.UnionNullStringTypeEnumNull, order.Notes.UnionType)
+	assert.Equal(t, "unknown", order.Customer.Email)
+	assert.Equal(t, int32(1), order.Items[0].Quantity)
+
+	// Existing fields are promoted, mapped by symbol or renamed with their alias
+	assert.Equal(t, int64(42), order.Id)
+	assert.Equal(t, v2.StatusPAID, order.Status)
+	assert.Equal(t, "Ada", order.Customer.Name)
+	assert.Equal(t, v2.UnionNullStringLongTypeEnumLong, order.Payment.UnionType)
+	assert.Equal(t, int64(1200), order.Payment.Long)
+	assert.Equal(t, map[string]string{"gift": "yes"}, order.Labels.M)
+	assert.Equal(t, 2, len(order.Items))
+	assert.Equal(t, "B-2", order.Items[1].Sku)
+	assert.Equal(t, float64(4), order.Items[1].Price)
+	assert.Equal(t, v2.Hash{1, 2, 3, 4}, order.Hash)
+}
+
+func TestConvertNullUnion(t *testing.T) {
+	// The second fixture has no payment
+	converted, err := v2.ConvertV1ToV2(fixtures(t)[1])
+	assert.Nil(t, err)
+	assert.Equal(t, v2.UnionNullStringLongTypeEnumNull, converted.Payment.UnionType)
+}
+
+func TestConvertV2ToV3(t *testing.T) {
+	order, err := v2.ConvertV1ToV2(fixtures(t)[0])
+	assert.Nil(t, err)
+	order.Notes = &v2.UnionNullString{UnionType: v2.UnionNullStringTypeEnumString, String: "fragile"}
+
+	converted, err := v3.ConvertV2ToV3(order)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(42), converted.Id)
+	assert.Equal(t, v3.StatusPAID, converted.Status)
+	assert.Equal(t, v3.UnionNullLongTypeEnumLong, converted.Payment.UnionType)
+	assert.Equal(t, int64(1200), converted.Payment.Long)
+	assert.Equal(t, "fragile", converted.Notes.String)
+}
+
+func TestConvertMissingSymbol(t *testing.T) {
+	order, err := v2.ConvertV1ToV2(fixtures(t)[0])
+	assert.Nil(t, err)
+	order.Status = v2.StatusNEW
+
+	_, err = v3.ConvertV2ToV3(order)
+	assert.NotNil(t, err)
+}
+
+func TestConvertMissingUnionType(t *testing.T) {
+	order, err := v2.ConvertV1ToV2(fixtures(t)[0])
+	assert.Nil(t, err)
+	order.Payment = &v2.UnionNullStringLong{UnionType: v2.UnionNullStringLongTypeEnumString, String: "cash"}
+
+	_, err = v3.ConvertV2ToV3(order)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,228 @@
+package vm
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+/*
+  The assembly format is a textual form of a program, which Disassemble writes and Assemble reads back.
+
+  .name "Order"
+  .error 1 "Unsupported type for union"
+  .method record-rw-Order
+  0:	enter(0) "id"	; Order.id
+  1:	|  read_set(long)	; Order.id
+  2:	exit()	; Order.id
+
+  Each instruction is on its own line, optionally prefixed by its offset and indented
+  by `|` while it's inside a field. The operand of read, set, skip and read_set is a type name,
+  and the operand of other instructions is a number or empty for an unused operand.
+  An enter can be followed by the quoted name of the field.
+
+  The directives set the name of the program and its error messages, which are numbered from 1.
+  If the program has a source map, the `.method` directive sets the method of the instructions
+  which follow it, and the path of an instruction follows it as a `;` comment.
+  Otherwise lines starting with `;` are comments.
+*/
+
+// Disassemble returns the program in the assembly format
+func (p *Program) Disassemble() string {
+	var sb strings.Builder
+	if p.Name != "" {
+		fmt.Fprintf(&sb, ".name %v\n", strconv.Quote(p.Name))
+	}
+	for i, err := range p.Errors {
+		fmt.Fprintf(&sb, ".error %v %v\n", i+1, strconv.Quote(err))
+	}
+
+	depth := ""
+	method := ""
+	for i, inst := range p.Instructions {
+		var source *Source
+		if i < len(p.Sources) {
+			source = &p.Sources[i]
+			if i == 0 || source.Method != method {
+				method = source.Method
+				fmt.Fprintf(&sb, ".method %v\n", method)
+			}
+		}
+
+		if inst.Op == Exit && len(depth) >= 3 {
+			depth = depth[0 : len(depth)-3]
+		}
+		fmt.Fprintf(&sb, "%v:\t%v%v", i, depth, inst)
+		if name, ok := p.FieldNames[i]; ok {
+			fmt.Fprintf(&sb, " %v", strconv.Quote(name))
+		}
+		if source != nil && source.Path != "" {
+			fmt.Fprintf(&sb, "\t; %v", source.Path)
+		}
+		sb.WriteString("\n")
+
+		if inst.Op == Enter || inst.Op == AppendArray || inst.Op == AppendMap {
+			depth += "|  "
+		}
+	}
+	return sb.String()
+}
+
+// Assemble parses a program in the assembly format written by Disassemble
+func Assemble(text string) (*Program, error) {
+	a := &assembler{
+		program: &Program{
+			Instructions: make([]Instruction, 0),
+			Errors:       make([]string, 0),
+			FieldNames:   make(map[int]string),
+		},
+	}
+	for i, line := range strings.Split(text, "\n") {
+		if err := a.parseLine(strings.TrimSpace(line)); err != nil {
+			return nil, fmt.Errorf("Unable to assemble program, line %v: %v", i+1, err)
+		}
+	}
+	return a.program, nil
+}
+
+type assembler struct {
+	program *Program
+	// Whether a .method directive was seen, so the program has a source map
+	sources bool
+	method  string
+}
+
+func (a *assembler) parseLine(line string) error {
+	switch {
+	case line == "":
+		return nil
+	case strings.HasPrefix(line, ";"):
+		return nil
+	case strings.HasPrefix(line, "."):
+		return a.parseDirective(line)
+	}
+	return a.parseInstruction(line)
+}
+
+func (a *assembler) parseDirective(line string) error {
+	directive, args := splitWord(line)
+	switch directive {
+	case ".name":
+		name, err := strconv.Unquote(args)
+		if err != nil {
+			return fmt.Errorf("invalid name %v", args)
+		}
+		a.program.Name = name
+	case ".error":
+		number, msg := splitWord(args)
+		if number != strconv.Itoa(len(a.program.Errors)+1) {
+			return fmt.Errorf("expected error %v, got %v", len(a.program.Errors)+1, number)
+		}
+		msg, err := strconv.Unquote(msg)
+		if err != nil {
+			return fmt.Errorf("invalid error message %v", args)
+		}
+		a.program.Errors = append(a.program.Errors, msg)
+	case ".method":
+		if !a.sources && len(a.program.Instructions) > 0 {
+			return fmt.Errorf("the source map must start before the first instruction")
+		}
+		a.sources = true
+		a.method = args
+	default:
+		return fmt.Errorf("unknown directive %v", directive)
+	}
+	return nil
+}
+
+func (a *assembler) parseInstruction(line string) error {
+	offset := len(a.program.Instructions)
+
+	// The offset is optional, but must be right if it's there
+	if word, rest := splitWord(line); strings.HasSuffix(word, ":") {
+		if word != strconv.Itoa(offset)+":" {
+			return fmt.Errorf("expected offset %v, got %v", offset, word)
+		}
+		line = rest
+	}
+	line = strings.TrimLeft(line, "| \t")
+
+	open := strings.Index(line, "(")
+	close := strings.Index(line, ")")
+	if open < 0 || close < open {
+		return fmt.Errorf("invalid instruction %v", line)
+	}
+	op, ok := opsByName[line[:open]]
+	if !ok {
+		return fmt.Errorf("unknown op %v", line[:open])
+	}
+	operand, err := parseOperand(op, line[open+1:close])
+	if err != nil {
+		return err
+	}
+	a.program.Instructions = append(a.program.Instructions, Instruction{op, operand})
+
+	rest := strings.TrimSpace(line[close+1:])
+	if strings.HasPrefix(rest, "\"") {
+		quoted, err := strconv.QuotedPrefix(rest)
+		if err != nil {
+			return fmt.Errorf("invalid field name %v", rest)
+		}
+		a.program.FieldNames[offset], _ = strconv.Unquote(quoted)
+		rest = strings.TrimSpace(rest[len(quoted):])
+	}
+
+	path := ""
+	if strings.HasPrefix(rest, ";") {
+		path = strings.TrimSpace(rest[1:])
+	} else if rest != "" {
+		return fmt.Errorf("unexpected %v after instruction", rest)
+	}
+	if a.sources {
+		a.program.Sources = append(a.program.Sources, Source{Method: a.method, Path: path})
+	}
+	return nil
+}
+
+func parseOperand(op Op, operand string) (int, error) {
+	if op == Read || op == Set || op == Skip || op == ReadSet {
+		if t, ok := typesByName[operand]; ok {
+			return t, nil
+		}
+		var size int
+		if _, err := fmt.Sscanf(operand, "fixed[%d]", &size); err != nil || operand != typeName(size+11) {
+			return 0, fmt.Errorf("unknown type %v", operand)
+		}
+		return size + 11, nil
+	}
+
+	if operand == "" {
+		return NoopField, nil
+	}
+	value, err := strconv.Atoi(operand)
+	if err != nil {
+		return 0, fmt.Errorf("invalid operand %v", operand)
+	}
+	return value, nil
+}
+
+// Split a line into its first word and the rest
+func splitWord(line string) (string, string) {
+	i := strings.IndexAny(line, " \t")
+	if i < 0 {
+		return line, ""
+	}
+	return line[:i], strings.TrimSpace(line[i:])
+}
+
+var opsByName = make(map[string]Op)
+var typesByName = make(map[string]int)
+
+func init() {
+	for op := Read; op <= JumpTable; op++ {
+		opsByName[op.String()] = op
+	}
+	for t := Unused; t <= UnusedLong; t++ {
+		typesByName[typeName(t)] = t
+	}
+}
@@ -0,0 +1,74 @@
+package vm
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAssemblyRoundTrip(t *testing.T) {
+	withSources := *binaryTestProgram
+	withSources.Sources = []Source{
+		{"main", "TestRecord"},
+		{"main", "TestRecord"},
+		{"main", "TestRecord"},
+		{"record-rw-TestRecord", "TestRecord.fixedField"},
+		{"record-rw-TestRecord", "TestRecord.fixedField"},
+		{"record-rw-TestRecord", "TestRecord.fixedField"},
+		{"record-rw-TestRecord", ""},
+		{"record-rw-TestRecord", ""},
+	}
+
+	for _, program := range []*Program{binaryTestProgram, &withSources} {
+		text := program.Disassemble()
+		p, err := Assemble(text)
+		if err != nil {
+			t.Fatalf("Unable to assemble %v: %v", text, err)
+		}
+		if !reflect.DeepEqual(p, program) {
+			t.Fatalf("Expected %v, got %v", program, p)
+		}
+	}
+}
+
+func TestAssemble(t *testing.T) {
+	p, err := Assemble(`
+; Offsets and indentation are optional
+.error 1 "Unsupported type"
+enter(2) "a field"
+|  read_set(fixed[4])
+exit()
+3:	halt(1)
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := &Program{
+		Instructions: []Instruction{{Enter, 2}, {ReadSet, 15}, {Exit, NoopField}, {Halt, 1}},
+		Errors:       []string{"Unsupported type"},
+		FieldNames:   map[int]string{0: "a field"},
+	}
+	if !reflect.DeepEqual(p, expected) {
+		t.Fatalf("Expected %v, got %v", expected, p)
+	}
+}
+
+func TestAssembleErrors(t *testing.T) {
+	for text, expected := range map[string]string{
+		"jump(1":                "line 1: invalid instruction",
+		"\nfoo(1)":              "line 2: unknown op foo",
+		"read(fixed[-2])":       "line 1: unknown type fixed[-2]",
+		"jump(x)":               "line 1: invalid operand x",
+		"1:\tjump(0)":           "line 1: expected offset 0, got 1:",
+		".error 2 \"msg\"":      "line 1: expected error 1, got 2",
+		"jump(0) x":             "line 1: unexpected x after instruction",
+		"jump(0)\n.method main": "line 2: the source map must start before the first instruction",
+		".version 1":            "line 1: unknown directive .version",
+	} {
+		_, err := Assemble(text)
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("Assembling %q: expected error %q, got %v", text, expected, err)
+		}
+	}
+}
@@ -0,0 +1,292 @@
+package vm
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"sort"
+)
+
+// The binary encoding of a Program is:
+//   - the magic bytes "GVMP"
+//   - a format version byte
+//   - the number of instructions, followed by the opcode and operand of each instruction
+//   - the number of error messages, followed by the length and bytes of each message
+//   - the length and bytes of the program name (since version 2)
+//   - the number of field names, followed by the offset, length and bytes of each name (since version 2)
+//   - a big-endian CRC32 (IEEE) checksum of everything before it
+// Counts, opcodes and lengths are unsigned varints, operands are zig-zag varints.
+// Version 3 adds the Skip op and version 4 the ReadSet, ReadBlock, SkipBlock, EndBlock and
+// JumpTable ops, so readers of older versions reject programs which use them.
+
+// The current version of the binary Program encoding
+const ProgramFormatVersion = 4
+
+var programMagic = []byte{'G', 'V', 'M', 'P'}
+
+var (
+	// The encoded Program doesn't start with the expected magic bytes
+	ErrProgramMagic = errors.New("Invalid program: bad magic")
+
+	// The encoded Program was written with an unsupported format version
+	ErrProgramVersion = errors.New("Invalid program: unsupported format version")
+
+	// The encoded Program doesn't match its checksum
+	ErrProgramChecksum = errors.New("Invalid program: checksum mismatch")
+
+	// The encoded Program ended before all the instructions and errors were read
+	ErrProgramTruncated = errors.New("Invalid program: unexpected end of data")
+)
+
+// MarshalBinary encodes the Program in a compact, versioned binary format which can be
+// embedded in generated code or stored alongside data, to avoid compiling the schemas at runtime.
+func (p *Program) MarshalBinary() ([]byte, error) {
+	buf := make([]byte, 0, len(programMagic)+1+3*len(p.Instructions)+4)
+	buf = append(buf, programMagic...)
+	buf = append(buf, ProgramFormatVersion)
+
+	buf = appendUvarint(buf, uint64(len(p.Instructions)))
+	for _, inst := range p.Instructions {
+		buf = appendUvarint(buf, uint64(inst.Op))
+		buf = appendVarint(buf, int64(inst.Operand))
+	}
+
+	buf = appendUvarint(buf, uint64(len(p.Errors)))
+	for _, e := range p.Errors {
+		buf = appendString(buf, e)
+	}
+
+	buf = appendString(buf, p.Name)
+	offsets := make([]int, 0, len(p.FieldNames))
+	for offset := range p.FieldNames {
+		offsets = append(offsets, offset)
+	}
+	sort.Ints(offsets)
+	buf = appendUvarint(buf, uint64(len(offsets)))
+	for _, offset := range offsets {
+		buf = appendUvarint(buf, uint64(offset))
+		buf = appendString(buf, p.FieldNames[offset])
+	}
+
+	var sum [4]byte
+	binary.BigEndian.PutUint32(sum[:], crc32.ChecksumIEEE(buf))
+	return append(buf, sum[:]...), nil
+}
+
+// UnmarshalBinary replaces the contents of the Program with the Program encoded by MarshalBinary.
+// The checksum is verified before anything is decoded. Programs encoded with version 1
+// of the format are still accepted, they have no name or field names.
+func (p *Program) UnmarshalBinary(data []byte) error {
+	if len(data) < len(programMagic)+1+4 {
+		return ErrProgramTruncated
+	}
+
+	for i, b := range programMagic {
+		if data[i] != b {
+			return ErrProgramMagic
+		}
+	}
+
+	body, sum := data[:len(data)-4], data[len(data)-4:]
+	if crc32.ChecksumIEEE(body) != binary.BigEndian.Uint32(sum) {
+		return ErrProgramChecksum
+	}
+
+	version := body[len(programMagic)]
+	if version < 1 || version > ProgramFormatVersion {
+		return ErrProgramVersion
+	}
+
+	d := &programDecoder{buf: body[len(programMagic)+1:]}
+	instructions := make([]Instruction, d.count())
+	for i := range instructions {
+		instructions[i].Op = Op(d.uvarint())
+		instructions[i].Operand = int(d.varint())
+	}
+
+	errs := make([]string, d.count())
+	for i := range errs {
+		errs[i] = d.string()
+	}
+
+	var name string
+	var fieldNames map[int]string
+	if version >= 2 {
+		name = d.string()
+		fieldNames = make(map[int]string)
+		for i := d.count(); i > 0; i-- {
+			offset := int(d.uvarint())
+			fieldNames[offset] = d.string()
+		}
+	}
+
+	if d.err != nil {
+		return d.err
+	}
+	if len(d.buf) != 0 {
+		return fmt.Errorf("Invalid program: %v trailing bytes", len(d.buf))
+	}
+	if err := validateInstructions(instructions, len(errs), version); err != nil {
+		return err
+	}
+
+	p.Instructions = instructions
+	p.Errors = errs
+	p.Name = name
+	p.FieldNames = fieldNames
+	return nil
+}
+
+// The first format version which has the op
+func opVersion(op Op) byte {
+	switch op {
+	case Skip:
+		return 3
+	case ReadSet, ReadBlock, SkipBlock, EndBlock, JumpTable:
+		return 4
+	}
+	return 1
+}
+
+// Check that every instruction has a known op from the program's format version, and that operands
+// which are addresses or error numbers are in range, so a program which was loaded can't make the VM panic
+func validateInstructions(instructions []Instruction, errorCount int, version byte) error {
+	for pc, inst := range instructions {
+		if opVersion(inst.Op) > version {
+			return fmt.Errorf("Invalid program: instruction %v %v: op not in format version %v", pc, inst, version)
+		}
+		// The highest address an instruction may move the PC to, which is the end of the program for jumps
+		max := len(instructions)
+		switch inst.Op {
+		case Read, Skip, Set, ReadSet:
+			if !validTypeOperand(inst.Op, inst.Operand) {
+				return fmt.Errorf("Invalid program: instruction %v: type %v out of range", pc, inst.Operand)
+			}
+			continue
+		case Enter, Exit, AppendArray, AppendMap, SetDefault, Return, EvalEqual, EvalGreater,
+			SetLong, AddLong, MultLong, PushLoop, PopLoop:
+			continue
+		case Jump, CondJump, ReadBlock, SkipBlock:
+		case Call, EndBlock:
+			max = len(instructions) - 1
+		case JumpTable:
+			if inst.Operand < 0 || pc+inst.Operand >= len(instructions) {
+				return fmt.Errorf("Invalid program: instruction %v %v: jump table past the end of the program", pc, inst)
+			}
+			continue
+		case Halt:
+			if inst.Operand < 0 || inst.Operand > errorCount {
+				return fmt.Errorf("Invalid program: instruction %v %v: no error %v", pc, inst, inst.Operand)
+			}
+			continue
+		default:
+			return fmt.Errorf("Invalid program: instruction %v: unknown op %v", pc, int(inst.Op))
+		}
+		if inst.Operand < 0 || inst.Operand > max {
+			return fmt.Errorf("Invalid program: instruction %v %v: address out of range", pc, inst)
+		}
+	}
+	return nil
+}
+
+// Whether the operand is a data type the op supports: values of every type can be read or skipped,
+// while fixed values are set as Bytes and there's nothing to set for an unused long
+func validTypeOperand(op Op, operand int) bool {
+	if operand >= Null && operand <= String {
+		return true
+	}
+	switch op {
+	case Read, Skip:
+		return operand == UnusedLong || operand > UnusedLong
+	case ReadSet:
+		return operand > UnusedLong
+	}
+	return false
+}
+
+// MustLoadProgram decodes a Program encoded by MarshalBinary, and panics if it's invalid.
+// It's intended for initializing the precompiled programs embedded in generated code.
+func MustLoadProgram(data []byte) *Program {
+	p := &Program{}
+	if err := p.UnmarshalBinary(data); err != nil {
+		panic(err)
+	}
+	return p
+}
+
+func appendUvarint(buf []byte, v uint64) []byte {
+	var tmp [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(tmp[:], v)
+	return append(buf, tmp[:n]...)
+}
+
+func appendString(buf []byte, s string) []byte {
+	buf = appendUvarint(buf, uint64(len(s)))
+	return append(buf, s...)
+}
+
+func appendVarint(buf []byte, v int64) []byte {
+	var tmp [binary.MaxVarintLen64]byte
+	n := binary.PutVarint(tmp[:], v)
+	return append(buf, tmp[:n]...)
+}
+
+// programDecoder reads values from an encoded Program, remembering the first error.
+type programDecoder struct {
+	buf []byte
+	err error
+}
+
+func (d *programDecoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(d.buf)
+	if n <= 0 {
+		d.err = ErrProgramTruncated
+		return 0
+	}
+	d.buf = d.buf[n:]
+	return v
+}
+
+func (d *programDecoder) varint() int64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(d.buf)
+	if n <= 0 {
+		d.err = ErrProgramTruncated
+		return 0
+	}
+	d.buf = d.buf[n:]
+	return v
+}
+
+// Read a count, which can never be larger than the number of remaining bytes
+func (d *programDecoder) count() int {
+	v := d.uvarint()
+	if v > uint64(len(d.buf)) {
+		d.err = ErrProgramTruncated
+		return 0
+	}
+	return int(v)
+}
+
+func (d *programDecoder) bytes(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n > len(d.buf) {
+		d.err = ErrProgramTruncated
+		return nil
+	}
+	b := d.buf[:n]
+	d.buf = d.buf[n:]
+	return b
+}
+
+func (d *programDecoder) string() string {
+	return string(d.bytes(d.count()))
+}
@@ -0,0 +1,180 @@
+package vm
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"reflect"
+	"testing"
+)
+
+var binaryTestProgram = &Program{
+	Instructions: []Instruction{
+		{Read, Long},
+		{EvalEqual, 0},
+		{CondJump, 6},
+		{Enter, NoopField},
+		{Read, 11 + 16},
+		{Exit, NoopField},
+		{AddLong, -1},
+		{Halt, 1},
+	},
+	Errors:     []string{"Unsupported type for union"},
+	Name:       "TestRecord",
+	FieldNames: map[int]string{3: "fixedField"},
+}
+
+func TestProgramBinaryRoundTrip(t *testing.T) {
+	data, err := binaryTestProgram.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := &Program{}
+	if err := p.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(p, binaryTestProgram) {
+		t.Fatalf("Expected %v, got %v", binaryTestProgram, p)
+	}
+}
+
+func TestProgramBinaryCorruption(t *testing.T) {
+	data, err := binaryTestProgram.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := len(programMagic); i < len(data); i++ {
+		corrupted := append([]byte{}, data...)
+		corrupted[i] ^= 0x40
+		if err := (&Program{}).UnmarshalBinary(corrupted); err != ErrProgramChecksum {
+			t.Errorf("Expected checksum error flipping byte %v, got %v", i, err)
+		}
+	}
+
+	if err := (&Program{}).UnmarshalBinary(data[:len(data)-1]); err != ErrProgramChecksum {
+		t.Errorf("Expected checksum error for truncated program, got %v", err)
+	}
+
+	corrupted := append([]byte{}, data...)
+	corrupted[0] = 'X'
+	if err := (&Program{}).UnmarshalBinary(corrupted); err != ErrProgramMagic {
+		t.Errorf("Expected magic error, got %v", err)
+	}
+}
+
+// Re-encode a program with a different format version byte, updating the checksum
+func withFormatVersion(data []byte, version byte) []byte {
+	body := append([]byte{}, data[:len(data)-4]...)
+	body[len(programMagic)] = version
+	var sum [4]byte
+	binary.BigEndian.PutUint32(sum[:], crc32.ChecksumIEEE(body))
+	return append(body, sum[:]...)
+}
+
+func TestProgramBinaryNewerVersion(t *testing.T) {
+	data, err := binaryTestProgram.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data[len(programMagic)] != ProgramFormatVersion {
+		t.Fatalf("Expected format version %v, got %v", ProgramFormatVersion, data[len(programMagic)])
+	}
+	if err := (&Program{}).UnmarshalBinary(withFormatVersion(data, ProgramFormatVersion+1)); err != ErrProgramVersion {
+		t.Errorf("Expected version error, got %v", err)
+	}
+}
+
+func TestProgramBinaryOpVersions(t *testing.T) {
+	// Version 2 readers don't know the Skip op, so programs using it can't claim to be version 2
+	data, err := (&Program{Instructions: []Instruction{{Skip, Long}}}).MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := (&Program{}).UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := (&Program{}).UnmarshalBinary(withFormatVersion(data, 2)); err == nil {
+		t.Errorf("Expected an error loading a Skip op from a version 2 program")
+	}
+
+	// The fused ops were added in version 4
+	fused := []Instruction{{ReadSet, Long}, {ReadBlock, 2}, {SkipBlock, 2}, {EndBlock, 0}, {JumpTable, 0}}
+	for _, inst := range fused {
+		data, err := (&Program{Instructions: []Instruction{inst, {Halt, 0}}}).MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := (&Program{}).UnmarshalBinary(data); err != nil {
+			t.Fatalf("Unexpected error loading %v: %v", inst, err)
+		}
+		if err := (&Program{}).UnmarshalBinary(withFormatVersion(data, 3)); err == nil {
+			t.Errorf("Expected an error loading %v from a version 3 program", inst)
+		}
+	}
+}
+
+func TestProgramBinaryVersion1(t *testing.T) {
+	data := append([]byte{}, programMagic...)
+	data = append(data, 1)
+	data = appendUvarint(data, 1)
+	data = appendUvarint(data, uint64(Halt))
+	data = appendVarint(data, 0)
+	data = appendUvarint(data, 0)
+	var sum [4]byte
+	binary.BigEndian.PutUint32(sum[:], crc32.ChecksumIEEE(data))
+	data = append(data, sum[:]...)
+
+	p := &Program{}
+	if err := p.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	expected := &Program{Instructions: []Instruction{{Halt, 0}}, Errors: []string{}}
+	if !reflect.DeepEqual(p, expected) {
+		t.Fatalf("Expected %v, got %v", expected, p)
+	}
+}
+
+func TestProgramBinaryInvalidInstructions(t *testing.T) {
+	invalid := [][]Instruction{
+		{{Jump, -5}},
+		{{Jump, 2}},
+		{{CondJump, 3}, {Halt, 0}},
+		{{Call, 1}},
+		{{ReadBlock, -1}},
+		{{EndBlock, 1}},
+		{{JumpTable, 1}},
+		{{Halt, 2}},
+		{{Op(100), 0}},
+		{{Read, Unused}},
+		{{Read, UnionElem}},
+		{{Skip, -1}},
+		{{Set, UnusedLong}},
+		{{Set, 11 + 4}},
+		{{ReadSet, UnusedLong}},
+	}
+	for _, instructions := range invalid {
+		data, err := (&Program{Instructions: instructions, Errors: []string{"error"}}).MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := (&Program{}).UnmarshalBinary(data); err == nil {
+			t.Errorf("Expected an error loading %v", instructions)
+		}
+	}
+
+	valid := [][]Instruction{
+		// Jumping to the end of the program stops it
+		{{Jump, 1}},
+		{{Read, UnusedLong}, {Skip, 11 + 4}, {ReadSet, 11}, {Set, Null}},
+	}
+	for _, instructions := range valid {
+		data, err := (&Program{Instructions: instructions}).MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := (&Program{}).UnmarshalBinary(data); err != nil {
+			t.Errorf("Unexpected error loading %v: %v", instructions, err)
+		}
+	}
+}
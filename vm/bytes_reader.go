@@ -0,0 +1,143 @@
+package vm
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"unsafe"
+)
+
+// bytesReader decodes Avro primitives from a byte slice, keeping a cursor into the slice.
+// When zeroCopy is set bytes and fixed values are returned as sub-slices of the input
+// instead of being copied.
+type bytesReader struct {
+	data     []byte
+	pos      int
+	zeroCopy bool
+	// The Limits on the input, zero is unlimited
+	maxBytesLength int64
+	maxBytesRead   int64
+}
+
+func newBytesReader(data []byte) bytesReader {
+	return bytesReader{data: data}
+}
+
+func (s *bytesReader) consumed() int64 {
+	return int64(s.pos)
+}
+
+// Check there are n more bytes available to read
+func (s *bytesReader) need(n int) error {
+	if err := checkLimit(BytesReadLimit, s.maxBytesRead, int64(s.pos)+int64(n)); err != nil {
+		return err
+	}
+	if n > len(s.data)-s.pos {
+		if s.pos == len(s.data) {
+			return io.EOF
+		}
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+
+func (s *bytesReader) readBool() (bool, error) {
+	if err := s.need(1); err != nil {
+		return false, err
+	}
+	b := s.data[s.pos]
+	s.pos += 1
+	return b == 1, nil
+}
+
+func (s *bytesReader) readInt() (int32, error) {
+	v, err := s.readVarint()
+	return int32(v), err
+}
+
+func (s *bytesReader) readLong() (int64, error) {
+	return s.readVarint()
+}
+
+func (s *bytesReader) readVarint() (int64, error) {
+	var v uint64
+	for shift := uint(0); ; shift += 7 {
+		if err := s.need(1); err != nil {
+			return 0, err
+		}
+		b := s.data[s.pos]
+		s.pos += 1
+		v |= uint64(b&127) << shift
+		if b&128 == 0 {
+			break
+		}
+	}
+	return int64(v>>1) ^ -int64(v&1), nil
+}
+
+func (s *bytesReader) readFloat() (float32, error) {
+	if err := s.need(4); err != nil {
+		return 0, err
+	}
+	bits := binary.LittleEndian.Uint32(s.data[s.pos:])
+	s.pos += 4
+	return math.Float32frombits(bits), nil
+}
+
+func (s *bytesReader) readDouble() (float64, error) {
+	if err := s.need(8); err != nil {
+		return 0, err
+	}
+	bits := binary.LittleEndian.Uint64(s.data[s.pos:])
+	s.pos += 8
+	return math.Float64frombits(bits), nil
+}
+
+func (s *bytesReader) readBytes(buf []byte) ([]byte, error) {
+	size, err := s.readLong()
+	if err != nil {
+		return nil, err
+	}
+	if size < 0 || size > math.MaxInt32 {
+		return nil, fmt.Errorf("bytes length out of range: %d", size)
+	}
+	if err := checkLimit(BytesLengthLimit, s.maxBytesLength, size); err != nil {
+		return nil, err
+	}
+	return s.readFixed(buf, int(size))
+}
+
+// Copy the value into buf, or into a new slice if buf is nil
+func (s *bytesReader) readFixed(buf []byte, size int) ([]byte, error) {
+	if err := s.need(size); err != nil {
+		return nil, err
+	}
+	value := s.data[s.pos : s.pos+size : s.pos+size]
+	s.pos += size
+	if s.zeroCopy {
+		return value, nil
+	}
+	if buf == nil || cap(buf) < size {
+		buf = make([]byte, size)
+	}
+	buf = buf[:size]
+	copy(buf, value)
+	return buf, nil
+}
+
+func (s *bytesReader) skip(n int64) error {
+	if n > math.MaxInt32 {
+		return fmt.Errorf("skip length out of range: %d", n)
+	}
+	if err := s.need(int(n)); err != nil {
+		return err
+	}
+	s.pos += int(n)
+	return nil
+}
+
+// Convert a byte slice to a string which shares its memory
+func unsafeString(b []byte) string {
+	return *(*string)(unsafe.Pointer(&b))
+}
@@ -0,0 +1,49 @@
+package vm
+
+import (
+	"fmt"
+	"strings"
+)
+
+// EvalError is returned when a program fails to decode its input.
+// Reaching the end of the input before the first byte of a value is read
+// is reported as a plain io.EOF instead, so callers can detect the end of a stream.
+type EvalError struct {
+	// The location of the failing value in the target, like "Order.items[3].price"
+	Path string
+	// The offset of the instruction which failed
+	PC int
+	// The number of bytes consumed from the input before the failure
+	Offset int64
+	// The type of the value being read from the input, if any
+	WireType string
+	// The type of the field the value was stored into, if it was rejected by the field
+	FieldType string
+	// The underlying error
+	Err error
+
+	// The path segments, innermost first, collected while unwinding the evaluation
+	segments []string
+}
+
+func (e *EvalError) Error() string {
+	return fmt.Sprintf("Error decoding %v at offset %v (pc %v): %v", e.Path, e.Offset, e.PC, e.Err)
+}
+
+func (e *EvalError) Unwrap() error {
+	return e.Err
+}
+
+func (e *EvalError) addSegment(segment string) {
+	e.segments = append(e.segments, segment)
+}
+
+func (e *EvalError) buildPath(root string) {
+	var b strings.Builder
+	b.WriteString(root)
+	for i := len(e.segments) - 1; i >= 0; i-- {
+		b.WriteString(e.segments[i])
+	}
+	e.Path = strings.TrimPrefix(b.String(), ".")
+	e.segments = nil
+}
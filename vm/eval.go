@@ -2,13 +2,15 @@
 package vm
 
 import (
+	"errors"
 	"fmt"
 	"io"
 
 	"github.com/actgardner/gogen-avro/vm/types"
 )
 
-type stackFrame struct {
+// Frame holds the registers of the VM while it evaluates a method or a field
+type Frame struct {
 	Boolean   bool
 	Int       int32
 	Long      int64
@@ -19,90 +21,327 @@ type stackFrame struct {
 	Condition bool
 }
 
-func Eval(r io.Reader, program *Program, target types.Field) (err error) {
-	var pc int
+// Options controls the evaluation of a program.
+// Options which keep state between calls must not be shared between goroutines.
+type Options struct {
+	// Decode bytes, fixed and string values into a scratch buffer which is kept in
+	// the Options and reused by every call, instead of a buffer owned by a single call.
+	// Without it bytes and fixed values get a new slice each, which the target may keep.
+	// With it the slices passed to SetBytes are only valid for the duration of the call.
+	ReuseBuffers bool
+
+	// Bounds on the input, for decoding data from untrusted sources
+	Limits Limits
+
+	// When decoding a byte slice with EvalBytes, decode strings without copying them, so the
+	// decoded strings share the memory of the input. The input must not be modified while they're
+	// in use. Bytes and fixed values are passed to the target's setters as sub-slices of the input
+	// instead of going through the scratch buffer, but the generated setters copy them, so they don't share it.
+	// It has no effect on Eval.
+	ZeroCopy bool
+
+	// Called on each instruction the VM executes, for debugging and profiling
+	Tracer Tracer
+
+	scratch []byte
+}
+
+func (o *Options) limits() Limits {
+	if o == nil {
+		return Limits{}
+	}
+	return o.Limits
+}
+
+// evaluator holds the state of a single evaluation of a program
+type evaluator struct {
+	r        decoder
+	program  *Program
+	pc       int
+	scratch  []byte
+	zeroCopy bool
+	// Whether bytes and fixed values are read into the scratch buffer, see Options.ReuseBuffers
+	reuseBuffers bool
+	// The index of the current array item, set by push_loop for the append_array which follows it
+	item int64
+	// The nesting depth of the current target
+	depth  int
+	limits Limits
+	tracer Tracer
+}
+
+func Eval(r io.Reader, program *Program, target types.Field) error {
+	return EvalWithOptions(r, program, target, nil)
+}
+
+// EvalWithOptions is like Eval, but allows the evaluation to be configured.
+// Passing nil is equivalent to calling Eval.
+func EvalWithOptions(r io.Reader, program *Program, target types.Field, opts *Options) error {
+	s := newStreamReader(r)
+	s.maxBytesLength = opts.limits().MaxBytesLength
+	s.maxBytesRead = opts.limits().MaxBytesRead
+	e := &evaluator{
+		r:       &s,
+		program: program,
+	}
+	return e.run(target, opts)
+}
+
+// EvalBytes is like Eval, but decodes a value from a byte slice. Reading from a slice avoids
+// the overhead of an io.Reader, so it's faster when whole messages are already in memory.
+func EvalBytes(data []byte, program *Program, target types.Field) error {
+	return EvalBytesWithOptions(data, program, target, nil)
+}
+
+// EvalBytesWithOptions is like EvalBytes, but allows the evaluation to be configured.
+// Passing nil is equivalent to calling EvalBytes.
+func EvalBytesWithOptions(data []byte, program *Program, target types.Field, opts *Options) error {
+	s := newBytesReader(data)
+	s.maxBytesLength = opts.limits().MaxBytesLength
+	s.maxBytesRead = opts.limits().MaxBytesRead
+	s.zeroCopy = opts != nil && opts.ZeroCopy
+	e := &evaluator{
+		r:        &s,
+		program:  program,
+		zeroCopy: s.zeroCopy,
+	}
+	return e.run(target, opts)
+}
+
+func (e *evaluator) run(target types.Field, opts *Options) (err error) {
+	e.limits = opts.limits()
+	if opts != nil && opts.ReuseBuffers {
+		e.reuseBuffers = true
+		e.scratch = opts.scratch
+		defer func() {
+			opts.scratch = e.scratch
+		}()
+	}
+
+	if opts != nil && opts.Tracer != nil {
+		e.tracer = opts.Tracer
+		e.tracer.Start(e.program)
+		defer func() {
+			e.tracer.End(err)
+		}()
+	}
+
 	defer func() {
 		if r := recover(); r != nil {
-			err = fmt.Errorf("Panic at pc %v - %v", pc, r)
+			err = &EvalError{PC: e.pc, Offset: e.r.consumed(), Err: fmt.Errorf("Panic: %v", r)}
+		}
+		if evalErr, ok := err.(*EvalError); ok {
+			evalErr.buildPath(e.program.Name)
 		}
 	}()
 
-	return evalInner(r, program, target, &pc)
+	return e.eval(target)
+}
+
+// Read a bytes, fixed or string value into the scratch buffer if scratch is set, otherwise into a new
+// slice, or from the input itself without copying
+func (e *evaluator) readBytes(size int, scratch bool) (b []byte, err error) {
+	var buf []byte
+	if scratch {
+		buf = e.scratch
+	}
+	if size < 0 {
+		b, err = e.r.readBytes(buf)
+	} else {
+		b, err = e.r.readFixed(buf, size)
+	}
+	if scratch && !e.zeroCopy {
+		e.scratch = b
+	}
+	return b, err
+}
+
+// Wrap an error raised by the instruction at the current pc
+func (e *evaluator) fail(err error, wireType string) error {
+	evalErr := &EvalError{
+		PC:       e.pc,
+		Offset:   e.r.consumed(),
+		WireType: wireType,
+		Err:      err,
+	}
+	if fieldErr, ok := err.(*types.FieldError); ok {
+		evalErr.FieldType = fieldErr.Field
+	}
+	return evalErr
+}
+
+// Wrap an error raised while reading from the input. Running out of input
+// before the program consumed anything is the end of the stream, not an error.
+func (e *evaluator) failRead(err error, wireType string) error {
+	if err == io.EOF {
+		if e.r.consumed() == 0 {
+			return err
+		}
+		err = io.ErrUnexpectedEOF
+	}
+	return e.fail(err, wireType)
+}
+
+// Evaluate the program from the next instruction into a nested field
+func (e *evaluator) enter(field types.Field) error {
+	e.depth += 1
+	if err := checkLimit(DepthLimit, int64(e.limits.MaxDepth), int64(e.depth)); err != nil {
+		return e.fail(err, "")
+	}
+	e.pc += 1
+	err := e.eval(field)
+	e.depth -= 1
+	return err
+}
+
+// Read a value of the given type into the frame
+func (e *evaluator) read(frame *Frame, operand int) (err error) {
+	r := e.r
+	switch operand {
+	case Null:
+		break
+	case Boolean:
+		frame.Boolean, err = r.readBool()
+	case Int:
+		frame.Int, err = r.readInt()
+	case Long:
+		frame.Long, err = r.readLong()
+	case UnusedLong:
+		_, err = r.readLong()
+	case Float:
+		frame.Float, err = r.readFloat()
+	case Double:
+		frame.Double, err = r.readDouble()
+	case Bytes:
+		frame.Bytes, err = e.readBytes(-1, e.reuseBuffers)
+	case String:
+		// Strings are copied out of the buffer, so it can always be reused
+		var b []byte
+		b, err = e.readBytes(-1, true)
+		if e.zeroCopy {
+			frame.String = unsafeString(b)
+		} else {
+			frame.String = string(b)
+		}
+	default:
+		frame.Bytes, err = e.readBytes(operand-11, e.reuseBuffers)
+	}
+	return err
+}
+
+// Set the target to the value of the given type in the frame
+func set(target types.Field, frame *Frame, operand int) error {
+	switch operand {
+	case Boolean:
+		return target.SetBoolean(frame.Boolean)
+	case Int:
+		return target.SetInt(frame.Int)
+	case Long:
+		return target.SetLong(frame.Long)
+	case Float:
+		return target.SetFloat(frame.Float)
+	case Double:
+		return target.SetDouble(frame.Double)
+	case Bytes:
+		return target.SetBytes(frame.Bytes)
+	case String:
+		return target.SetString(frame.String)
+	}
+	return nil
 }
 
-func evalInner(r io.Reader, program *Program, target types.Field, pc *int) (err error) {
-	var loop int64
+// Advance past a value of the given type without decoding it
+func (e *evaluator) skip(operand int) error {
+	switch operand {
+	case Null:
+		return nil
+	case Boolean:
+		return e.r.skip(1)
+	case Int, Long, UnusedLong:
+		_, err := e.r.readLong()
+		return err
+	case Float:
+		return e.r.skip(4)
+	case Double:
+		return e.r.skip(8)
+	case Bytes, String:
+		size, err := e.r.readLong()
+		if err != nil {
+			return err
+		}
+		if size < 0 {
+			return fmt.Errorf("bytes length out of range: %d", size)
+		}
+		return e.r.skip(size)
+	}
+	return e.r.skip(int64(operand - 11))
+}
 
-	frame := stackFrame{}
-	for ; *pc < len(program.Instructions); *pc++ {
-		inst := program.Instructions[*pc]
+// Add a segment to the path of an error returned by a nested field
+func addSegment(err error, segment string) error {
+	if evalErr, ok := err.(*EvalError); ok {
+		evalErr.addSegment(segment)
+	}
+	return err
+}
+
+func (e *evaluator) eval(target types.Field) (err error) {
+	var loop, items int64
+	program := e.program
+	r := e.r
+
+	frame := Frame{}
+	for ; e.pc < len(program.Instructions); e.pc++ {
+		inst := program.Instructions[e.pc]
+		if e.tracer != nil {
+			e.tracer.Step(e.pc, inst, frame, r.consumed())
+		}
 		switch inst.Op {
 		case Read:
-			switch inst.Operand {
-			case Null:
-				break
-			case Boolean:
-				frame.Boolean, err = readBool(r)
-				break
-			case Int:
-				frame.Int, err = readInt(r)
-				break
-			case Long:
-				frame.Long, err = readLong(r)
-				break
-			case UnusedLong:
-				_, err = readLong(r)
-				break
-			case Float:
-				frame.Float, err = readFloat(r)
-				break
-			case Double:
-				frame.Double, err = readDouble(r)
-				break
-			case Bytes:
-				frame.Bytes, err = readBytes(r)
-				break
-			case String:
-				frame.String, err = readString(r)
-				break
-			default:
-				frame.Bytes, err = readFixed(r, inst.Operand-11)
-				break
+			if err = e.read(&frame, inst.Operand); err != nil {
+				return e.failRead(err, typeName(inst.Operand))
+			}
+			break
+		case Skip:
+			if err = e.skip(inst.Operand); err != nil {
+				return e.failRead(err, typeName(inst.Operand))
 			}
 			break
 		case Set:
-			switch inst.Operand {
-			case Null:
-				break
-			case Boolean:
-				target.SetBoolean(frame.Boolean)
-				break
-			case Int:
-				target.SetInt(frame.Int)
-				break
-			case Long:
-				target.SetLong(frame.Long)
-				break
-			case Float:
-				target.SetFloat(frame.Float)
-				break
-			case Double:
-				target.SetDouble(frame.Double)
-				break
-			case Bytes:
-				target.SetBytes(frame.Bytes)
-				break
-			case String:
-				target.SetString(frame.String)
-				break
+			if err = set(target, &frame, inst.Operand); err != nil {
+				return e.fail(err, typeName(inst.Operand))
+			}
+			break
+		case ReadSet:
+			if err = e.read(&frame, inst.Operand); err != nil {
+				return e.failRead(err, typeName(inst.Operand))
+			}
+			if inst.Operand > UnusedLong {
+				err = target.SetBytes(frame.Bytes)
+			} else {
+				err = set(target, &frame, inst.Operand)
+			}
+			if err != nil {
+				return e.fail(err, typeName(inst.Operand))
 			}
 			break
 		case SetDefault:
-			target.SetDefault(inst.Operand)
+			if err = target.SetDefault(inst.Operand); err != nil {
+				return e.fail(err, "")
+			}
 			break
 		case Enter:
-			*pc += 1
-			if err = evalInner(r, program, target.Get(inst.Operand), pc); err != nil {
+			name, named := program.FieldNames[e.pc]
+			field, err := target.Get(inst.Operand)
+			if err != nil {
+				err = e.fail(err, "")
+			} else {
+				err = e.enter(field)
+			}
+			if err != nil {
+				if named {
+					return addSegment(err, "."+name)
+				}
 				return err
 			}
 			break
@@ -110,29 +349,41 @@ func evalInner(r io.Reader, program *Program, target types.Field, pc *int) (err
 			target.Finalize()
 			return nil
 		case AppendArray:
-			*pc += 1
-			if err = evalInner(r, program, target.AppendArray(), pc); err != nil {
-				return err
+			index := e.item
+			field, err := target.AppendArray()
+			if err != nil {
+				err = e.fail(err, "")
+			} else {
+				err = e.enter(field)
+			}
+			if err != nil {
+				return addSegment(err, fmt.Sprintf("[%v]", index))
 			}
 			break
 		case AppendMap:
-			*pc += 1
-			if err = evalInner(r, program, target.AppendMap(frame.String), pc); err != nil {
-				return err
+			key := frame.String
+			field, err := target.AppendMap(key)
+			if err != nil {
+				err = e.fail(err, "")
+			} else {
+				err = e.enter(field)
+			}
+			if err != nil {
+				return addSegment(err, fmt.Sprintf("[%q]", key))
 			}
 			break
 		case Call:
-			curr := *pc
-			*pc = inst.Operand
-			if err = evalInner(r, program, target, pc); err != nil {
+			curr := e.pc
+			e.pc = inst.Operand
+			if err = e.eval(target); err != nil {
 				return err
 			}
-			*pc = curr
+			e.pc = curr
 			break
 		case Return:
 			return nil
 		case Jump:
-			*pc = inst.Operand - 1
+			e.pc = inst.Operand - 1
 			break
 		case EvalGreater:
 			frame.Condition = (frame.Long > int64(inst.Operand))
@@ -142,7 +393,51 @@ func evalInner(r io.Reader, program *Program, target types.Field, pc *int) (err
 			break
 		case CondJump:
 			if frame.Condition {
-				*pc = inst.Operand - 1
+				e.pc = inst.Operand - 1
+			}
+			break
+		case JumpTable:
+			if frame.Long >= 0 && frame.Long < int64(inst.Operand) {
+				e.pc += int(frame.Long)
+			} else {
+				e.pc += inst.Operand
+			}
+			break
+		case ReadBlock:
+			if frame.Long, err = r.readLong(); err != nil {
+				return e.failRead(err, "long")
+			}
+			if frame.Long == 0 {
+				e.pc = inst.Operand - 1
+			} else if frame.Long < 0 {
+				if _, err = r.readLong(); err != nil {
+					return e.failRead(err, "long")
+				}
+				frame.Long = -frame.Long
+			}
+			break
+		case SkipBlock:
+			for {
+				if frame.Long, err = r.readLong(); err != nil {
+					return e.failRead(err, "long")
+				}
+				if frame.Long >= 0 {
+					break
+				}
+				if err = e.skip(Bytes); err != nil {
+					return e.failRead(err, "bytes")
+				}
+			}
+			if frame.Long == 0 {
+				e.pc = inst.Operand - 1
+			}
+			break
+		case EndBlock:
+			frame.Long -= 1
+			if frame.Long == 0 {
+				e.pc = inst.Operand - 1
+			} else {
+				e.pc = inst.Operand
 			}
 			break
 		case AddLong:
@@ -156,8 +451,16 @@ func evalInner(r io.Reader, program *Program, target types.Field, pc *int) (err
 			break
 		case PushLoop:
 			loop = frame.Long
-			*pc += 1
-			if err = evalInner(r, program, target, pc); err != nil {
+			if err = checkLimit(BlockItemsLimit, e.limits.MaxBlockItems, loop); err != nil {
+				return e.fail(err, "")
+			}
+			if err = checkLimit(ItemsLimit, e.limits.MaxItems, items+1); err != nil {
+				return e.fail(err, "")
+			}
+			e.item = items
+			items += 1
+			e.pc += 1
+			if err = e.eval(target); err != nil {
 				return err
 			}
 			frame.Long = loop
@@ -168,13 +471,9 @@ func evalInner(r io.Reader, program *Program, target types.Field, pc *int) (err
 			if inst.Operand == 0 {
 				return nil
 			}
-			return fmt.Errorf("Runtime error: %v, frame: %v, pc: %v", program.Errors[inst.Operand-1], frame, pc)
+			return e.fail(errors.New(program.Errors[inst.Operand-1]), "")
 		default:
-			return fmt.Errorf("Unknown instruction %v", program.Instructions[*pc])
-		}
-
-		if err != nil {
-			return err
+			return e.fail(fmt.Errorf("Unknown instruction %v", program.Instructions[e.pc]), "")
 		}
 	}
 	return nil
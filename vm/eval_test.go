@@ -0,0 +1,79 @@
+package vm
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/actgardner/gogen-avro/vm/types"
+)
+
+func TestEvalTypeMismatch(t *testing.T) {
+	program := &Program{
+		Instructions: []Instruction{
+			{Read, String},
+			{Set, String},
+			{Halt, 0},
+		},
+		Name: "int",
+	}
+
+	var target types.Int
+	err := Eval(bytes.NewReader([]byte{6, 'a', 'b', 'c'}), program, &target)
+	evalErr, ok := err.(*EvalError)
+	if !ok {
+		t.Fatalf("Expected an EvalError, got %v", err)
+	}
+	if evalErr.PC != 1 || evalErr.Offset != 4 || evalErr.WireType != "string" || evalErr.FieldType != "int" || evalErr.Path != "int" {
+		t.Fatalf("Unexpected error %#v", evalErr)
+	}
+	if _, ok := evalErr.Err.(*types.FieldError); !ok {
+		t.Fatalf("Expected a FieldError, got %v", evalErr.Err)
+	}
+}
+
+// A field which keeps the slices passed to SetBytes
+type bytesKeeper struct {
+	types.Bytes
+	values [][]byte
+}
+
+func (b *bytesKeeper) SetBytes(v []byte) error {
+	b.values = append(b.values, v)
+	return nil
+}
+
+func TestEvalBytesOwnership(t *testing.T) {
+	program := &Program{
+		Instructions: []Instruction{
+			{Read, Bytes},
+			{Set, Bytes},
+			{Read, 11 + 2},
+			{Set, Bytes},
+			{Halt, 0},
+		},
+	}
+	data := []byte{6, 'a', 'b', 'c', 'd', 'e'}
+
+	// Without ReuseBuffers every value gets its own slice, which the field can keep
+	for _, eval := range []func(*bytesKeeper) error{
+		func(target *bytesKeeper) error { return Eval(bytes.NewReader(data), program, target) },
+		func(target *bytesKeeper) error { return EvalBytes(data, program, target) },
+	} {
+		target := &bytesKeeper{}
+		if err := eval(target); err != nil {
+			t.Fatal(err)
+		}
+		if len(target.values) != 2 || string(target.values[0]) != "abc" || string(target.values[1]) != "de" {
+			t.Fatalf("Unexpected values %q", target.values)
+		}
+	}
+
+	// With ReuseBuffers the values share the scratch buffer
+	target := &bytesKeeper{}
+	if err := EvalWithOptions(bytes.NewReader(data), program, target, &Options{ReuseBuffers: true}); err != nil {
+		t.Fatal(err)
+	}
+	if len(target.values) != 2 || &target.values[0][0] != &target.values[1][0] {
+		t.Fatalf("Expected the values to share a buffer, got %q", target.values)
+	}
+}
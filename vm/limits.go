@@ -0,0 +1,73 @@
+package vm
+
+import (
+	"fmt"
+)
+
+// Limits bounds the resources a program may use to decode a single value, so
+// data from untrusted producers can't exhaust memory or loop forever.
+// A zero value for any limit means it isn't enforced.
+type Limits struct {
+	// The maximum length of a bytes or string value
+	MaxBytesLength int64
+
+	// The maximum number of items in a single block of an array or map
+	MaxBlockItems int64
+
+	// The maximum number of items in an array or map, across all its blocks
+	MaxItems int64
+
+	// The maximum nesting depth of records, unions, arrays and maps
+	MaxDepth int
+
+	// The maximum number of bytes consumed from the input
+	MaxBytesRead int64
+}
+
+// The limit which was exceeded
+type LimitKind int
+
+const (
+	BytesLengthLimit LimitKind = iota
+	BlockItemsLimit
+	ItemsLimit
+	DepthLimit
+	BytesReadLimit
+)
+
+func (k LimitKind) String() string {
+	switch k {
+	case BytesLengthLimit:
+		return "bytes length"
+	case BlockItemsLimit:
+		return "items per block"
+	case ItemsLimit:
+		return "items"
+	case DepthLimit:
+		return "nesting depth"
+	case BytesReadLimit:
+		return "bytes read"
+	}
+	return "Unknown"
+}
+
+// LimitError is returned when the input exceeds one of the Limits
+type LimitError struct {
+	Kind LimitKind
+	// The configured limit
+	Max int64
+	// The value which exceeded it
+	Value int64
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("Limit exceeded: %v %v is greater than the maximum of %v", e.Kind, e.Value, e.Max)
+}
+
+// Check a value against a limit, where zero is unlimited
+func checkLimit(kind LimitKind, max, value int64) error {
+	if max > 0 && value > max {
+		return &LimitError{Kind: kind, Max: max, Value: value}
+	}
+	return nil
+}
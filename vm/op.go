@@ -60,6 +60,31 @@ const (
 
 	// Pop the top of the loop stack and store the value in the Long register
 	PopLoop
+
+	// Advance past a value of the operand type on the wire without decoding it.
+	// Skipping bytes also skips an array or map block, given its byte size.
+	Skip
+
+	// The following superinstructions are emitted by the optimizer in place of common sequences
+
+	// Read a value of the operand type from the wire, put it in the frame and set the current target to it
+	ReadSet
+
+	// Read the item count of an array or map block into the Long register. If it's zero, the array
+	// or map is done and the PC moves to the operand. If it's negative, read and discard the byte size
+	// of the block, and make the count positive.
+	ReadBlock
+
+	// Like ReadBlock, but skip the blocks which have a byte size instead of reading their items
+	SkipBlock
+
+	// Decrement the Long register. If it's zero, move the PC to the ReadBlock at the operand to read
+	// the next block, otherwise to the PushLoop after it to read the next item.
+	EndBlock
+
+	// Jump using the table of operand jump instructions which follows. If the Long register is an
+	// index into the table, execute that jump, otherwise continue after the table.
+	JumpTable
 )
 
 func (o Op) String() string {
@@ -102,6 +127,18 @@ func (o Op) String() string {
 		return "pop_loop"
 	case SetLong:
 		return "set_long"
+	case Skip:
+		return "skip"
+	case ReadSet:
+		return "read_set"
+	case ReadBlock:
+		return "read_block"
+	case SkipBlock:
+		return "skip_block"
+	case EndBlock:
+		return "end_block"
+	case JumpTable:
+		return "jump_table"
 	}
 	return "Unknown"
 }
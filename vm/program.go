@@ -1,33 +1,34 @@
 package vm
 
-import (
-	"fmt"
-)
-
 type Program struct {
 	// The list of instructions that make up the deserializer program
 	Instructions []Instruction
 
 	// A list of errors that can be triggered by halt(x), where x is the index in this array + 1
 	Errors []string
+
+	// The name of the type the program reads, used as the root of the paths in errors
+	Name string
+
+	// The names of the record fields, by the offset of the enter(x) instruction which reads them
+	FieldNames map[int]string
+
+	// The source map, which has where each instruction came from in the schemas, by offset.
+	// Programs built by the compiler have one, but it's not part of the binary format.
+	Sources []Source
+}
+
+// The origin of an instruction in the schemas a program was compiled from
+type Source struct {
+	// The compiler method which emitted the instruction, like `main` or `record-rw-Order`
+	Method string
+
+	// The path of the field the instruction reads, like `Order.items[].sku`.
+	// Array items and map values are marked with `[]`.
+	Path string
 }
 
+// String returns the program in the assembly format, see Assemble
 func (p *Program) String() string {
-	s := ""
-	depth := ""
-	for i, inst := range p.Instructions {
-		if inst.Op == Exit {
-			depth = depth[0 : len(depth)-3]
-		}
-		s += fmt.Sprintf("%v:\t%v%v\n", i, depth, inst)
-
-		if inst.Op == Enter || inst.Op == AppendArray || inst.Op == AppendMap {
-			depth += "|  "
-		}
-	}
-
-	for i, err := range p.Errors {
-		s += fmt.Sprintf("Error %v:\t%v\n", i+1, err)
-	}
-	return s
+	return p.Disassemble()
 }
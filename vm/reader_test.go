@@ -2,12 +2,94 @@ package vm
 
 import (
 	"bytes"
+	"io"
 	"testing"
 )
 
 func BenchmarkReadBool(b *testing.B) {
 	for i := 0; i < b.N; i++ {
-		r := bytes.NewBuffer([]byte{1})
-		readBool(r)
+		r := newStreamReader(bytes.NewBuffer([]byte{1}))
+		r.readBool()
+	}
+}
+
+func BenchmarkBytesReadBool(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		r := newBytesReader([]byte{1})
+		r.readBool()
+	}
+}
+
+// A long with the maximum varint length, which stresses the per-byte overhead of each reader
+var benchmarkLong = []byte{0xfe, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01}
+
+func BenchmarkReadLong(b *testing.B) {
+	data := &onlyReader{bytes.NewReader(benchmarkLong)}
+	for i := 0; i < b.N; i++ {
+		data.Reset(benchmarkLong)
+		r := newStreamReader(data)
+		r.readLong()
+	}
+}
+
+func BenchmarkBytesReadLong(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		r := newBytesReader(benchmarkLong)
+		r.readLong()
+	}
+}
+
+// onlyReader hides the ReadByte method of a bytes.Reader
+type onlyReader struct {
+	*bytes.Reader
+}
+
+func (r *onlyReader) Read(b []byte) (int, error) {
+	return r.Reader.Read(b)
+}
+
+func TestBytesReaderMatchesStreamReader(t *testing.T) {
+	data := []byte{1, 0xfe, 0xff, 0xff, 0xff, 0x0f, 0x03, 0, 0, 0x80, 0x3f, 6, 'a', 'b', 'c', 0, 0, 0, 0, 0, 0, 0xf0, 0x3f}
+	stream := newStreamReader(&onlyReader{bytes.NewReader(data)})
+	slice := newBytesReader(data)
+
+	for _, r := range []decoder{&stream, &slice} {
+		if v, err := r.readBool(); err != nil || v != true {
+			t.Fatalf("readBool: %v %v", v, err)
+		}
+		if v, err := r.readInt(); err != nil || v != 2147483647 {
+			t.Fatalf("readInt: %v %v", v, err)
+		}
+		if v, err := r.readLong(); err != nil || v != -2 {
+			t.Fatalf("readLong: %v %v", v, err)
+		}
+		if v, err := r.readFloat(); err != nil || v != 1 {
+			t.Fatalf("readFloat: %v %v", v, err)
+		}
+		if v, err := r.readBytes(nil); err != nil || string(v) != "abc" {
+			t.Fatalf("readBytes: %v %v", v, err)
+		}
+		if v, err := r.readDouble(); err != nil || v != 1 {
+			t.Fatalf("readDouble: %v %v", v, err)
+		}
+		if n := r.consumed(); n != int64(len(data)) {
+			t.Fatalf("Expected %v bytes consumed, got %v", len(data), n)
+		}
+		if _, err := r.readLong(); err != io.EOF {
+			t.Fatalf("Expected EOF, got %v", err)
+		}
+	}
+}
+
+func TestBytesReaderZeroCopy(t *testing.T) {
+	data := []byte{6, 'a', 'b', 'c'}
+	r := newBytesReader(data)
+	r.zeroCopy = true
+	v, err := r.readBytes(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if &v[0] != &data[1] {
+		t.Fatalf("Expected the value to share the input's memory")
 	}
 }
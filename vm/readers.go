@@ -4,6 +4,7 @@ import (
 	"encoding/binary"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"math"
 )
 
@@ -11,145 +12,195 @@ type ByteReader interface {
 	ReadByte() (byte, error)
 }
 
-func readBool(r io.Reader) (bool, error) {
-	var b byte
-	var err error
+// Discarder is implemented by buffered readers like bufio.Reader, which can skip input without copying it
+type Discarder interface {
+	Discard(n int) (int, error)
+}
+
+// decoder reads Avro primitives from the input of a program
+type decoder interface {
+	readBool() (bool, error)
+	readInt() (int32, error)
+	readLong() (int64, error)
+	readFloat() (float32, error)
+	readDouble() (float64, error)
+	// Read a length-prefixed value, using the capacity of buf if the value has to be copied
+	readBytes(buf []byte) ([]byte, error)
+	// Read size bytes, using the capacity of buf if the value has to be copied
+	readFixed(buf []byte, size int) ([]byte, error)
+	// Advance past n bytes without reading them
+	skip(n int64) error
+	// The number of bytes consumed from the input
+	consumed() int64
+}
+
+// streamReader decodes Avro primitives from an io.Reader.
+// Fixed-size values are read through an internal buffer, so decoding them doesn't allocate.
+type streamReader struct {
+	r   io.Reader
+	br  ByteReader
+	buf [8]byte
+	// The number of bytes consumed from r
+	offset int64
+	// The Limits on the input, zero is unlimited
+	maxBytesLength int64
+	maxBytesRead   int64
+}
+
+func newStreamReader(r io.Reader) streamReader {
+	s := streamReader{r: r}
 	if br, ok := r.(ByteReader); ok {
-		b, err = br.ReadByte()
-	} else {
-		bs := make([]byte, 1)
-		_, err = io.ReadFull(r, bs)
-		if err != nil {
-			return false, err
+		s.br = br
+	}
+	return s
+}
+
+func (s *streamReader) consumed() int64 {
+	return s.offset
+}
+
+func (s *streamReader) readByte() (byte, error) {
+	if s.br != nil {
+		if err := checkLimit(BytesReadLimit, s.maxBytesRead, s.offset+1); err != nil {
+			return 0, err
 		}
-		b = bs[0]
+		b, err := s.br.ReadByte()
+		if err == nil {
+			s.offset += 1
+		}
+		return b, err
+	}
+	if err := s.readFull(s.buf[:1]); err != nil {
+		return 0, err
+	}
+	return s.buf[0], nil
+}
+
+func (s *streamReader) readBool() (bool, error) {
+	b, err := s.readByte()
+	if err != nil {
+		return false, err
 	}
 	return b == 1, nil
 }
 
-func readBytes(r io.Reader) ([]byte, error) {
-	size, err := readLong(r)
+// Read a length-prefixed value into the capacity of buf, growing it if necessary
+func (s *streamReader) readBytes(buf []byte) ([]byte, error) {
+	size, err := s.readLong()
 	if err != nil {
 		return nil, err
 	}
-	if size == 0 {
-		return []byte{}, nil
+
+	// makeslice can fail depending on available memory.
+	// We arbitrarily limit the size to sane default (~2.2GB).
+	if size < 0 || size > math.MaxInt32 {
+		return nil, fmt.Errorf("bytes length out of range: %d", size)
+	}
+	if err := checkLimit(BytesLengthLimit, s.maxBytesLength, size); err != nil {
+		return nil, err
 	}
-	bb := make([]byte, size)
-	_, err = io.ReadFull(r, bb)
-	return bb, err
+	return s.readFixed(buf, int(size))
 }
 
-func readDouble(r io.Reader) (float64, error) {
-	buf := make([]byte, 8)
-	_, err := io.ReadFull(r, buf)
+func (s *streamReader) readDouble() (float64, error) {
+	err := s.readFull(s.buf[:8])
 	if err != nil {
 		return 0, err
 	}
-	bits := binary.LittleEndian.Uint64(buf)
+	bits := binary.LittleEndian.Uint64(s.buf[:8])
 	val := math.Float64frombits(bits)
 	return val, nil
 }
 
-func readFloat(r io.Reader) (float32, error) {
-	buf := make([]byte, 4)
-	_, err := io.ReadFull(r, buf)
+func (s *streamReader) readFloat() (float32, error) {
+	err := s.readFull(s.buf[:4])
 	if err != nil {
 		return 0, err
 	}
-	bits := binary.LittleEndian.Uint32(buf)
+	bits := binary.LittleEndian.Uint32(s.buf[:4])
 	val := math.Float32frombits(bits)
 	return val, nil
 }
 
-func readInt(r io.Reader) (int32, error) {
+func (s *streamReader) readInt() (int32, error) {
 	var v int
-	var b byte
-	var err error
-	if br, ok := r.(ByteReader); ok {
-		for shift := uint(0); ; shift += 7 {
-			if b, err = br.ReadByte(); err != nil {
-				return 0, err
-			}
-			v |= int(b&127) << shift
-			if b&128 == 0 {
-				break
-			}
+	for shift := uint(0); ; shift += 7 {
+		b, err := s.readByte()
+		if err != nil {
+			return 0, err
 		}
-	} else {
-		buf := make([]byte, 1)
-		for shift := uint(0); ; shift += 7 {
-			if _, err := io.ReadFull(r, buf); err != nil {
-				return 0, err
-			}
-			b = buf[0]
-			v |= int(b&127) << shift
-			if b&128 == 0 {
-				break
-			}
+		v |= int(b&127) << shift
+		if b&128 == 0 {
+			break
 		}
 	}
 	datum := (int32(v>>1) ^ -int32(v&1))
 	return datum, nil
 }
 
-func readLong(r io.Reader) (int64, error) {
+func (s *streamReader) readLong() (int64, error) {
 	var v uint64
-	var b byte
-	var err error
-	if br, ok := r.(ByteReader); ok {
-		for shift := uint(0); ; shift += 7 {
-			if b, err = br.ReadByte(); err != nil {
-				return 0, err
-			}
-			v |= uint64(b&127) << shift
-			if b&128 == 0 {
-				break
-			}
+	for shift := uint(0); ; shift += 7 {
+		b, err := s.readByte()
+		if err != nil {
+			return 0, err
 		}
-	} else {
-		buf := make([]byte, 1)
-		for shift := uint(0); ; shift += 7 {
-			if _, err = io.ReadFull(r, buf); err != nil {
-				return 0, err
-			}
-			b = buf[0]
-			v |= uint64(b&127) << shift
-			if b&128 == 0 {
-				break
-			}
+		v |= uint64(b&127) << shift
+		if b&128 == 0 {
+			break
 		}
 	}
 	datum := (int64(v>>1) ^ -int64(v&1))
 	return datum, nil
 }
 
-func readString(r io.Reader) (string, error) {
-	len, err := readLong(r)
-	if err != nil {
-		return "", err
+// Read size bytes into the capacity of buf, growing it if necessary
+// Read the value into buf, or into a new slice if buf is nil
+func (s *streamReader) readFixed(buf []byte, size int) ([]byte, error) {
+	// Check the limit before growing the buffer
+	if err := checkLimit(BytesReadLimit, s.maxBytesRead, s.offset+int64(size)); err != nil {
+		return nil, err
 	}
-
-	// makeslice can fail depending on available memory.
-	// We arbitrarily limit string size to sane default (~2.2GB).
-	if len < 0 || len > math.MaxInt32 {
-		return "", fmt.Errorf("string length out of range: %d", len)
+	if buf == nil || cap(buf) < size {
+		buf = make([]byte, size)
 	}
+	buf = buf[:size]
+	return buf, s.readFull(buf)
+}
 
-	if len == 0 {
-		return "", nil
+func (s *streamReader) skip(n int64) error {
+	if err := checkLimit(BytesReadLimit, s.maxBytesRead, s.offset+n); err != nil {
+		return err
 	}
-
-	bb := make([]byte, len)
-	_, err = io.ReadFull(r, bb)
-	if err != nil {
-		return "", err
+	if d, ok := s.r.(Discarder); ok && n <= math.MaxInt32 {
+		skipped, err := d.Discard(int(n))
+		s.offset += int64(skipped)
+		return err
 	}
-	return string(bb), nil
+	// Short values are read through the internal buffer, which doesn't allocate
+	if n <= 8*int64(len(s.buf)) {
+		for n > 0 {
+			chunk := s.buf[:]
+			if n < int64(len(chunk)) {
+				chunk = chunk[:n]
+			}
+			if err := s.readFull(chunk); err != nil {
+				return err
+			}
+			n -= int64(len(chunk))
+		}
+		return nil
+	}
+	skipped, err := io.CopyN(ioutil.Discard, s.r, n)
+	s.offset += skipped
+	return err
 }
 
-func readFixed(r io.Reader, size int) ([]byte, error) {
-	bb := make([]byte, size)
-	_, err := io.ReadFull(r, bb)
-	return bb, err
+func (s *streamReader) readFull(buf []byte) error {
+	if err := checkLimit(BytesReadLimit, s.maxBytesRead, s.offset+int64(len(buf))); err != nil {
+		return err
+	}
+	n, err := io.ReadFull(s.r, buf)
+	s.offset += int64(n)
+	return err
 }
@@ -0,0 +1,152 @@
+package vm
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Tracer is called by the VM as it evaluates a program, set it with Options.Tracer
+type Tracer interface {
+	// Start is called before the program is evaluated
+	Start(program *Program)
+
+	// Step is called before each instruction is executed, with its offset in the program,
+	// the registers of the current frame and the number of bytes read from the input so far
+	Step(pc int, inst Instruction, frame Frame, offset int64)
+
+	// End is called once the evaluation is done, with the error it returned
+	End(err error)
+}
+
+// TraceWriter is a Tracer which writes each instruction executed to a writer, with the Long and Condition
+// registers and the input offset. If the program has a source map, the path of the field is also written.
+type TraceWriter struct {
+	w       io.Writer
+	program *Program
+}
+
+func NewTraceWriter(w io.Writer) *TraceWriter {
+	return &TraceWriter{w: w}
+}
+
+func (t *TraceWriter) Start(program *Program) {
+	t.program = program
+	fmt.Fprintf(t.w, "start %v\n", program.Name)
+}
+
+func (t *TraceWriter) Step(pc int, inst Instruction, frame Frame, offset int64) {
+	fmt.Fprintf(t.w, "%v:\t%v\tlong=%v cond=%v offset=%v", pc, inst, frame.Long, frame.Condition, offset)
+	if pc < len(t.program.Sources) {
+		fmt.Fprintf(t.w, "\t; %v", t.program.Sources[pc].Path)
+	}
+	fmt.Fprintf(t.w, "\n")
+}
+
+func (t *TraceWriter) End(err error) {
+	if err != nil {
+		fmt.Fprintf(t.w, "end %v: %v\n", t.program.Name, err)
+		return
+	}
+	fmt.Fprintf(t.w, "end %v\n", t.program.Name)
+}
+
+// MethodProfile is the number of instructions executed in a method of a program and the time spent
+// executing them, including the time spent in the target setting the values they decoded.
+// Time spent in methods called from this one is counted in their own MethodProfile.
+type MethodProfile struct {
+	Method       string
+	Instructions int64
+	Time         time.Duration
+}
+
+// Profiler is a Tracer which aggregates the instructions and time spent in each method of the programs it
+// traces. The compiler emits a method for each record type, so the profile shows which types dominate decoding.
+// Methods are found with the program's source map; programs without one are profiled as a single method named
+// after the program. Like the Options it's set in, a Profiler must not be shared between goroutines.
+type Profiler struct {
+	methods map[string]*MethodProfile
+	program *Program
+	current *MethodProfile
+	last    time.Time
+}
+
+func NewProfiler() *Profiler {
+	return &Profiler{
+		methods: make(map[string]*MethodProfile),
+	}
+}
+
+func (p *Profiler) Start(program *Program) {
+	p.program = program
+	p.current = nil
+}
+
+func (p *Profiler) Step(pc int, inst Instruction, frame Frame, offset int64) {
+	now := time.Now()
+	if p.current != nil {
+		p.current.Time += now.Sub(p.last)
+	}
+
+	name := p.program.Name
+	if pc < len(p.program.Sources) {
+		name = p.program.Sources[pc].Method
+	}
+	if p.current == nil || p.current.Method != name {
+		p.current = p.method(name)
+	}
+	p.current.Instructions += 1
+	p.last = now
+}
+
+func (p *Profiler) End(err error) {
+	if p.current != nil {
+		p.current.Time += time.Since(p.last)
+		p.current = nil
+	}
+}
+
+func (p *Profiler) method(name string) *MethodProfile {
+	method, ok := p.methods[name]
+	if !ok {
+		method = &MethodProfile{Method: name}
+		p.methods[name] = method
+	}
+	return method
+}
+
+// Profile returns the profile of each method, the ones which took the most time first
+func (p *Profiler) Profile() []MethodProfile {
+	profile := make([]MethodProfile, 0, len(p.methods))
+	for _, method := range p.methods {
+		profile = append(profile, *method)
+	}
+	sort.Slice(profile, func(i, j int) bool {
+		if profile[i].Time != profile[j].Time {
+			return profile[i].Time > profile[j].Time
+		}
+		return profile[i].Method < profile[j].Method
+	})
+	return profile
+}
+
+// Reset discards the profile collected so far
+func (p *Profiler) Reset() {
+	p.methods = make(map[string]*MethodProfile)
+	p.current = nil
+}
+
+// String returns the profile as a table
+func (p *Profiler) String() string {
+	var sb strings.Builder
+	w := tabwriter.NewWriter(&sb, 0, 8, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(w, "method\tinstructions\ttime\t\n")
+	for _, method := range p.Profile() {
+		fmt.Fprintf(w, "%v\t%v\t%v\t\n", method.Method, method.Instructions, method.Time)
+	}
+	w.Flush()
+	return sb.String()
+}
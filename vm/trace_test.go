@@ -0,0 +1,75 @@
+package vm
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/actgardner/gogen-avro/vm/types"
+)
+
+// Reads a long in main, and two ints in a method called twice
+var traceTestProgram = &Program{
+	Instructions: []Instruction{
+		{Read, Long},
+		{Call, 4},
+		{Call, 4},
+		{Halt, 0},
+		{Read, Int},
+		{Read, Int},
+		{Return, NoopField},
+	},
+	Name: "TestRecord",
+	Sources: []Source{
+		{"main", "TestRecord.a"},
+		{"main", "TestRecord.b"},
+		{"main", "TestRecord.c"},
+		{"main", "TestRecord"},
+		{"record-rw-Pair", "Pair.x"},
+		{"record-rw-Pair", "Pair.y"},
+		{"record-rw-Pair", "Pair"},
+	},
+}
+
+var traceTestData = []byte{4, 2, 4, 6, 8}
+
+func TestProfiler(t *testing.T) {
+	profiler := NewProfiler()
+	opts := &Options{Tracer: profiler}
+	var target types.Long
+	for i := 0; i < 2; i++ {
+		if err := EvalBytesWithOptions(traceTestData, traceTestProgram, &target, opts); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	instructions := make(map[string]int64)
+	for _, method := range profiler.Profile() {
+		instructions[method.Method] = method.Instructions
+	}
+	if len(instructions) != 2 || instructions["main"] != 8 || instructions["record-rw-Pair"] != 12 {
+		t.Fatalf("Unexpected profile:\n%v", profiler)
+	}
+
+	profiler.Reset()
+	if len(profiler.Profile()) != 0 {
+		t.Fatalf("Expected an empty profile after Reset, got:\n%v", profiler)
+	}
+}
+
+func TestTraceWriter(t *testing.T) {
+	var buf bytes.Buffer
+	opts := &Options{Tracer: NewTraceWriter(&buf)}
+	var target types.Long
+	if err := EvalBytesWithOptions(traceTestData[:3], traceTestProgram, &target, opts); err == nil {
+		t.Fatal("Expected an error decoding truncated data")
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 9 {
+		t.Fatalf("Unexpected trace:\n%v", buf.String())
+	}
+	if lines[0] != "start TestRecord" || lines[2] != "1:\tcall(4)\tlong=2 cond=false offset=1\t; TestRecord.b" || !strings.HasPrefix(lines[8], "end TestRecord: ") {
+		t.Fatalf("Unexpected trace:\n%v", buf.String())
+	}
+}
@@ -2,52 +2,49 @@ package types
 
 type Boolean bool
 
-func (b *Boolean) SetBoolean(v bool) {
+func (b *Boolean) SetBoolean(v bool) error {
 	*(*bool)(b) = v
+	return nil
 }
 
-func (b *Boolean) SetInt(v int32) {
-	panic("Unable to assign int to boolean field")
+func (b *Boolean) SetInt(v int32) error {
+	return &FieldError{Field: "boolean", Op: OpAssign, Value: "int"}
 }
 
-func (b *Boolean) SetLong(v int64) {
-	panic("Unable to assign long to boolean field")
+func (b *Boolean) SetLong(v int64) error {
+	return &FieldError{Field: "boolean", Op: OpAssign, Value: "long"}
 }
 
-func (b *Boolean) SetFloat(v float32) {
-	panic("Unable to assign float to boolean field")
+func (b *Boolean) SetFloat(v float32) error {
+	return &FieldError{Field: "boolean", Op: OpAssign, Value: "float"}
 }
 
-func (b *Boolean) SetDouble(v float64) {
-	panic("Unable to assign double to boolean field")
+func (b *Boolean) SetDouble(v float64) error {
+	return &FieldError{Field: "boolean", Op: OpAssign, Value: "double"}
 }
 
-func (b *Boolean) SetBytes(v []byte) {
-	panic("Unable to assign bytes to boolean field")
+func (b *Boolean) SetBytes(v []byte) error {
+	return &FieldError{Field: "boolean", Op: OpAssign, Value: "bytes"}
 }
 
-func (b *Boolean) SetString(v string) {
-	panic("Unable to assign string to boolean field")
+func (b *Boolean) SetString(v string) error {
+	return &FieldError{Field: "boolean", Op: OpAssign, Value: "string"}
 }
 
-func (b *Boolean) SetUnionElem(v int64) {
-	panic("Unable to assign union elem to boolean field")
+func (b *Boolean) Get(i int) (Field, error) {
+	return nil, &FieldError{Field: "boolean", Op: OpGet, Index: i}
 }
 
-func (b *Boolean) Get(i int) Field {
-	panic("Unable to get field from boolean field")
+func (b *Boolean) SetDefault(i int) error {
+	return &FieldError{Field: "boolean", Op: OpSetDefault, Index: i}
 }
 
-func (b *Boolean) SetDefault(i int) {
-	panic("Unable to set default on boolean field")
+func (b *Boolean) AppendMap(key string) (Field, error) {
+	return nil, &FieldError{Field: "boolean", Op: OpAppendMap}
 }
 
-func (b *Boolean) AppendMap(key string) Field {
-	panic("Unable to append map key to from boolean field")
-}
-
-func (b *Boolean) AppendArray() Field {
-	panic("Unable to append array element to from boolean field")
+func (b *Boolean) AppendArray() (Field, error) {
+	return nil, &FieldError{Field: "boolean", Op: OpAppendArray}
 }
 
 func (b *Boolean) Finalize() {}
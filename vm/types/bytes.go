@@ -2,52 +2,54 @@ package types
 
 type Bytes []byte
 
-func (b *Bytes) SetBoolean(v bool) {
-	panic("Unable to assign bytes to bytes field")
+func (b *Bytes) SetBoolean(v bool) error {
+	return &FieldError{Field: "bytes", Op: OpAssign, Value: "boolean"}
 }
 
-func (b *Bytes) SetInt(v int32) {
-	panic("Unable to assign int to bytes field")
+func (b *Bytes) SetInt(v int32) error {
+	return &FieldError{Field: "bytes", Op: OpAssign, Value: "int"}
 }
 
-func (b *Bytes) SetLong(v int64) {
-	panic("Unable to assign long to bytes field")
+func (b *Bytes) SetLong(v int64) error {
+	return &FieldError{Field: "bytes", Op: OpAssign, Value: "long"}
 }
 
-func (b *Bytes) SetFloat(v float32) {
-	panic("Unable to assign float to bytes field")
+func (b *Bytes) SetFloat(v float32) error {
+	return &FieldError{Field: "bytes", Op: OpAssign, Value: "float"}
 }
 
-func (b *Bytes) SetDouble(v float64) {
-	panic("Unable to assign double to bytes field")
+func (b *Bytes) SetDouble(v float64) error {
+	return &FieldError{Field: "bytes", Op: OpAssign, Value: "double"}
 }
 
-func (b *Bytes) SetUnionElem(v int64) {
-	panic("Unable to assign union elem to bytes field")
+func (b *Bytes) SetBytes(v []byte) error {
+	// Copy into the existing capacity, so decoding into the same field repeatedly doesn't allocate
+	if *b == nil {
+		*b = make([]byte, 0, len(v))
+	}
+	*b = append((*b)[:0], v...)
+	return nil
 }
 
-func (b *Bytes) SetBytes(v []byte) {
-	*b = v
-}
-
-func (b *Bytes) SetString(v string) {
+func (b *Bytes) SetString(v string) error {
 	*b = []byte(v)
+	return nil
 }
 
-func (b *Bytes) Get(i int) Field {
-	panic("Unable to get field from bytes field")
+func (b *Bytes) Get(i int) (Field, error) {
+	return nil, &FieldError{Field: "bytes", Op: OpGet, Index: i}
 }
 
-func (b *Bytes) SetDefault(i int) {
-	panic("Unable to set default on bytes field")
+func (b *Bytes) SetDefault(i int) error {
+	return &FieldError{Field: "bytes", Op: OpSetDefault, Index: i}
 }
 
-func (b *Bytes) AppendMap(key string) Field {
-	panic("Unable to append map key to from bytes field")
+func (b *Bytes) AppendMap(key string) (Field, error) {
+	return nil, &FieldError{Field: "bytes", Op: OpAppendMap}
 }
 
-func (b *Bytes) AppendArray() Field {
-	panic("Unable to append array element to from bytes field")
+func (b *Bytes) AppendArray() (Field, error) {
+	return nil, &FieldError{Field: "bytes", Op: OpAppendArray}
 }
 
 func (b *Bytes) Finalize() {}
@@ -2,52 +2,52 @@ package types
 
 type Double float64
 
-func (b *Double) SetBoolean(v bool) {
-	panic("Unable to assign boolean to double field")
+func (b *Double) SetBoolean(v bool) error {
+	return &FieldError{Field: "double", Op: OpAssign, Value: "boolean"}
 }
 
-func (b *Double) SetInt(v int32) {
+func (b *Double) SetInt(v int32) error {
 	*(*float64)(b) = float64(v)
+	return nil
 }
 
-func (b *Double) SetLong(v int64) {
+func (b *Double) SetLong(v int64) error {
 	*(*float64)(b) = float64(v)
+	return nil
 }
 
-func (b *Double) SetFloat(v float32) {
+func (b *Double) SetFloat(v float32) error {
 	*(*float64)(b) = float64(v)
+	return nil
 }
 
-func (b *Double) SetDouble(v float64) {
+func (b *Double) SetDouble(v float64) error {
 	*(*float64)(b) = v
+	return nil
 }
 
-func (b *Double) SetUnionElem(v int64) {
-	panic("Unable to assign union elem to double field")
+func (b *Double) SetBytes(v []byte) error {
+	return &FieldError{Field: "double", Op: OpAssign, Value: "bytes"}
 }
 
-func (b *Double) SetBytes(v []byte) {
-	panic("Unable to assign bytes to double field")
+func (b *Double) SetString(v string) error {
+	return &FieldError{Field: "double", Op: OpAssign, Value: "string"}
 }
 
-func (b *Double) SetString(v string) {
-	panic("Unable to assign string to double field")
+func (b *Double) Get(i int) (Field, error) {
+	return nil, &FieldError{Field: "double", Op: OpGet, Index: i}
 }
 
-func (b *Double) Get(i int) Field {
-	panic("Unable to get field from double field")
+func (b *Double) SetDefault(i int) error {
+	return &FieldError{Field: "double", Op: OpSetDefault, Index: i}
 }
 
-func (b *Double) SetDefault(i int) {
-	panic("Unable to set default on double field")
+func (b *Double) AppendMap(key string) (Field, error) {
+	return nil, &FieldError{Field: "double", Op: OpAppendMap}
 }
 
-func (b *Double) AppendMap(key string) Field {
-	panic("Unable to append map key to from double field")
-}
-
-func (b *Double) AppendArray() Field {
-	panic("Unable to append array element to from double field")
+func (b *Double) AppendArray() (Field, error) {
+	return nil, &FieldError{Field: "double", Op: OpAppendArray}
 }
 
 func (b *Double) Finalize() {}
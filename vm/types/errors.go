@@ -0,0 +1,39 @@
+package types
+
+import (
+	"fmt"
+)
+
+// The operations on a Field which can fail
+type Op string
+
+const (
+	OpAssign      Op = "assign"
+	OpGet         Op = "get field"
+	OpSetDefault  Op = "set default"
+	OpAppendMap   Op = "append map entry"
+	OpAppendArray Op = "append array element"
+)
+
+// FieldError is returned when a Field doesn't support an operation, usually
+// because the value on the wire can't be stored in it.
+type FieldError struct {
+	// The type of the field, like "int" or the name of a generated struct
+	Field string
+	// The operation which failed
+	Op Op
+	// For assignments, the type of the value being assigned
+	Value string
+	// For Get and SetDefault, the index of the nested field
+	Index int
+}
+
+func (e *FieldError) Error() string {
+	switch e.Op {
+	case OpAssign:
+		return fmt.Sprintf("Unable to assign %v to %v field", e.Value, e.Field)
+	case OpGet, OpSetDefault:
+		return fmt.Sprintf("Unable to %v %v on %v field", e.Op, e.Index, e.Field)
+	}
+	return fmt.Sprintf("Unable to %v on %v field", e.Op, e.Field)
+}
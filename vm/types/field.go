@@ -2,25 +2,27 @@
 package types
 
 // The interface neeed by GADGT to enter and set fields on a type
-// Most types only need to implement a subset
+// Most types only need to implement a subset, and return a *FieldError from the others
 type Field interface {
-	// Assign a primitive field
-	SetBoolean(v bool)
-	SetInt(v int32)
-	SetLong(v int64)
-	SetFloat(v float32)
-	SetDouble(v float64)
-	SetBytes(v []byte)
-	SetString(v string)
+	// Assign a primitive field.
+	// The slice passed to SetBytes can be kept, unless the value is decoded with vm.Options.ReuseBuffers
+	// or ZeroCopy set. It's then only valid for the duration of the call, and must be copied to keep it.
+	SetBoolean(v bool) error
+	SetInt(v int32) error
+	SetLong(v int64) error
+	SetFloat(v float32) error
+	SetDouble(v float64) error
+	SetBytes(v []byte) error
+	SetString(v string) error
 
 	// Get a nested field
-	Get(i int) Field
+	Get(i int) (Field, error)
 	// Set the default value for a given field
-	SetDefault(i int)
+	SetDefault(i int) error
 
 	// Append a new value to a map or array and enter it
-	AppendMap(key string) Field
-	AppendArray() Field
+	AppendMap(key string) (Field, error)
+	AppendArray() (Field, error)
 
 	// Finalize a field if necessary
 	Finalize()
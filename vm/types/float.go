@@ -2,52 +2,51 @@ package types
 
 type Float float32
 
-func (b *Float) SetBoolean(v bool) {
-	panic("Unable to assign boolean to float field")
+func (b *Float) SetBoolean(v bool) error {
+	return &FieldError{Field: "float", Op: OpAssign, Value: "boolean"}
 }
 
-func (b *Float) SetInt(v int32) {
+func (b *Float) SetInt(v int32) error {
 	*(*float32)(b) = float32(v)
+	return nil
 }
 
-func (b *Float) SetLong(v int64) {
+func (b *Float) SetLong(v int64) error {
 	*(*float32)(b) = float32(v)
+	return nil
 }
 
-func (b *Float) SetFloat(v float32) {
+func (b *Float) SetFloat(v float32) error {
 	*(*float32)(b) = v
+	return nil
 }
 
-func (b *Float) SetUnionElem(v int64) {
-	panic("Unable to assign union elem to float field")
+func (b *Float) SetDouble(v float64) error {
+	return &FieldError{Field: "float", Op: OpAssign, Value: "double"}
 }
 
-func (b *Float) SetDouble(v float64) {
-	panic("Unable to assign double to float field")
+func (b *Float) SetBytes(v []byte) error {
+	return &FieldError{Field: "float", Op: OpAssign, Value: "bytes"}
 }
 
-func (b *Float) SetBytes(v []byte) {
-	panic("Unable to assign double to float field")
+func (b *Float) SetString(v string) error {
+	return &FieldError{Field: "float", Op: OpAssign, Value: "string"}
 }
 
-func (b *Float) SetString(v string) {
-	panic("Unable to assign double to float field")
+func (b *Float) Get(i int) (Field, error) {
+	return nil, &FieldError{Field: "float", Op: OpGet, Index: i}
 }
 
-func (b *Float) Get(i int) Field {
-	panic("Unable to get field from float field")
+func (b *Float) SetDefault(i int) error {
+	return &FieldError{Field: "float", Op: OpSetDefault, Index: i}
 }
 
-func (b *Float) SetDefault(i int) {
-	panic("Unable to set default on float field")
+func (b *Float) AppendMap(key string) (Field, error) {
+	return nil, &FieldError{Field: "float", Op: OpAppendMap}
 }
 
-func (b *Float) AppendMap(key string) Field {
-	panic("Unable to append map key to from float field")
-}
-
-func (b *Float) AppendArray() Field {
-	panic("Unable to append array element to from float field")
+func (b *Float) AppendArray() (Field, error) {
+	return nil, &FieldError{Field: "float", Op: OpAppendArray}
 }
 
 func (b *Float) Finalize() {}
@@ -2,52 +2,49 @@ package types
 
 type Int int32
 
-func (b *Int) SetBoolean(v bool) {
-	panic("Unable to assign boolean to int field")
+func (b *Int) SetBoolean(v bool) error {
+	return &FieldError{Field: "int", Op: OpAssign, Value: "boolean"}
 }
 
-func (b *Int) SetInt(v int32) {
+func (b *Int) SetInt(v int32) error {
 	*(*int32)(b) = v
+	return nil
 }
 
-func (b *Int) SetLong(v int64) {
-	panic("Unable to assign long to int field")
+func (b *Int) SetLong(v int64) error {
+	return &FieldError{Field: "int", Op: OpAssign, Value: "long"}
 }
 
-func (b *Int) SetFloat(v float32) {
-	panic("Unable to assign float to int field")
+func (b *Int) SetFloat(v float32) error {
+	return &FieldError{Field: "int", Op: OpAssign, Value: "float"}
 }
 
-func (b *Int) SetUnionElem(v int64) {
-	panic("Unable to assign union elem to int field")
+func (b *Int) SetDouble(v float64) error {
+	return &FieldError{Field: "int", Op: OpAssign, Value: "double"}
 }
 
-func (b *Int) SetDouble(v float64) {
-	panic("Unable to assign double to int field")
+func (b *Int) SetBytes(v []byte) error {
+	return &FieldError{Field: "int", Op: OpAssign, Value: "bytes"}
 }
 
-func (b *Int) SetBytes(v []byte) {
-	panic("Unable to assign bytes to int field")
+func (b *Int) SetString(v string) error {
+	return &FieldError{Field: "int", Op: OpAssign, Value: "string"}
 }
 
-func (b *Int) SetString(v string) {
-	panic("Unable to assign string to int field")
+func (b *Int) Get(i int) (Field, error) {
+	return nil, &FieldError{Field: "int", Op: OpGet, Index: i}
 }
 
-func (b *Int) Get(i int) Field {
-	panic("Unable to get field from int field")
+func (b *Int) SetDefault(i int) error {
+	return &FieldError{Field: "int", Op: OpSetDefault, Index: i}
 }
 
-func (b *Int) SetDefault(i int) {
-	panic("Unable to set default on int field")
+func (b *Int) AppendMap(key string) (Field, error) {
+	return nil, &FieldError{Field: "int", Op: OpAppendMap}
 }
 
-func (b *Int) AppendMap(key string) Field {
-	panic("Unable to append map key to from int field")
-}
-
-func (b *Int) AppendArray() Field {
-	panic("Unable to append array element to from int field")
+func (b *Int) AppendArray() (Field, error) {
+	return nil, &FieldError{Field: "int", Op: OpAppendArray}
 }
 
 func (b *Int) Finalize() {}
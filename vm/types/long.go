@@ -2,52 +2,50 @@ package types
 
 type Long int64
 
-func (b *Long) SetBoolean(v bool) {
-	panic("Unable to assign boolean to long field")
+func (b *Long) SetBoolean(v bool) error {
+	return &FieldError{Field: "long", Op: OpAssign, Value: "boolean"}
 }
 
-func (b *Long) SetInt(v int32) {
+func (b *Long) SetInt(v int32) error {
 	*(*int64)(b) = int64(v)
+	return nil
 }
 
-func (b *Long) SetLong(v int64) {
+func (b *Long) SetLong(v int64) error {
 	*(*int64)(b) = v
+	return nil
 }
 
-func (b *Long) SetFloat(v float32) {
-	panic("Unable to assign float to long field")
+func (b *Long) SetFloat(v float32) error {
+	return &FieldError{Field: "long", Op: OpAssign, Value: "float"}
 }
 
-func (b *Long) SetUnionElem(v int64) {
-	panic("Unable to assign union elem to long field")
+func (b *Long) SetDouble(v float64) error {
+	return &FieldError{Field: "long", Op: OpAssign, Value: "double"}
 }
 
-func (b *Long) SetDouble(v float64) {
-	panic("Unable to assign double to long field")
+func (b *Long) SetBytes(v []byte) error {
+	return &FieldError{Field: "long", Op: OpAssign, Value: "bytes"}
 }
 
-func (b *Long) SetBytes(v []byte) {
-	panic("Unable to assign bytes to long field")
+func (b *Long) SetString(v string) error {
+	return &FieldError{Field: "long", Op: OpAssign, Value: "string"}
 }
 
-func (b *Long) SetString(v string) {
-	panic("Unable to assign string to long field")
+func (b *Long) Get(i int) (Field, error) {
+	return nil, &FieldError{Field: "long", Op: OpGet, Index: i}
 }
 
-func (b *Long) Get(i int) Field {
-	panic("Unable to get field from long field")
+func (b *Long) SetDefault(i int) error {
+	return &FieldError{Field: "long", Op: OpSetDefault, Index: i}
 }
 
-func (b *Long) SetDefault(i int) {
-	panic("Unable to set default on long field")
+func (b *Long) AppendMap(key string) (Field, error) {
+	return nil, &FieldError{Field: "long", Op: OpAppendMap}
 }
 
-func (b *Long) AppendMap(key string) Field {
-	panic("Unable to append map key to from long field")
-}
-
-func (b *Long) AppendArray() Field {
-	panic("Unable to append array element to from long field")
+func (b *Long) AppendArray() (Field, error) {
+	return nil, &FieldError{Field: "long", Op: OpAppendArray}
 }
 
 func (b *Long) Finalize() {}
@@ -2,52 +2,50 @@ package types
 
 type String string
 
-func (b *String) SetBoolean(v bool) {
-	panic("Unable to assign boolean to string field")
+func (b *String) SetBoolean(v bool) error {
+	return &FieldError{Field: "string", Op: OpAssign, Value: "boolean"}
 }
 
-func (b *String) SetInt(v int32) {
-	panic("Unable to assign int to string field")
+func (b *String) SetInt(v int32) error {
+	return &FieldError{Field: "string", Op: OpAssign, Value: "int"}
 }
 
-func (b *String) SetLong(v int64) {
-	panic("Unable to assign long to string field")
+func (b *String) SetLong(v int64) error {
+	return &FieldError{Field: "string", Op: OpAssign, Value: "long"}
 }
 
-func (b *String) SetFloat(v float32) {
-	panic("Unable to assign float to string field")
+func (b *String) SetFloat(v float32) error {
+	return &FieldError{Field: "string", Op: OpAssign, Value: "float"}
 }
 
-func (b *String) SetUnionElem(v int64) {
-	panic("Unable to assign union elem to string field")
+func (b *String) SetDouble(v float64) error {
+	return &FieldError{Field: "string", Op: OpAssign, Value: "double"}
 }
 
-func (b *String) SetDouble(v float64) {
-	panic("Unable to assign double to string field")
-}
-
-func (b *String) SetBytes(v []byte) {
+func (b *String) SetBytes(v []byte) error {
 	*(*string)(b) = string(v)
+	return nil
 }
 
-func (b *String) SetString(v string) {
+func (b *String) SetString(v string) error {
 	*(*string)(b) = v
+	return nil
 }
 
-func (b *String) Get(i int) Field {
-	panic("Unable to get field from string field")
+func (b *String) Get(i int) (Field, error) {
+	return nil, &FieldError{Field: "string", Op: OpGet, Index: i}
 }
 
-func (b *String) SetDefault(i int) {
-	panic("Unable to set default on string field")
+func (b *String) SetDefault(i int) error {
+	return &FieldError{Field: "string", Op: OpSetDefault, Index: i}
 }
 
-func (b *String) AppendMap(key string) Field {
-	panic("Unable to append map key to from string field")
+func (b *String) AppendMap(key string) (Field, error) {
+	return nil, &FieldError{Field: "string", Op: OpAppendMap}
 }
 
-func (b *String) AppendArray() Field {
-	panic("Unable to append array element to from string field")
+func (b *String) AppendArray() (Field, error) {
+	return nil, &FieldError{Field: "string", Op: OpAppendArray}
 }
 
 func (b *String) Finalize() {}